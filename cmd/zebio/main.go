@@ -4,10 +4,15 @@ import (
 	"context"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/Mohammad-Alipour/Zebio/internal/bot"
+	"github.com/Mohammad-Alipour/Zebio/internal/cache"
 	"github.com/Mohammad-Alipour/Zebio/internal/config"
 	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
 
 	"github.com/joho/godotenv"
 	"github.com/zmb3/spotify/v2"
@@ -30,6 +35,25 @@ func main() {
 	log.Printf("Configuration loaded successfully.")
 	log.Printf(" - YTDLP Path: %s", cfg.YTDLPPath)
 	log.Printf(" - Download Dir: %s", cfg.DownloadDir)
+	log.Printf(" - yt-dlp Timeouts: info %s, search %s, download %s", cfg.InfoTimeout, cfg.SearchTimeout, cfg.DownloadTimeout)
+	log.Printf(" - yt-dlp Retries: %d attempts, backoff %s up to %s", cfg.RetryAttempts, cfg.RetryBaseDelay, cfg.RetryMaxDelay)
+	log.Printf(" - Direct Downloads: max %d MB, %d redirects", cfg.HTTPMaxFileSize/(1024*1024), cfg.HTTPMaxRedirects)
+	if len(cfg.URLAllowDomains) > 0 {
+		log.Printf(" - Allowed Domains: %s", strings.Join(cfg.URLAllowDomains, ", "))
+	}
+	if len(cfg.URLDenyDomains) > 0 {
+		log.Printf(" - Denied Domains: %s", strings.Join(cfg.URLDenyDomains, ", "))
+	}
+	if cfg.AllowPrivateURLs {
+		log.Println(" - Warning: Links to private and loopback addresses are allowed.")
+	}
+	log.Printf(" - Search: %d results, plain text searches %t, %d inline searches at once", cfg.SearchResults, cfg.SearchPlainText, cfg.InlineMaxSearches)
+	if cfg.InlineUploadChatID != 0 {
+		log.Printf(" - Inline Upload Chat: %d", cfg.InlineUploadChatID)
+	}
+	log.Printf(" - Progress Edit Interval: %s", cfg.ProgressEditInterval)
+	log.Printf(" - Shutdown Timeout: %s", cfg.ShutdownTimeout)
+	log.Printf(" - Download Dir Janitor: TTL %s, max %d bytes, min free disk %d bytes, every %s", cfg.DownloadDirTTL, cfg.DownloadDirMaxSize, cfg.MinFreeDisk, cfg.JanitorInterval)
 	if cfg.TelegramBotToken == "" {
 		log.Println("CRITICAL: Telegram Bot Token is not set in configuration! Exiting.")
 		os.Exit(1)
@@ -41,12 +65,30 @@ func main() {
 	} else {
 		log.Println(" - No specific User IDs are restricted by UserID list.")
 	}
+	if len(cfg.AdminUserIDs) > 0 {
+		log.Printf(" - Admin User IDs: %v", cfg.AdminUserIDs)
+	}
+	log.Printf(" - Store: %s (%s)", cfg.StoreDriver, cfg.StorePath)
+	log.Printf(" - File ID Cache: max %d entries, TTL %s", cfg.CacheMaxEntries, cfg.CacheTTL)
+	log.Printf(" - Callback Session TTL: %s", cfg.SessionTTL)
+	log.Printf(" - Audit Log Retention: %s", cfg.AuditRetention)
+	if cfg.TelegramAPIEndpoint != "" {
+		log.Printf(" - Bot API Endpoint: %s (local mode: %t)", cfg.TelegramAPIEndpoint, cfg.TelegramAPILocal)
+	}
+	if cfg.WebhookURL != "" {
+		log.Printf(" - Webhook: %s (listening on %s, TLS: %t, secret token: %t, delete on shutdown: %t)", cfg.WebhookURL, cfg.WebhookListen, cfg.WebhookTLSCert != "", cfg.WebhookSecretToken != "", cfg.WebhookDeleteOnShutdown)
+	} else {
+		log.Printf(" - Updates: long polling")
+	}
+	log.Printf(" - Max Upload Size: %d bytes (oversize strategies: %s)", cfg.MaxUploadSize, strings.Join(cfg.OversizeStrategies, ", "))
 	if cfg.ForceJoinChannel != "" {
 		log.Printf(" - Mandatory Join Channel: %s", cfg.ForceJoinChannel)
 	} else {
 		log.Printf(" - No mandatory channel join is configured.")
 	}
 
+	log.Printf(" - Worker Pool Size: %d (max %d concurrent per user, %d queued per chat)", cfg.WorkerPoolSize, cfg.MaxConcurrentPerUser, cfg.MaxQueuedPerChat)
+
 	var spotifyClient *spotify.Client
 
 	if cfg.SpotifyClientID != "" && cfg.SpotifyClientSecret != "" {
@@ -74,17 +116,47 @@ func main() {
 		log.Printf("Error initializing Downloader: %v", err)
 		os.Exit(1)
 	}
+	defer downloaderService.Close()
 	log.Println("Downloader initialized successfully.")
 
+	log.Println("Opening store...")
+	dataStore, err := store.Open(cfg.StoreDriver, cfg.StorePath)
+	if err != nil {
+		log.Printf("Error opening store: %v", err)
+		os.Exit(1)
+	}
+	defer dataStore.Close()
+	if err := dataStore.Migrate(context.Background()); err != nil {
+		log.Printf("Error running store migrations: %v", err)
+		os.Exit(1)
+	}
+	log.Println("Store opened and migrated successfully.")
+
+	log.Println("Loading file ID cache...")
+	fileCache, err := cache.New(context.Background(), dataStore, cfg.CacheMaxEntries, cfg.CacheTTL)
+	if err != nil {
+		log.Printf("Error loading file ID cache: %v", err)
+		os.Exit(1)
+	}
+	defer fileCache.Flush()
+
 	log.Println("Initializing Telegram bot...")
-	telegramBot, err := bot.New(cfg, downloaderService, spotifyClient)
+	telegramBot, err := bot.New(cfg, downloaderService, spotifyClient, dataStore, fileCache)
 	if err != nil {
 		log.Printf("Error initializing Telegram bot: %v", err)
 		os.Exit(1)
 	}
 
-	log.Println("Application setup complete. Starting Telegram bot polling...")
-	telegramBot.Start()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Println("Application setup complete. Starting Telegram bot...")
+	if err := telegramBot.Start(ctx); err != nil {
+		log.Printf("Error running Telegram bot: %v", err)
+		fileCache.Flush()
+		dataStore.Close()
+		os.Exit(1)
+	}
 
 	log.Println("Bot has stopped.")
 }
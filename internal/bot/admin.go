@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (b *Bot) isAdmin(userID int64) bool {
+	for _, adminID := range b.cfg.AdminUserIDs {
+		if adminID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bot) purgeCacheText(userID int64, args string) string {
+	lang := b.userSettings(userID).Language
+	target := strings.TrimSpace(args)
+	if target == "" {
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "admin.purge_usage"))
+	}
+	if target == "all" {
+		target = ""
+	}
+	removed := b.fileCache.Purge(target)
+	log.Printf("Admin %d purged %d cache entries (target: '%s').", userID, removed, target)
+	b.audit(userID, "cache_purge", fmt.Sprintf("%d entries, target '%s'", removed, target))
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, fmt.Sprintf(tr(lang, "admin.purged"), removed))
+}
+
+func (b *Bot) statsText(lang string) string {
+	stats := b.fileCache.Stats()
+	hitRatio := 0.0
+	if total := stats.Hits + stats.Misses; total > 0 {
+		hitRatio = float64(stats.Hits) / float64(total) * 100
+	}
+	text := fmt.Sprintf(tr(lang, "admin.stats"), stats.Entries, stats.Hits, stats.Misses, hitRatio)
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, text)
+}
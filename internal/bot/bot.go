@@ -2,16 +2,25 @@ package bot
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"net/http"
 	"regexp"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Mohammad-Alipour/Zebio/internal/cache"
 	"github.com/Mohammad-Alipour/Zebio/internal/config"
 	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+	"github.com/Mohammad-Alipour/Zebio/internal/janitor"
+	"github.com/Mohammad-Alipour/Zebio/internal/jobs"
+	"github.com/Mohammad-Alipour/Zebio/internal/media"
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/zmb3/spotify/v2"
@@ -22,23 +31,60 @@ type Bot struct {
 	cfg        *config.Config
 	downloader *downloader.Downloader
 	spotify    *spotify.Client
+	dispatcher *dispatcher
+	jobs       *jobs.Manager
+	fileCache  *cache.Cache
+	store      store.Store
+	media      *media.Processor
+	janitor    *janitor.Janitor
+	// server is nil when updates come from long polling.
+	server *http.Server
+	// background tracks album jobs and resumed jobs running outside the
+	// dispatcher.
+	background sync.WaitGroup
+	inline     *inlineSearches
+	seen       seenUsers
 }
 
-func New(cfg *config.Config, dl *downloader.Downloader, sp *spotify.Client) (*Bot, error) {
+func New(cfg *config.Config, dl *downloader.Downloader, sp *spotify.Client, st store.Store, fileCache *cache.Cache) (*Bot, error) {
 	if cfg.TelegramBotToken == "" {
 		log.Fatal("Telegram Bot Token is not configured. Cannot start bot.")
 	}
-	api, err := tgbotapi.NewBotAPI(cfg.TelegramBotToken)
+	var api *tgbotapi.BotAPI
+	var err error
+	if cfg.TelegramAPIEndpoint != "" {
+		api, err = tgbotapi.NewBotAPIWithAPIEndpoint(cfg.TelegramBotToken, cfg.TelegramAPIEndpoint)
+	} else {
+		api, err = tgbotapi.NewBotAPI(cfg.TelegramBotToken)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new Bot API: %w", err)
 	}
 	log.Printf("Authorized on account %s (@%s)\n", api.Self.FirstName, api.Self.UserName)
-	return &Bot{
+	jobManager, err := jobs.NewManager(context.Background(), st, time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize job manager: %w", err)
+	}
+	b := &Bot{
 		api:        api,
 		cfg:        cfg,
 		downloader: dl,
 		spotify:    sp,
-	}, nil
+		jobs:       jobManager,
+		fileCache:  fileCache,
+		store:      st,
+		media:      media.New(cfg.FFmpegPath, cfg.FFprobePath),
+		janitor:    janitor.New(cfg.DownloadDir, cfg.DownloadDirTTL, cfg.DownloadDirMaxSize, cfg.MinFreeDisk, dl.InUse),
+		inline:     newInlineSearches(cfg.InlineMaxSearches),
+	}
+	b.dispatcher = newDispatcher(cfg.WorkerPoolSize, cfg.MaxConcurrentPerUser, cfg.MaxQueuedPerChat, b.handleQueuedUpdate, b.dropUpdate)
+	if cfg.WebhookURL != "" {
+		b.server = b.newWebhookServer()
+	}
+	go b.sweepSessions(10 * time.Minute)
+	go b.sweepAudit(time.Hour)
+	go b.janitor.Run(cfg.JanitorInterval)
+	return b, nil
 }
 
 func (b *Bot) isUserMemberOfRequiredChannel(userID int64) (bool, string, error) {
@@ -70,17 +116,17 @@ func (b *Bot) isUserMemberOfRequiredChannel(userID int64) (bool, string, error)
 	}
 }
 
-func (b *Bot) sendJoinChannelMessage(chatID int64, channelUsername string, replyToMessageID int) {
+func (b *Bot) sendJoinChannelMessage(chatID int64, channelUsername string, replyToMessageID int, lang string) {
 	channelLink := "https://t.me/" + strings.TrimPrefix(channelUsername, "@")
 	escapedBotName := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, b.api.Self.FirstName)
 	escapedChannelLink := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, channelLink)
-	replyText := fmt.Sprintf("⚠️ کاربر گرامی، برای استفاده از امکانات ربات *%s*، ابتدا باید در کانال رسمی ما عضو شوید:\n\n%s\n\nپس از عضویت، دوباره دستور خود را ارسال کنید یا /start را بزنید\\.", escapedBotName, escapedChannelLink)
+	replyText := fmt.Sprintf(tr(lang, "join.text"), escapedBotName, escapedChannelLink)
 	reply := tgbotapi.NewMessage(chatID, replyText)
 	reply.ParseMode = tgbotapi.ModeMarkdownV2
 	if replyToMessageID != 0 {
 		reply.ReplyToMessageID = replyToMessageID
 	}
-	joinButton := tgbotapi.NewInlineKeyboardButtonURL("عضویت در کانال 🚀", channelLink)
+	joinButton := tgbotapi.NewInlineKeyboardButtonURL(tr(lang, "join.button"), channelLink)
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(joinButton))
 	reply.ReplyMarkup = keyboard
 	if _, err := b.api.Send(reply); err != nil {
@@ -88,172 +134,369 @@ func (b *Bot) sendJoinChannelMessage(chatID int64, channelUsername string, reply
 	}
 }
 
-func (b *Bot) Start() {
+// Start receives updates, either from the webhook server or by long polling,
+// until ctx is done and then shuts the bot down gracefully.
+func (b *Bot) Start(ctx context.Context) error {
+	b.resumeJobs()
+
+	receiveErr := make(chan error, 1)
+	go func() {
+		receiveErr <- b.receiveUpdates()
+	}()
+
+	var err error
+	select {
+	case err = <-receiveErr:
+		if err != nil {
+			log.Printf("Receiving updates failed: %v. Shutting down.", err)
+		}
+	case <-ctx.Done():
+		log.Println("Shutdown requested. No longer accepting updates.")
+	}
+	b.shutdown()
+	return err
+}
+
+func (b *Bot) receiveUpdates() error {
+	if b.server != nil {
+		log.Println("Bot is starting in webhook mode...")
+		return b.serveWebhook()
+	}
+
 	log.Println("Bot is starting to listen for updates...")
+	// getUpdates is refused while a webhook is set, e.g. after switching modes.
+	if err := b.deleteWebhook(); err != nil {
+		return err
+	}
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 	updates := b.api.GetUpdatesChan(u)
 
 	for update := range updates {
-		var userID int64
-		var userName string
-		var chatID int64
-		var messageID int = 0
-		var isCallback bool = false
-		var fromFirstName string = ""
-
-		if update.Message != nil {
-			message := update.Message
-			if message.From == nil {
-				continue
-			}
-			userID = message.From.ID
-			userName = message.From.UserName
-			fromFirstName = message.From.FirstName
-			if userName == "" {
-				userName = fromFirstName
+		b.enqueueUpdate(update)
+	}
+	return nil
+}
+
+func (b *Bot) stopReceiving() {
+	if b.server != nil {
+		b.stopWebhook()
+		return
+	}
+	b.api.StopReceivingUpdates()
+}
+
+// enqueueUpdate hands the update to the dispatcher and tells the user when it
+// has to wait or was rejected. It returns false during shutdown, when the
+// update should be left for Telegram to deliver again.
+func (b *Bot) enqueueUpdate(update tgbotapi.Update) bool {
+	if b.dispatcher.isClosed() {
+		log.Printf("Ignoring update %d received during shutdown.", update.UpdateID)
+		return false
+	}
+	chatID, userID, ok := updateOrigin(update)
+	if !ok {
+		return true
+	}
+	if update.InlineQuery != nil {
+		b.submitInlineQuery(update)
+		return true
+	}
+	if isControlUpdate(update) {
+		go b.dispatcher.run(laneItem{userID: userID, update: update})
+		return true
+	}
+	item := laneItem{userID: userID, update: update}
+	if mayStartJob(update) {
+		item.job = b.queueJob(chatID, userID, update)
+	}
+	position, accepted := b.dispatcher.submit(chatID, item)
+	if !accepted {
+		if item.job != nil {
+			b.jobs.Discard(item.job.job.ID)
+		}
+		if b.dispatcher.isClosed() {
+			return false
+		}
+		log.Printf("Queue for chat %d is full. Rejecting update %d from user %d.", chatID, update.UpdateID, userID)
+		b.sendQueueNotice(update, chatID, tr(b.userSettings(userID).Language, "queue.full"), "")
+		return true
+	}
+	if position > 0 {
+		log.Printf("Update %d from user %d queued at position %d for chat %d.", update.UpdateID, userID, position, chatID)
+		jobID := ""
+		if item.job != nil {
+			jobID = item.job.job.ID
+		}
+		b.sendQueueNotice(update, chatID, fmt.Sprintf(tr(b.userSettings(userID).Language, "queue.position"), position), jobID)
+	}
+	return true
+}
+
+func updateOrigin(update tgbotapi.Update) (int64, int64, bool) {
+	if update.Message != nil && update.Message.From != nil {
+		return update.Message.Chat.ID, update.Message.From.ID, true
+	}
+	if update.CallbackQuery != nil && update.CallbackQuery.From != nil {
+		if update.CallbackQuery.Message != nil {
+			return update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.From.ID, true
+		}
+		return update.CallbackQuery.From.ID, update.CallbackQuery.From.ID, true
+	}
+	// Inline updates have no chat; they are queued with the private chat.
+	if update.InlineQuery != nil && update.InlineQuery.From != nil {
+		return update.InlineQuery.From.ID, update.InlineQuery.From.ID, true
+	}
+	if update.ChosenInlineResult != nil && update.ChosenInlineResult.From != nil {
+		return update.ChosenInlineResult.From.ID, update.ChosenInlineResult.From.ID, true
+	}
+	return 0, 0, false
+}
+
+// sendQueueNotice answers the update with text. Notices about a queued job
+// get a button to cancel it.
+func (b *Bot) sendQueueNotice(update tgbotapi.Update, chatID int64, text string, jobID string) {
+	if update.CallbackQuery != nil {
+		b.api.Send(tgbotapi.NewCallback(update.CallbackQuery.ID, text))
+		return
+	}
+	if update.Message == nil {
+		return
+	}
+	notice := tgbotapi.NewMessage(chatID, text)
+	notice.ReplyToMessageID = update.Message.MessageID
+	if jobID != "" {
+		notice.ReplyMarkup = cancelKeyboard(b.jobLanguage(jobID), jobID)
+	}
+	if _, err := b.api.Send(notice); err != nil {
+		log.Printf("Error sending queue notice to chat %d: %v", chatID, err)
+	}
+}
+
+// handleQueuedUpdate runs an update taken from the dispatcher. An update
+// whose job was cancelled while it waited is skipped.
+func (b *Bot) handleQueuedUpdate(item laneItem) {
+	if queued := item.job; queued != nil {
+		defer b.releaseQueuedJob(queued)
+		if queued.ctx.Err() != nil {
+			log.Printf("Skipping queued job %s of user %d: it was cancelled while waiting.", queued.job.ID, item.userID)
+			if item.update.CallbackQuery != nil {
+				b.api.Send(tgbotapi.NewCallback(item.update.CallbackQuery.ID, ""))
 			}
-			chatID = message.Chat.ID
-			messageID = message.MessageID
-			log.Printf("[%s (%d)] Received message: %s\n", userName, userID, message.Text)
-		} else if update.CallbackQuery != nil {
-			isCallback = true
-			callback := update.CallbackQuery
-			if callback.From == nil {
-				continue
+			return
+		}
+	}
+	if item.run != nil {
+		item.run(item.job)
+		return
+	}
+	b.handleUpdate(item.job, item.update)
+}
+
+func (b *Bot) handleUpdate(queued *queuedJob, update tgbotapi.Update) {
+	if update.ChosenInlineResult != nil {
+		b.handleInlineUpdate(queuedContext(queued), queued, update)
+		return
+	}
+
+	var userID int64
+	var userName string
+	var chatID int64
+	var messageID int = 0
+	var isCallback bool = false
+	var fromFirstName string = ""
+
+	if update.Message != nil {
+		message := update.Message
+		if message.From == nil {
+			return
+		}
+		userID = message.From.ID
+		userName = message.From.UserName
+		fromFirstName = message.From.FirstName
+		if userName == "" {
+			userName = fromFirstName
+		}
+		chatID = message.Chat.ID
+		messageID = message.MessageID
+		log.Printf("[%s (%d)] Received message: %s\n", userName, userID, message.Text)
+	} else if update.CallbackQuery != nil {
+		isCallback = true
+		callback := update.CallbackQuery
+		if callback.From == nil {
+			return
+		}
+		userID = callback.From.ID
+		userName = callback.From.UserName
+		fromFirstName = callback.From.FirstName
+		if userName == "" {
+			userName = fromFirstName
+		}
+		if callback.Message != nil {
+			chatID = callback.Message.Chat.ID
+			if callback.Message.ReplyToMessage != nil {
+				messageID = callback.Message.ReplyToMessage.MessageID
+			} else {
+				messageID = callback.Message.MessageID
 			}
-			userID = callback.From.ID
-			userName = callback.From.UserName
-			fromFirstName = callback.From.FirstName
-			if userName == "" {
-				userName = fromFirstName
+		}
+		log.Printf("[%s (%d)] Received callback query data: %s from message %d\n", userName, userID, callback.Data, messageID)
+	} else {
+		return
+	}
+
+	if update.Message != nil {
+		b.rememberUser(update.Message.From)
+	} else {
+		b.rememberUser(update.CallbackQuery.From)
+	}
+	lang := b.userSettings(userID).Language
+
+	if b.cfg.ForceJoinChannel != "" {
+		isMember, channelToJoin, err := b.isUserMemberOfRequiredChannel(userID)
+		if err != nil {
+			log.Printf("Error during channel membership check for user %d: %v. Sending error message.", userID, err)
+			errMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "error.membership_check"))
+			reply := tgbotapi.NewMessage(chatID, errMsgText)
+			reply.ParseMode = tgbotapi.ModeMarkdownV2
+			if messageID != 0 && !isCallback {
+				reply.ReplyToMessageID = messageID
 			}
-			if callback.Message != nil {
-				chatID = callback.Message.Chat.ID
-				if callback.Message.ReplyToMessage != nil {
-					messageID = callback.Message.ReplyToMessage.MessageID
+			b.api.Send(reply)
+			return
+		}
+		if !isMember {
+			log.Printf("User %d (%s) is not a member of %s. Requesting join.", userID, userName, channelToJoin)
+			replyToID := messageID
+			if isCallback {
+				if update.CallbackQuery.Message.ReplyToMessage != nil {
+					replyToID = update.CallbackQuery.Message.ReplyToMessage.MessageID
 				} else {
-					messageID = callback.Message.MessageID
+					replyToID = 0
 				}
 			}
-			log.Printf("[%s (%d)] Received callback query data: %s from message %d\n", userName, userID, callback.Data, messageID)
-		} else {
-			continue
+			b.sendJoinChannelMessage(chatID, channelToJoin, replyToID, lang)
+			if isCallback {
+				b.api.Send(tgbotapi.NewCallback(update.CallbackQuery.ID, tr(lang, "join.alert")))
+			}
+			return
 		}
+	}
 
-		if b.cfg.ForceJoinChannel != "" {
-			isMember, channelToJoin, err := b.isUserMemberOfRequiredChannel(userID)
-			if err != nil {
-				log.Printf("Error during channel membership check for user %d: %v. Sending error message.", userID, err)
-				errMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "خطا در بررسی عضویت کانال\\. لطفاً لحظاتی دیگر دوباره امتحان کنید\\.")
-				reply := tgbotapi.NewMessage(chatID, errMsgText)
-				reply.ParseMode = tgbotapi.ModeMarkdownV2
-				if messageID != 0 && !isCallback {
-					reply.ReplyToMessageID = messageID
-				}
-				b.api.Send(reply)
-				continue
-			}
-			if !isMember {
-				log.Printf("User %d (%s) is not a member of %s. Requesting join.", userID, userName, channelToJoin)
-				replyToID := messageID
-				if isCallback {
-					if update.CallbackQuery.Message.ReplyToMessage != nil {
-						replyToID = update.CallbackQuery.Message.ReplyToMessage.MessageID
-					} else {
-						replyToID = 0
-					}
-				}
-				b.sendJoinChannelMessage(chatID, channelToJoin, replyToID)
-				if isCallback {
-					b.api.Send(tgbotapi.NewCallback(update.CallbackQuery.ID, "لطفا ابتدا در کانال عضو شوید\\."))
-				}
-				continue
+	if len(b.cfg.AllowedUserIDs) > 0 {
+		isAllowed := false
+		for _, allowedID := range b.cfg.AllowedUserIDs {
+			if userID == allowedID {
+				isAllowed = true
+				break
 			}
 		}
-
-		if len(b.cfg.AllowedUserIDs) > 0 {
-			isAllowed := false
-			for _, allowedID := range b.cfg.AllowedUserIDs {
-				if userID == allowedID {
-					isAllowed = true
-					break
-				}
+		if !isAllowed {
+			log.Printf("User %s (%d) is not in AllowedUserIDs list. Ignoring.", userName, userID)
+			errMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "error.not_allowed"))
+			reply := tgbotapi.NewMessage(chatID, errMsgText)
+			reply.ParseMode = tgbotapi.ModeMarkdownV2
+			if messageID != 0 && !isCallback {
+				reply.ReplyToMessageID = messageID
 			}
-			if !isAllowed {
-				log.Printf("User %s (%d) is not in AllowedUserIDs list. Ignoring.", userName, userID)
-				errMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "متاسفم، شما اجازه استفاده از این ربات را ندارید\\.")
-				reply := tgbotapi.NewMessage(chatID, errMsgText)
-				reply.ParseMode = tgbotapi.ModeMarkdownV2
-				if messageID != 0 && !isCallback {
-					reply.ReplyToMessageID = messageID
-				}
-				b.api.Send(reply)
-				if isCallback {
-					b.api.Send(tgbotapi.NewCallback(update.CallbackQuery.ID, "شما مجاز نیستید\\."))
-				}
-				continue
+			b.api.Send(reply)
+			if isCallback {
+				b.api.Send(tgbotapi.NewCallback(update.CallbackQuery.ID, tr(lang, "error.not_allowed_alert")))
 			}
+			return
 		}
+	}
 
-		if isCallback {
-			b.handleCallbackQuery(update.CallbackQuery, userName, userID, fromFirstName)
-		} else if update.Message.IsCommand() {
-			b.handleCommand(update.Message, fromFirstName)
-		} else if update.Message.Text != "" {
-			if strings.Contains(update.Message.Text, "spotify.com") {
-				b.handleSpotifyLink(update.Message, userName, userID, fromFirstName)
-			} else {
-				b.handleLink(update.Message, userName, userID, fromFirstName)
-			}
-		} else {
-			log.Printf("[%s (%d)] Received non-text, non-command message. Ignoring.", userName, userID)
-		}
+	if isCallback {
+		b.handleCallbackQuery(queued, update.CallbackQuery, userName, userID, fromFirstName)
+	} else if update.Message.IsCommand() {
+		b.handleCommand(queued, update.Message, fromFirstName)
+	} else if links := extractLinks(update.Message, b.cfg.MaxLinksPerMessage); len(links) > 1 {
+		b.handleBatch(update.Message, links, userName, userID)
+	} else if len(links) == 1 {
+		b.routeLink(queued, update.Message, links[0], "", userName, userID, fromFirstName)
+	} else if update.Message.Text != "" && b.cfg.SearchPlainText && !looksLikeLink(update.Message.Text) {
+		b.handleSearch(queued, update.Message, update.Message.Text, userName, userID)
+	} else if update.Message.Text != "" {
+		b.handleLink(queued, update.Message, "", userName, userID, fromFirstName)
+	} else {
+		log.Printf("[%s (%d)] Received non-text, non-command message. Ignoring.", userName, userID)
 	}
 }
 
-func (b *Bot) handleCommand(message *tgbotapi.Message, fromFirstName string) {
+func (b *Bot) handleCommand(queued *queuedJob, message *tgbotapi.Message, fromFirstName string) {
 	userName := message.From.UserName
 	if userName == "" {
 		userName = fromFirstName
 	}
 	command := message.Command()
 	log.Printf("[%s (%d)] Received command: /%s\n", userName, message.From.ID, command)
+	b.audit(message.From.ID, "command", "/"+command+" "+message.CommandArguments())
 
 	var msgText string
+	var keyboard *tgbotapi.InlineKeyboardMarkup
+	settings := b.userSettings(message.From.ID)
 	escapedFirstName := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, fromFirstName)
 	escapedBotDisplayName := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, b.api.Self.FirstName)
 
 	switch command {
 	case "start":
-		msgText = fmt.Sprintf("سلام *%s* عزیز\\! 👋\n\nبه ربات دانلودر *%s* خوش اومدی\\.\nمن می‌تونم از لینک‌هایی که می‌فرستی \\(مثل یوتیوب، ساندکلود، اینستاگرام و\\.\\.\\.\\) برات فایل صوتی یا ویدیویی دانلود کنم\\.\n\n🔗 کافیه لینک مورد نظرت رو برام ارسال کنی\\!\n\nراهنمایی بیشتر: /help", escapedFirstName, escapedBotDisplayName)
+		msgText = fmt.Sprintf(tr(settings.Language, "start"), escapedFirstName, escapedBotDisplayName)
 	case "help":
-		msgText = fmt.Sprintf("راهنمای استفاده از ربات *%s* 🤖\n\n۱\\. لینک مستقیم از پلتفرم‌هایی مثل:\n   یوتیوب 🔴\n   ساندکلود 🟠\n   اینستاگرام 🟣\n   و \\.\\.\\. رو برای من ارسال کن\\.\n\n۲\\. اگر محتوای لینک هم صوتی و هم تصویری باشه، ازت می‌پرسم که کدوم رو می‌خوای برات دانلود کنم:\n   🎵 *صدا* \\(فایل MP3 با کاور\\)\n   🎬 *ویدیو* \\(فایل MP4\\)\n\n۳\\. بعد از انتخاب، فایل رو برات آماده و ارسال می‌کنم\\!", escapedBotDisplayName)
+		msgText = fmt.Sprintf(tr(settings.Language, "help"), escapedBotDisplayName)
+	case "settings":
+		msgText = settingsText(settings)
+		settingsMarkup := settingsKeyboard(settings)
+		keyboard = &settingsMarkup
+	case "queue":
+		msgText = b.queueListText(message.From.ID)
+	case "cancel":
+		msgText = b.cancelJobText(message.From.ID, message.CommandArguments())
+	case "search":
+		b.handleSearch(queued, message, message.CommandArguments(), userName, message.From.ID)
+		return
+	case "purge", "stats", "disk":
+		if !b.isAdmin(message.From.ID) {
+			log.Printf("[%s (%d)] Non-admin tried admin command /%s", userName, message.From.ID, command)
+			msgText = tr(settings.Language, "unknown_command")
+		} else if command == "purge" {
+			msgText = b.purgeCacheText(message.From.ID, message.CommandArguments())
+		} else if command == "disk" {
+			msgText = b.diskText(settings.Language)
+		} else {
+			msgText = b.statsText(settings.Language)
+		}
 	default:
-		msgText = tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "دستور شناخته نشد\\. برای راهنمایی /help رو بزنید\\.")
+		msgText = tr(settings.Language, "unknown_command")
 	}
 	reply := tgbotapi.NewMessage(message.Chat.ID, msgText)
 	reply.ParseMode = tgbotapi.ModeMarkdownV2
 	reply.ReplyToMessageID = message.MessageID
+	if keyboard != nil {
+		reply.ReplyMarkup = *keyboard
+	}
 	if _, err := b.api.Send(reply); err != nil {
 		log.Printf("[%s (%d)] Error sending command reply: %v", userName, message.From.ID, err)
 	}
 }
 
-func (b *Bot) handleSpotifyLink(message *tgbotapi.Message, userName string, userID int64, fromFirstName string) {
+func (b *Bot) handleSpotifyLink(queued *queuedJob, message *tgbotapi.Message, userName string, userID int64, fromFirstName string) {
+	ctx := queuedContext(queued)
 	chatID := message.Chat.ID
 	userIdentifier := userName + "_" + strconv.FormatInt(userID, 10)
+	lang := b.userSettings(userID).Language
 	log.Printf("[%s] Received Spotify link: %s", userIdentifier, message.Text)
+	b.audit(userID, "spotify_link", message.Text)
 
 	if b.spotify == nil {
 		log.Printf("[%s] Spotify feature is disabled because client is not configured.", userIdentifier)
-		errMsg := tgbotapi.NewMessage(chatID, "قابلیت اسپاتیفای در حال حاضر فعال نیست.")
+		errMsg := tgbotapi.NewMessage(chatID, tr(lang, "spotify.disabled"))
 		errMsg.ReplyToMessageID = message.MessageID
 		b.api.Send(errMsg)
 		return
 	}
 
-	processingMsg := tgbotapi.NewMessage(chatID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "🔗 لینک اسپاتیفای دریافت شد. در حال پردازش..."))
+	processingMsg := tgbotapi.NewMessage(chatID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "spotify.processing")))
 	processingMsg.ReplyToMessageID = message.MessageID
 	sentPInfoMsg, _ := b.api.Send(processingMsg)
 
@@ -262,7 +505,7 @@ func (b *Bot) handleSpotifyLink(message *tgbotapi.Message, userName string, user
 	if len(matches) < 3 {
 		log.Printf("[%s] Could not parse Spotify link type/ID from URL: %s", userIdentifier, message.Text)
 		if sentPInfoMsg.MessageID != 0 {
-			b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, "خطا: لینک اسپاتیفای معتبر به نظر نمی‌رسد."))
+			b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, tr(lang, "spotify.invalid_link")))
 		}
 		return
 	}
@@ -271,10 +514,10 @@ func (b *Bot) handleSpotifyLink(message *tgbotapi.Message, userName string, user
 	linkID := spotify.ID(matches[2])
 
 	if linkType == "track" {
-		track, err := b.spotify.GetTrack(context.Background(), linkID)
+		track, err := b.spotify.GetTrack(ctx, linkID)
 		if err != nil {
 			log.Printf("[%s] Could not get track info from Spotify API: %v", userIdentifier, err)
-			b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, "خطا در دریافت اطلاعات از API اسپاتیفای."))
+			b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, tr(lang, "spotify.api_error")))
 			return
 		}
 
@@ -285,16 +528,16 @@ func (b *Bot) handleSpotifyLink(message *tgbotapi.Message, userName string, user
 		artistStr := strings.Join(artists, ", ")
 		searchQuery := fmt.Sprintf("%s - %s", artistStr, track.Name)
 
-		b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "✅ اطلاعات آهنگ دریافت شد. در حال جستجوی آهنگ جایگزین...")))
+		b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "spotify.track_found"))))
 
-		foundURL, err := b.downloader.FindYouTubeURL(searchQuery, userIdentifier)
+		foundURL, err := b.downloader.FindURL(ctx, downloader.SearchYouTube, searchQuery, userIdentifier)
 		if err != nil {
 			log.Printf("[%s] Could not find on YouTube, trying SoundCloud... Query: '%s'", userIdentifier, searchQuery)
-			b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "در یوتیوب پیدا نشد. در حال جستجو در ساندکلود...")))
-			foundURL, err = b.downloader.FindSoundCloudURL(searchQuery, userIdentifier)
+			b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "spotify.trying_soundcloud"))))
+			foundURL, err = b.downloader.FindURL(ctx, downloader.SearchSoundCloud, searchQuery, userIdentifier)
 			if err != nil {
 				log.Printf("[%s] Could not find on YouTube or SoundCloud for query '%s': %v", userIdentifier, searchQuery, err)
-				b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, "متاسفانه آهنگ مورد نظر در یوتیوب و ساندکلود پیدا نشد."))
+				b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, tr(lang, "spotify.not_found")))
 				return
 			}
 		}
@@ -307,7 +550,7 @@ func (b *Bot) handleSpotifyLink(message *tgbotapi.Message, userName string, user
 
 		newMessage := *message
 		newMessage.Text = foundURL
-		b.handleLink(&newMessage, userName, userID, fromFirstName)
+		b.handleLink(queued, &newMessage, "", userName, userID, fromFirstName)
 		return
 	}
 
@@ -317,10 +560,10 @@ func (b *Bot) handleSpotifyLink(message *tgbotapi.Message, userName string, user
 		var owner string
 
 		if linkType == "album" {
-			album, err := b.spotify.GetAlbum(context.Background(), linkID)
+			album, err := b.spotify.GetAlbum(ctx, linkID)
 			if err != nil {
 				log.Printf("[%s] Could not get album info from Spotify API: %v", userIdentifier, err)
-				b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, "خطا در دریافت اطلاعات آلبوم از API اسپاتیفای."))
+				b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, tr(lang, "spotify.album_api_error")))
 				return
 			}
 			name = album.Name
@@ -331,10 +574,10 @@ func (b *Bot) handleSpotifyLink(message *tgbotapi.Message, userName string, user
 			}
 			owner = strings.Join(artists, ", ")
 		} else {
-			playlist, err := b.spotify.GetPlaylist(context.Background(), linkID)
+			playlist, err := b.spotify.GetPlaylist(ctx, linkID)
 			if err != nil {
 				log.Printf("[%s] Could not get playlist info from Spotify API: %v", userIdentifier, err)
-				b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, "خطا در دریافت اطلاعات پلی‌لیست از API اسپاتیفای."))
+				b.api.Send(tgbotapi.NewEditMessageText(chatID, sentPInfoMsg.MessageID, tr(lang, "spotify.playlist_api_error")))
 				return
 			}
 			name = playlist.Name
@@ -348,9 +591,16 @@ func (b *Bot) handleSpotifyLink(message *tgbotapi.Message, userName string, user
 
 		escapedName := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, name)
 		escapedOwner := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, owner)
-		albumMsgText := fmt.Sprintf("آلبوم/پلی‌لیست اسپاتیفای پیدا شد:\n*%s*\nتوسط: `%s`\nتعداد آهنگ‌ها: *%d*\n\nبرای دانلود، هر آهنگ در یوتیوب/ساندکلود جستجو خواهد شد\\. این فرآیند ممکن است بسیار زمان‌بر باشد\\. ادامه می‌دهید؟", escapedName, escapedOwner, totalTracks)
-		yesButton := tgbotapi.NewInlineKeyboardButtonData("✅ بله، دانلود کن", fmt.Sprintf("spotifyalbum:yes:%s:%s", linkType, linkID))
-		noButton := tgbotapi.NewInlineKeyboardButtonData("❌ نه", "spotifyalbum:no")
+		albumMsgText := fmt.Sprintf(tr(lang, "spotify.album_found"), escapedName, escapedOwner, totalTracks)
+		spotifyURL := "https://open.spotify.com/" + linkType + "/" + string(linkID)
+		token, err := b.newSession(sessionKindSpotifyAlbum, userID, chatID, message.MessageID, spotifyURL, spotifyAlbumPayload{LinkType: linkType, LinkID: string(linkID)})
+		if err != nil {
+			log.Printf("[%s] Error creating session for Spotify album: %v", userIdentifier, err)
+			b.api.Send(tgbotapi.NewMessage(chatID, tr(lang, "error.internal")))
+			return
+		}
+		yesButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.album_yes"), "spotifyalbum:yes:"+token)
+		noButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.album_no"), "spotifyalbum:no:"+token)
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(yesButton, noButton))
 		albumMsg := tgbotapi.NewMessage(chatID, albumMsgText)
 		albumMsg.ParseMode = tgbotapi.ModeMarkdownV2
@@ -360,42 +610,61 @@ func (b *Bot) handleSpotifyLink(message *tgbotapi.Message, userName string, user
 	}
 }
 
-func (b *Bot) handleLink(message *tgbotapi.Message, userName string, userID int64, fromFirstName string) {
+// handleLink probes a single link and asks what to download. defaultType
+// overrides the default type from the user's settings when not empty.
+func (b *Bot) handleLink(queued *queuedJob, message *tgbotapi.Message, defaultType string, userName string, userID int64, fromFirstName string) {
 	chatID := message.Chat.ID
-	urlToDownload := message.Text
 	userIdentifier := userName + "_" + strconv.FormatInt(userID, 10)
+	lang := b.userSettings(userID).Language
 
-	log.Printf("[%s] Received link to process: %s", userIdentifier, urlToDownload)
+	log.Printf("[%s] Received link to process: %s", userIdentifier, message.Text)
+	b.audit(userID, "link", message.Text)
+
+	urlToDownload, err := b.downloader.CheckURL(queuedContext(queued), message.Text)
+	if err != nil {
+		log.Printf("[%s] Rejected link %s: %v", userIdentifier, message.Text, err)
+		errMsg := tgbotapi.NewMessage(chatID, downloadErrorText(lang, err))
+		errMsg.ReplyToMessageID = message.MessageID
+		b.api.Send(errMsg)
+		return
+	}
 
-	processingMsg := tgbotapi.NewMessage(chatID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "🔍 در حال بررسی و دریافت اطلاعات از لینک شما... لطفاً چند لحظه صبر کنید."))
+	processingMsg := tgbotapi.NewMessage(chatID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "link.fetching")))
 	processingMsg.ReplyToMessageID = message.MessageID
 	sentPInfoMsg, err := b.api.Send(processingMsg)
 	if err != nil {
 		log.Printf("[%s] Error sending 'fetching link info' message: %v", userIdentifier, err)
 	}
 
-	linkInfo, err := b.downloader.GetLinkInfo(urlToDownload, userIdentifier)
+	linkInfo, err := b.downloader.GetLinkInfo(queuedContext(queued), urlToDownload, userIdentifier)
 	if sentPInfoMsg.MessageID != 0 {
 		b.api.Send(tgbotapi.NewDeleteMessage(chatID, sentPInfoMsg.MessageID))
 	}
 
+	if err != nil && queuedContext(queued).Err() != nil {
+		log.Printf("[%s] Job for %s was cancelled while fetching link info.", userIdentifier, urlToDownload)
+		return
+	}
 	if err != nil {
 		log.Printf("[%s] Error fetching link info for URL %s: %v", userIdentifier, urlToDownload, err)
-		escapedError := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, err.Error())
-		errorMsgText := fmt.Sprintf("⚠️ متاسفانه در پردازش اولیه لینک شما مشکلی پیش آمد\\.\n\nعلت خطا:\n`%s`\n\nلطفاً از صحت لینک مطمئن شوید یا لینک دیگری را امتحان کنید\\. اگر مشکل ادامه داشت، بعداً دوباره تلاش کنید\\.", escapedError)
-		errMsg := tgbotapi.NewMessage(chatID, errorMsgText)
-		errMsg.ParseMode = tgbotapi.ModeMarkdownV2
+		errMsg := tgbotapi.NewMessage(chatID, tr(lang, "error.link_failed")+"\n\n"+downloadErrorText(lang, err))
 		errMsg.ReplyToMessageID = message.MessageID
 		b.api.Send(errMsg)
 		return
 	}
 
 	if linkInfo.Type == "album" && len(linkInfo.Tracks) > 0 {
+		token, err := b.newSession(sessionKindAlbum, userID, chatID, message.MessageID, urlToDownload, linkInfo)
+		if err != nil {
+			log.Printf("[%s] Error creating session for album %s: %v", userIdentifier, urlToDownload, err)
+			b.api.Send(tgbotapi.NewMessage(chatID, tr(lang, "error.internal")))
+			return
+		}
 		escapedTitle := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, linkInfo.Title)
 		escapedUploader := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, linkInfo.Uploader)
-		albumMsgText := fmt.Sprintf("آلبوم یا پلی‌لیست پیدا شد:\n*%s*\nتوسط: `%s`\nتعداد آهنگ‌ها: *%d*\n\nآیا می‌خواهید تمام آهنگ‌ها دانلود شوند؟", escapedTitle, escapedUploader, len(linkInfo.Tracks))
-		yesButton := tgbotapi.NewInlineKeyboardButtonData("✅ بله، دانلود کن", "dlalbum:yes")
-		noButton := tgbotapi.NewInlineKeyboardButtonData("❌ نه", "dlalbum:no")
+		albumMsgText := fmt.Sprintf(tr(lang, "album.found"), escapedTitle, escapedUploader, len(linkInfo.Tracks))
+		yesButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.album_yes"), "dlalbum:yes:"+token)
+		noButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.album_no"), "dlalbum:no:"+token)
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(yesButton, noButton))
 		albumMsg := tgbotapi.NewMessage(chatID, albumMsgText)
 		albumMsg.ParseMode = tgbotapi.ModeMarkdownV2
@@ -407,25 +676,28 @@ func (b *Bot) handleLink(message *tgbotapi.Message, userName string, userID int6
 
 	if linkInfo.Type == "track" && len(linkInfo.Tracks) == 1 {
 		trackInfo := linkInfo.Tracks[0]
-		var buttons []tgbotapi.InlineKeyboardButton
-
-		if trackInfo.HasVideo {
-			videoButton := tgbotapi.NewInlineKeyboardButtonData("دانلود ویدیو 🎬", fmt.Sprintf("dltype:video:%d", message.MessageID))
-			audioButton := tgbotapi.NewInlineKeyboardButtonData("دانلود صدا 🎵", fmt.Sprintf("dltype:audio:%d", message.MessageID))
-			buttons = append(buttons, videoButton, audioButton)
+		settings := b.userSettings(userID)
+		if defaultType != "" {
+			settings.DefaultType = defaultType
 		}
-		if trackInfo.HasImage {
-			photoButton := tgbotapi.NewInlineKeyboardButtonData("دانلود عکس 🖼️", fmt.Sprintf("dltype:photo:%d", message.MessageID))
-			buttons = append(buttons, photoButton)
-		}
-		if trackInfo.IsAudioOnly {
-			audioButton := tgbotapi.NewInlineKeyboardButtonData("دانلود صدا 🎵", fmt.Sprintf("dltype:audio:%d", message.MessageID))
-			buttons = append(buttons, audioButton)
+		if dlType, ok := defaultDownloadType(settings, trackInfo); ok {
+			log.Printf("[%s] Using default download type '%s' from settings for %s.", userIdentifier, settings.DefaultType, urlToDownload)
+			job, jobCtx := b.takeJob(queued, userID, chatID, jobs.KindSingle, trackInfo.Title, urlToDownload)
+			b.processDownloadRequest(jobCtx, job, chatID, message.MessageID, trackDownloadURL(trackInfo, urlToDownload), mediaSpec(settings, dlType), trackInfo, userName, userID, fromFirstName)
+			return
 		}
 
-		if len(buttons) == 0 {
+		token, err := b.newSession(sessionKindLink, userID, chatID, message.MessageID, urlToDownload, linkInfo)
+		if err != nil {
+			log.Printf("[%s] Error creating session for link %s: %v", userIdentifier, urlToDownload, err)
+			b.api.Send(tgbotapi.NewMessage(chatID, tr(lang, "error.internal")))
+			return
+		}
+		keyboard, ok := choiceKeyboard(settings.Language, trackInfo, token)
+		if !ok {
+			b.deleteSession(token)
 			log.Printf("[%s] No downloadable content type found for URL %s. Informing user.", userIdentifier, urlToDownload)
-			errMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "محتوای قابل دانلودی \\(ویدیو، صدا یا عکس\\) در این لینک پیدا نشد\\.")
+			errMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "error.no_content"))
 			errMsg := tgbotapi.NewMessage(chatID, errMsgText)
 			errMsg.ParseMode = tgbotapi.ModeMarkdownV2
 			errMsg.ReplyToMessageID = message.MessageID
@@ -433,15 +705,14 @@ func (b *Bot) handleLink(message *tgbotapi.Message, userName string, userID int6
 			return
 		}
 
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons)
 		escapedArtist := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, trackInfo.Artist)
 		escapedTitle := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, trackInfo.Title)
 
 		choiceMsgText := ""
 		if trackInfo.Title != "Unknown Title" && trackInfo.Artist != "Unknown Artist" {
-			choiceMsgText = fmt.Sprintf("✅ اطلاعات با موفقیت دریافت شد:\n*پیج/خواننده:* `%s`\n*عنوان:* `%s`\n\nحالا انتخاب کنید که کدام مورد را برای شما آماده کنم؟ 👇", escapedArtist, escapedTitle)
+			choiceMsgText = fmt.Sprintf(tr(settings.Language, "choice.with_info"), escapedArtist, escapedTitle)
 		} else {
-			choiceMsgText = "✅ اطلاعات اولیه لینک دریافت شد\\.\n\nلطفاً نوع دانلود مورد نظرتون رو انتخاب کنید: 👇"
+			choiceMsgText = tr(settings.Language, "choice.generic")
 		}
 
 		choiceMsg := tgbotapi.NewMessage(chatID, choiceMsgText)
@@ -455,155 +726,308 @@ func (b *Bot) handleLink(message *tgbotapi.Message, userName string, userID int6
 	}
 
 	log.Printf("[%s] Link type was not 'album' or 'track', or track list was empty. URL: %s", userIdentifier, urlToDownload)
-	errMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "نوع لینک ارسال شده پشتیبانی نمی‌شود یا محتوایی در آن یافت نشد\\.")
+	errMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "error.unsupported_link"))
 	errMsg := tgbotapi.NewMessage(chatID, errMsgText)
 	errMsg.ParseMode = tgbotapi.ModeMarkdownV2
 	errMsg.ReplyToMessageID = message.MessageID
 	b.api.Send(errMsg)
 }
 
-func (b *Bot) handleCallbackQuery(callback *tgbotapi.CallbackQuery, userName string, userID int64, fromFirstName string) {
-	b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+func choiceKeyboard(lang string, trackInfo *downloader.TrackInfo, token string) (tgbotapi.InlineKeyboardMarkup, bool) {
+	var buttons []tgbotapi.InlineKeyboardButton
 
-	chatID := callback.Message.Chat.ID
+	if trackInfo.HasVideo {
+		videoButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.video"), "dltype:video:"+token)
+		audioButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.audio"), "dltype:audio:"+token)
+		buttons = append(buttons, videoButton, audioButton)
+	}
+	if trackInfo.HasImage {
+		photoButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.photo"), "dltype:photo:"+token)
+		buttons = append(buttons, photoButton)
+	}
+	if trackInfo.IsAudioOnly {
+		audioButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.audio"), "dltype:audio:"+token)
+		buttons = append(buttons, audioButton)
+	}
+	if len(buttons) == 0 {
+		return tgbotapi.InlineKeyboardMarkup{}, false
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{buttons}
+	if trackInfo.HasVideo || trackInfo.IsAudioOnly {
+		formatsButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.audio_formats"), "dlformats:show:"+token)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(formatsButton))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...), true
+}
+
+func (b *Bot) handleCallbackQuery(queued *queuedJob, callback *tgbotapi.CallbackQuery, userName string, userID int64, fromFirstName string) {
 	userIdentifier := userName + "_" + strconv.FormatInt(userID, 10)
+	if strings.HasPrefix(callback.Data, "jobcancel:") {
+		b.handleJobCancelCallback(callback, userIdentifier)
+		return
+	}
+	if strings.HasPrefix(callback.Data, "settings:") {
+		b.handleSettingsCallback(callback, userIdentifier)
+		return
+	}
+
 	parts := strings.Split(callback.Data, ":")
+	if len(parts) < 3 || callback.Message == nil {
+		log.Printf("[%s] Malformed callback data: %s", userIdentifier, callback.Data)
+		b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+	chatID := callback.Message.Chat.ID
+	action, token := parts[1], parts[2]
 
-	if len(parts) > 0 {
-		switch parts[0] {
-		case "dlalbum":
-			if len(parts) < 2 {
-				return
-			}
-			action := parts[1]
-			if action == "no" {
-				log.Printf("[%s] User cancelled album download.", userIdentifier)
-				b.api.Send(tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID))
-				return
-			}
-			if action == "yes" {
-				var originalLinkURL string
-				if callback.Message != nil && callback.Message.ReplyToMessage != nil {
-					originalLinkURL = callback.Message.ReplyToMessage.Text
-				}
-				if originalLinkURL == "" {
-					return
-				}
+	switch parts[0] {
+	case "dlbatch":
+		b.handleBatchCallback(queued, callback, action, token, userName, userID, fromFirstName)
 
-				editMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "✅ بسیار خب! فرآیند دانلود آلبوم ساندکلود آغاز شد...")
-				editMsg := tgbotapi.NewEditMessageText(chatID, callback.Message.MessageID, editMsgText)
-				editMsg.ParseMode = tgbotapi.ModeMarkdownV2
-				editMsg.ReplyMarkup = nil
-				b.api.Send(editMsg)
+	case "dlsearch":
+		b.handleSearchCallback(queued, callback, action, token, userName, userID, fromFirstName)
 
-				go b.processSoundCloudAlbum(chatID, originalLinkURL, userIdentifier, userName, userID, fromFirstName, callback.Message.MessageID)
-			}
+	case "dlalbum":
+		session, ok := b.loadSession(callback, token, sessionKindAlbum)
+		if !ok {
 			return
+		}
+		b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		b.deleteSession(token)
+		if action != "yes" {
+			log.Printf("[%s] User cancelled album download.", userIdentifier)
+			b.api.Send(tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID))
+			return
+		}
+		var linkInfo downloader.LinkInfo
+		if err := json.Unmarshal(session.Payload, &linkInfo); err != nil {
+			log.Printf("[%s] Error decoding album session %s: %v", userIdentifier, token, err)
+			return
+		}
 
-		case "spotifyalbum":
-			if len(parts) < 4 {
-				return
-			}
-			action := parts[1]
-			if action == "no" {
-				log.Printf("[%s] User cancelled Spotify album download.", userIdentifier)
-				b.api.Send(tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID))
-				return
-			}
-			if action == "yes" {
-				linkType := parts[2]
-				linkID := spotify.ID(parts[3])
+		job, jobCtx := b.takeJob(queued, userID, chatID, jobs.KindAlbum, linkInfo.Title, session.URL)
+		editMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(b.userSettings(userID).Language, "album.started"))
+		b.api.Send(b.statusEdit(chatID, callback.Message.MessageID, editMsgText, job.ID))
 
-				editMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "✅ بسیار خب! فرآیند دانلود آلبوم اسپاتیفای آغاز شد. این کار زمان‌بر خواهد بود...")
-				editMsg := tgbotapi.NewEditMessageText(chatID, callback.Message.MessageID, editMsgText)
-				editMsg.ParseMode = tgbotapi.ModeMarkdownV2
-				editMsg.ReplyMarkup = nil
-				b.api.Send(editMsg)
+		b.runInBackground(func() {
+			b.processSoundCloudAlbum(jobCtx, job, chatID, session.URL, &linkInfo, userIdentifier, userName, userID, fromFirstName, callback.Message.MessageID)
+		})
 
-				go b.processSpotifyAlbum(chatID, linkType, linkID, userIdentifier, userName, userID, fromFirstName, callback.Message.MessageID)
-			}
+	case "spotifyalbum":
+		session, ok := b.loadSession(callback, token, sessionKindSpotifyAlbum)
+		if !ok {
+			return
+		}
+		b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		b.deleteSession(token)
+		if action != "yes" {
+			log.Printf("[%s] User cancelled Spotify album download.", userIdentifier)
+			b.api.Send(tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID))
 			return
+		}
+		var payload spotifyAlbumPayload
+		if err := json.Unmarshal(session.Payload, &payload); err != nil {
+			log.Printf("[%s] Error decoding Spotify album session %s: %v", userIdentifier, token, err)
+			return
+		}
 
-		case "dltype":
-			if len(parts) < 3 {
-				return
-			}
-			originalLinkMessageID, _ := strconv.Atoi(parts[2])
-			var originalLinkURL string
-			if callback.Message.ReplyToMessage != nil {
-				originalLinkURL = callback.Message.ReplyToMessage.Text
-			} else {
-				return
-			}
+		job, jobCtx := b.takeJob(queued, userID, chatID, jobs.KindSpotifyAlbum, "", session.URL)
+		editMsgText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(b.userSettings(userID).Language, "spotify.album_started"))
+		b.api.Send(b.statusEdit(chatID, callback.Message.MessageID, editMsgText, job.ID))
 
-			b.api.Send(tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID))
+		b.runInBackground(func() {
+			b.processSpotifyAlbum(jobCtx, job, chatID, payload.LinkType, spotify.ID(payload.LinkID), userIdentifier, userName, userID, fromFirstName, callback.Message.MessageID)
+		})
 
-			chosenTypeStr := parts[1]
-			var dlType downloader.DownloadType
-			switch chosenTypeStr {
-			case "audio":
-				dlType = downloader.AudioOnly
-			case "video":
-				dlType = downloader.VideoBest
-			case "photo":
-				dlType = downloader.ImageBest
-			default:
-				log.Printf("[%s] Unknown download type in callback: %s", userIdentifier, chosenTypeStr)
+	case "dlformats":
+		session, ok := b.loadSession(callback, token, sessionKindLink)
+		if !ok {
+			return
+		}
+		b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		lang := b.userSettings(userID).Language
+		keyboard := audioFormatKeyboard(lang, token)
+		if action == "back" {
+			track, err := linkSessionTrack(session)
+			if err != nil {
+				log.Printf("[%s] Error decoding link session %s: %v", userIdentifier, token, err)
 				return
 			}
+			keyboard, _ = choiceKeyboard(lang, track, token)
+		}
+		b.api.Send(tgbotapi.NewEditMessageReplyMarkup(chatID, callback.Message.MessageID, keyboard))
+
+	case "dlaudio":
+		preset, found := findAudioPreset(action)
+		if !found {
+			log.Printf("[%s] Unknown audio preset in callback: %s", userIdentifier, action)
+			b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+			return
+		}
+		session, ok := b.loadSession(callback, token, sessionKindLink)
+		if !ok {
+			return
+		}
+		b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		b.deleteSession(token)
+		track, err := linkSessionTrack(session)
+		if err != nil {
+			log.Printf("[%s] Error decoding link session %s: %v", userIdentifier, token, err)
+			return
+		}
 
-			linkInfo, err := b.downloader.GetLinkInfo(originalLinkURL, userIdentifier)
-			if err != nil || len(linkInfo.Tracks) == 0 {
-				log.Printf("[%s] Error re-fetching link info for URL %s: %v", userIdentifier, originalLinkURL, err)
+		b.api.Send(tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID))
+
+		spec := mediaSpec(b.userSettings(userID), downloader.AudioOnly)
+		spec.AudioFormat = preset.Format
+		spec.AudioQuality = preset.Quality
+		job, jobCtx := b.takeJob(queued, userID, chatID, jobs.KindSingle, track.Title, session.URL)
+		b.processDownloadRequest(jobCtx, job, chatID, session.MessageID, trackDownloadURL(track, session.URL), spec, track, userName, userID, fromFirstName)
+
+	case "dltype":
+		var dlType downloader.DownloadType
+		switch action {
+		case "audio":
+			dlType = downloader.AudioOnly
+		case "video":
+			dlType = downloader.VideoBest
+		case "photo":
+			dlType = downloader.ImageBest
+		default:
+			log.Printf("[%s] Unknown download type in callback: %s", userIdentifier, action)
+			b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+			return
+		}
+		session, ok := b.loadSession(callback, token, sessionKindLink)
+		if !ok {
+			return
+		}
+		b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		track, err := linkSessionTrack(session)
+		if err != nil {
+			log.Printf("[%s] Error decoding link session %s: %v", userIdentifier, token, err)
+			b.deleteSession(token)
+			return
+		}
+		if dlType == downloader.VideoBest {
+			if resolutions := track.Resolutions(); len(resolutions) > 1 {
+				keyboard := resolutionKeyboard(b.userSettings(userID).Language, resolutions, token)
+				b.api.Send(tgbotapi.NewEditMessageReplyMarkup(chatID, callback.Message.MessageID, keyboard))
 				return
 			}
+		}
+		b.deleteSession(token)
 
-			downloadURL := linkInfo.Tracks[0].URL
-			if linkInfo.Tracks[0].OriginalURL != "" {
-				downloadURL = linkInfo.Tracks[0].OriginalURL
-			}
-			if downloadURL == "" {
-				downloadURL = originalLinkURL
-			}
+		b.api.Send(tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID))
+
+		job, jobCtx := b.takeJob(queued, userID, chatID, jobs.KindSingle, track.Title, session.URL)
+		b.processDownloadRequest(jobCtx, job, chatID, session.MessageID, trackDownloadURL(track, session.URL), mediaSpec(b.userSettings(userID), dlType), track, userName, userID, fromFirstName)
 
-			b.processDownloadRequest(chatID, originalLinkMessageID, downloadURL, dlType, linkInfo.Tracks[0], userName, userID, fromFirstName)
+	case "dlres":
+		height, err := strconv.Atoi(action)
+		if err != nil {
+			log.Printf("[%s] Invalid resolution in callback: %s", userIdentifier, action)
+			b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+			return
+		}
+		session, ok := b.loadSession(callback, token, sessionKindLink)
+		if !ok {
+			return
+		}
+		b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		track, err := linkSessionTrack(session)
+		if err != nil {
+			log.Printf("[%s] Error decoding link session %s: %v", userIdentifier, token, err)
+			b.deleteSession(token)
 			return
 		}
+		var chosen *downloader.Resolution
+		for _, res := range track.Resolutions() {
+			if res.Height == height {
+				chosen = &res
+				break
+			}
+		}
+		if chosen == nil {
+			log.Printf("[%s] Resolution %dp is not offered for session %s.", userIdentifier, height, token)
+			return
+		}
+		b.deleteSession(token)
+
+		b.api.Send(tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID))
+
+		spec := mediaSpec(b.userSettings(userID), downloader.VideoBest)
+		spec.MaxHeight = chosen.Height
+		spec.FormatSelector = chosen.FormatSelector()
+		job, jobCtx := b.takeJob(queued, userID, chatID, jobs.KindSingle, track.Title, session.URL)
+		b.processDownloadRequest(jobCtx, job, chatID, session.MessageID, trackDownloadURL(track, session.URL), spec, track, userName, userID, fromFirstName)
+
+	default:
+		b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
 	}
 }
 
+func trackDownloadURL(track *downloader.TrackInfo, fallbackURL string) string {
+	if track.OriginalURL != "" {
+		return track.OriginalURL
+	}
+	if track.URL != "" {
+		return track.URL
+	}
+	return fallbackURL
+}
+
 type downloadedFile struct {
 	FilePath  string
+	FileID    string
+	CacheKey  string
+	Source    string
 	TrackInfo *downloader.TrackInfo
 }
 
-func (b *Bot) processSoundCloudAlbum(chatID int64, urlToDownload string, userIdentifier string, userName string, userID int64, fromFirstName string, statusMessageID int) {
+func (b *Bot) processSoundCloudAlbum(ctx context.Context, job *jobs.Job, chatID int64, urlToDownload string, albumInfo *downloader.LinkInfo, userIdentifier string, userName string, userID int64, fromFirstName string, statusMessageID int) {
+	lang := b.userSettings(userID).Language
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("[%s] RECOVERED from panic in processSoundCloudAlbum: %v\n%s", userIdentifier, r, string(debug.Stack()))
-			errorText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "❌ یک خطای داخلی بسیار جدی در حین دانلود آلبوم رخ داد و فرآیند متوقف شد.")
-			b.api.Send(tgbotapi.NewEditMessageText(chatID, statusMessageID, errorText))
+			errorText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "album.panic"))
+			b.api.Send(b.statusEdit(chatID, statusMessageID, errorText, ""))
+			b.jobs.Finish(job.ID, fmt.Errorf("panic: %v", r))
 		}
 	}()
 
-	log.Printf("[%s] Starting SoundCloud album download process for URL: %s", userIdentifier, urlToDownload)
-	initialLinkInfo, err := b.downloader.GetLinkInfo(urlToDownload, userIdentifier)
-	if err != nil || initialLinkInfo.Type != "album" || len(initialLinkInfo.Tracks) == 0 {
-		log.Printf("[%s] Failed to get album info for batch download: %v", userIdentifier, err)
-		errorText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "خطایی در دریافت مجدد اطلاعات آلبوم رخ داد\\. لطفاً دوباره تلاش کنید\\.")
-		b.api.Send(tgbotapi.NewEditMessageText(chatID, statusMessageID, errorText))
+	log.Printf("[%s] Starting SoundCloud album download process for URL: %s (job %s)", userIdentifier, urlToDownload, job.ID)
+	b.saveResumeData(job.ID, resumeData{StatusMessageID: statusMessageID, URL: urlToDownload, UserName: userName, FirstName: fromFirstName, Album: albumInfo})
+	if !b.janitor.HasFreeSpace() {
+		log.Printf("[%s] Refusing album download because the disk is almost full.", userIdentifier)
+		b.api.Send(b.statusEdit(chatID, statusMessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "error.low_disk")), ""))
+		b.jobs.Finish(job.ID, errLowDisk)
+		return
+	}
+	if albumInfo.Type != "album" || len(albumInfo.Tracks) == 0 {
+		log.Printf("[%s] Album info for batch download is empty.", userIdentifier)
+		errorText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "album.info_error"))
+		b.api.Send(b.statusEdit(chatID, statusMessageID, errorText, ""))
+		b.jobs.Finish(job.ID, errors.New("album info is empty"))
 		return
 	}
+	b.jobs.SetState(job.ID, jobs.StateDownloading)
 
-	totalTracks := len(initialLinkInfo.Tracks)
+	totalTracks := len(albumInfo.Tracks)
+	spec := mediaSpec(b.userSettings(userID), downloader.AudioOnly)
 
 	var downloadedFiles []downloadedFile
+	defer func() {
+		b.removeDownloadedFiles(downloadedFiles)
+	}()
 
-	for i, shallowTrack := range initialLinkInfo.Tracks {
-		progressText := fmt.Sprintf("در حال دریافت اطلاعات آهنگ %d از %d...", i+1, totalTracks)
-		editMsg := tgbotapi.NewEditMessageText(chatID, statusMessageID, progressText)
-		editMsg.ParseMode = tgbotapi.ModeMarkdownV2
-		b.api.Send(editMsg)
+	for i, shallowTrack := range albumInfo.Tracks {
+		if ctx.Err() != nil {
+			break
+		}
+		progressText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, fmt.Sprintf(tr(lang, "album.fetching_track"), i+1, totalTracks))
+		b.api.Send(b.statusEdit(chatID, statusMessageID, progressText, job.ID))
 
 		trackURL := shallowTrack.URL
 		if shallowTrack.OriginalURL != "" {
@@ -614,93 +1038,108 @@ func (b *Bot) processSoundCloudAlbum(chatID int64, urlToDownload string, userIde
 			continue
 		}
 
-		detailedLinkInfo, err := b.downloader.GetLinkInfo(trackURL, userIdentifier)
+		detailedLinkInfo, err := b.downloader.GetLinkInfo(ctx, trackURL, userIdentifier)
 		if err != nil || len(detailedLinkInfo.Tracks) == 0 {
 			log.Printf("[%s] Failed to fetch detailed info for track (%s): %v. Skipping.", userIdentifier, trackURL, err)
 			continue
 		}
 
 		track := detailedLinkInfo.Tracks[0]
+		source := cacheSource(track, trackURL)
+		cacheKey := cache.Key(source, downloadTypeKey(downloader.AudioOnly), spec.Key())
+		if entry, ok := b.cachedFileID(cacheKey); ok {
+			log.Printf("[%s] Cache hit for album track %s.", userIdentifier, track.Title)
+			downloadedFiles = append(downloadedFiles, downloadedFile{FileID: entry.FileID, CacheKey: cacheKey, Source: source, TrackInfo: track})
+			continue
+		}
 
 		escapedTrackTitle := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, track.Title)
-		progressText = fmt.Sprintf("در حال دانلود آهنگ %d از %d\n*%s*", i+1, totalTracks, escapedTrackTitle)
-		editMsg = tgbotapi.NewEditMessageText(chatID, statusMessageID, progressText)
-		editMsg.ParseMode = tgbotapi.ModeMarkdownV2
-		b.api.Send(editMsg)
+		progressText = fmt.Sprintf(tr(lang, "album.downloading_track"), i+1, totalTracks, escapedTrackTitle)
+		b.api.Send(b.statusEdit(chatID, statusMessageID, progressText, job.ID))
 
-		downloadedFilePath, _, err := b.downloader.DownloadMedia(trackURL, userIdentifier, downloader.AudioOnly, track)
+		reporter := b.newProgressReporter(chatID, statusMessageID, job.ID, lang, progressText)
+		downloadedFilePath, _, err := b.downloader.DownloadMedia(ctx, trackURL, userIdentifier, spec, track, reporter.callback())
+		reporter.stop()
 		if err != nil {
 			log.Printf("[%s] Failed to download track %s: %v", userIdentifier, track.Title, err)
 			continue
 		}
 
-		downloadedFiles = append(downloadedFiles, downloadedFile{FilePath: downloadedFilePath, TrackInfo: track})
+		if !b.fitsUploadLimit(downloadedFilePath, mediaAudio) {
+			log.Printf("[%s] Track %s is above the upload limit. Skipping.", userIdentifier, track.Title)
+			b.downloader.RemoveDownload(downloadedFilePath)
+			continue
+		}
+
+		downloadedFiles = append(downloadedFiles, downloadedFile{FilePath: downloadedFilePath, CacheKey: cacheKey, Source: source, TrackInfo: track})
 	}
 
+	if ctx.Err() != nil {
+		log.Printf("[%s] Album job %s was cancelled. Removing %d downloaded files.", userIdentifier, job.ID, len(downloadedFiles))
+		if !jobs.Interrupted(ctx) {
+			b.api.Send(b.statusEdit(chatID, statusMessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "album.cancelled")), ""))
+		}
+		b.jobs.Finish(job.ID, ctx.Err())
+		return
+	}
 	if len(downloadedFiles) < totalTracks {
 		log.Printf("[%s] Some tracks failed to download for album: %s. Downloaded %d of %d.", userIdentifier, urlToDownload, len(downloadedFiles), totalTracks)
 	}
 	if len(downloadedFiles) == 0 {
 		log.Printf("[%s] All tracks failed to download for album: %s", userIdentifier, urlToDownload)
-		errorText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "متاسفانه دانلود هیچ یک از آهنگ‌های آلبوم موفقیت‌آمیز نبود.")
-		b.api.Send(tgbotapi.NewEditMessageText(chatID, statusMessageID, errorText))
+		errorText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "album.all_failed"))
+		b.api.Send(b.statusEdit(chatID, statusMessageID, errorText, ""))
+		b.jobs.Finish(job.ID, errors.New("all album tracks failed to download"))
 		return
 	}
 
 	b.api.Send(tgbotapi.NewDeleteMessage(chatID, statusMessageID))
 	log.Printf("[%s] All %d tracks downloaded. Now sending as media group(s).", userIdentifier, len(downloadedFiles))
+	b.jobs.SetState(job.ID, jobs.StateUploading)
 
-	chunkSize := 10
-	for i := 0; i < len(downloadedFiles); i += chunkSize {
-		end := i + chunkSize
-		if end > len(downloadedFiles) {
-			end = len(downloadedFiles)
-		}
-		chunk := downloadedFiles[i:end]
+	b.sendAudioMediaGroups(chatID, downloadedFiles, userIdentifier)
 
-		mediaGroup := []interface{}{}
-		for _, file := range chunk {
-			audioFile := tgbotapi.NewInputMediaAudio(tgbotapi.FilePath(file.FilePath))
-			audioFile.Title = file.TrackInfo.Title
-			audioFile.Performer = file.TrackInfo.Artist
-			mediaGroup = append(mediaGroup, audioFile)
-		}
-
-		if _, err := b.api.SendMediaGroup(tgbotapi.NewMediaGroup(chatID, mediaGroup)); err != nil {
-			log.Printf("[%s] Error sending media group chunk %d: %v", userIdentifier, i/chunkSize+1, err)
-		}
-	}
-
-	for _, file := range downloadedFiles {
-		os.Remove(file.FilePath)
-	}
+	b.jobs.Finish(job.ID, nil)
 	log.Printf("[%s] Album download and send process finished for: %s", userIdentifier, urlToDownload)
 }
 
-func (b *Bot) processSpotifyAlbum(chatID int64, linkType string, linkID spotify.ID, userIdentifier string, userName string, userID int64, fromFirstName string, statusMessageID int) {
+func (b *Bot) processSpotifyAlbum(ctx context.Context, job *jobs.Job, chatID int64, linkType string, linkID spotify.ID, userIdentifier string, userName string, userID int64, fromFirstName string, statusMessageID int) {
+	lang := b.userSettings(userID).Language
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("[%s] RECOVERED from panic in processSpotifyAlbum: %v\n%s", userIdentifier, r, string(debug.Stack()))
-			errorText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "❌ یک خطای داخلی بسیار جدی در حین دانلود آلبوم اسپاتیفای رخ داد و فرآیند متوقف شد.")
-			b.api.Send(tgbotapi.NewEditMessageText(chatID, statusMessageID, errorText))
+			errorText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "spotify.album_panic"))
+			b.api.Send(b.statusEdit(chatID, statusMessageID, errorText, ""))
+			b.jobs.Finish(job.ID, fmt.Errorf("panic: %v", r))
 		}
 	}()
 
+	b.saveResumeData(job.ID, resumeData{StatusMessageID: statusMessageID, URL: job.URL, UserName: userName, FirstName: fromFirstName, Spotify: &spotifyAlbumPayload{LinkType: linkType, LinkID: string(linkID)}})
+	if !b.janitor.HasFreeSpace() {
+		log.Printf("[%s] Refusing Spotify album download because the disk is almost full.", userIdentifier)
+		b.api.Send(b.statusEdit(chatID, statusMessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "error.low_disk")), ""))
+		b.jobs.Finish(job.ID, errLowDisk)
+		return
+	}
+
 	var spotifyTracks []spotify.SimpleTrack
 	var collectionName string
 
+	b.jobs.SetState(job.ID, jobs.StateFetching)
 	if linkType == "album" {
-		album, err := b.spotify.GetAlbum(context.Background(), linkID)
+		album, err := b.spotify.GetAlbum(ctx, linkID)
 		if err != nil {
 			log.Printf("[%s] Failed to re-fetch Spotify album info: %v", userIdentifier, err)
+			b.jobs.Finish(job.ID, err)
 			return
 		}
 		spotifyTracks = album.Tracks.Tracks
 		collectionName = album.Name
 	} else if linkType == "playlist" {
-		playlist, err := b.spotify.GetPlaylist(context.Background(), linkID)
+		playlist, err := b.spotify.GetPlaylist(ctx, linkID)
 		if err != nil {
 			log.Printf("[%s] Failed to re-fetch Spotify playlist info: %v", userIdentifier, err)
+			b.jobs.Finish(job.ID, err)
 			return
 		}
 		for _, item := range playlist.Tracks.Tracks {
@@ -713,20 +1152,28 @@ func (b *Bot) processSpotifyAlbum(chatID int64, linkType string, linkID spotify.
 
 	if len(spotifyTracks) == 0 {
 		log.Printf("[%s] No tracks found in Spotify album/playlist %s", userIdentifier, linkID)
+		b.jobs.Finish(job.ID, errors.New("no tracks found in spotify collection"))
 		return
 	}
 
 	totalTracks := len(spotifyTracks)
-	log.Printf("[%s] Starting Spotify album download. Album: %s, Tracks: %d", userIdentifier, collectionName, totalTracks)
+	spec := mediaSpec(b.userSettings(userID), downloader.AudioOnly)
+	log.Printf("[%s] Starting Spotify album download. Album: %s, Tracks: %d (job %s)", userIdentifier, collectionName, totalTracks, job.ID)
+	b.jobs.SetTitle(job.ID, collectionName)
+	b.jobs.SetState(job.ID, jobs.StateDownloading)
 
 	var downloadedFiles []downloadedFile
+	defer func() {
+		b.removeDownloadedFiles(downloadedFiles)
+	}()
 
 	for i, sTrack := range spotifyTracks {
+		if ctx.Err() != nil {
+			break
+		}
 
-		progressText := fmt.Sprintf("در حال جستجوی آهنگ %d از %d:\n*%s*", i+1, totalTracks, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, sTrack.Name))
-		editMsg := tgbotapi.NewEditMessageText(chatID, statusMessageID, progressText)
-		editMsg.ParseMode = tgbotapi.ModeMarkdownV2
-		b.api.Send(editMsg)
+		progressText := fmt.Sprintf(tr(lang, "spotify.searching_track"), i+1, totalTracks, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, sTrack.Name))
+		b.api.Send(b.statusEdit(chatID, statusMessageID, progressText, job.ID))
 
 		var artists []string
 		for _, artist := range sTrack.Artists {
@@ -735,52 +1182,100 @@ func (b *Bot) processSpotifyAlbum(chatID int64, linkType string, linkID spotify.
 		artistStr := strings.Join(artists, ", ")
 		searchQuery := fmt.Sprintf("%s - %s", artistStr, sTrack.Name)
 
+		trackInfo := &downloader.TrackInfo{
+			Title:       sTrack.Name,
+			Artist:      artistStr,
+			OriginalURL: string(sTrack.ExternalURLs["spotify"]),
+		}
+		source := cacheSource(trackInfo, "spotify:"+string(sTrack.ID))
+		cacheKey := cache.Key(source, downloadTypeKey(downloader.AudioOnly), spec.Key())
+		if entry, ok := b.cachedFileID(cacheKey); ok {
+			log.Printf("[%s] Cache hit for Spotify track %s.", userIdentifier, searchQuery)
+			downloadedFiles = append(downloadedFiles, downloadedFile{FileID: entry.FileID, CacheKey: cacheKey, Source: source, TrackInfo: trackInfo})
+			continue
+		}
+
 		log.Printf("[%s] Searching for track %d: %s", userIdentifier, i+1, searchQuery)
 
-		foundURL, err := b.downloader.FindYouTubeURL(searchQuery, userIdentifier)
+		foundURL, err := b.downloader.FindURL(ctx, downloader.SearchYouTube, searchQuery, userIdentifier)
+		foundOnYouTube := err == nil
 		if err != nil {
 			log.Printf("[%s] Could not find on YouTube, trying SoundCloud... Query: '%s'", userIdentifier, searchQuery)
-			foundURL, err = b.downloader.FindSoundCloudURL(searchQuery, userIdentifier)
+			foundURL, err = b.downloader.FindURL(ctx, downloader.SearchSoundCloud, searchQuery, userIdentifier)
 			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
 				log.Printf("[%s] Could not find '%s' on any platform. Skipping.", userIdentifier, searchQuery)
-				b.api.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("⚠️ آهنگ '%s' پیدا نشد و از لیست دانلود حذف شد.", sTrack.Name)))
+				b.api.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf(tr(lang, "spotify.track_skipped"), sTrack.Name)))
 				continue
 			}
 		}
 
 		escapedTrackTitle := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, sTrack.Name)
-		progressText = fmt.Sprintf("در حال دانلود آهنگ %d از %d\n*%s*", i+1, totalTracks, escapedTrackTitle)
-		editMsg = tgbotapi.NewEditMessageText(chatID, statusMessageID, progressText)
-		editMsg.ParseMode = tgbotapi.ModeMarkdownV2
-		b.api.Send(editMsg)
-
-		trackInfo := &downloader.TrackInfo{
-			Title:       sTrack.Name,
-			Artist:      artistStr,
-			OriginalURL: string(sTrack.ExternalURLs["spotify"]),
+		progressText = fmt.Sprintf(tr(lang, "album.downloading_track"), i+1, totalTracks, escapedTrackTitle)
+		b.api.Send(b.statusEdit(chatID, statusMessageID, progressText, job.ID))
+
+		reporter := b.newProgressReporter(chatID, statusMessageID, job.ID, lang, progressText)
+		downloadedFilePath, _, err := b.downloader.DownloadMedia(ctx, foundURL, userIdentifier, spec, trackInfo, reporter.callback())
+		if err != nil && foundOnYouTube && ctx.Err() == nil {
+			// The same track is often still downloadable from SoundCloud when
+			// YouTube refuses it.
+			log.Printf("[%s] Failed to download track %s from YouTube URL %s: %v. Trying SoundCloud...", userIdentifier, trackInfo.Title, foundURL, err)
+			if soundCloudURL, findErr := b.downloader.FindURL(ctx, downloader.SearchSoundCloud, searchQuery, userIdentifier); findErr == nil {
+				foundURL = soundCloudURL
+				downloadedFilePath, _, err = b.downloader.DownloadMedia(ctx, foundURL, userIdentifier, spec, trackInfo, reporter.callback())
+			}
 		}
-
-		downloadedFilePath, _, err := b.downloader.DownloadMedia(foundURL, userIdentifier, downloader.AudioOnly, trackInfo)
+		reporter.stop()
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			log.Printf("[%s] Failed to download track %s from found URL %s: %v", userIdentifier, trackInfo.Title, foundURL, err)
-			b.api.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ دانلود آهنگ '%s' با خطا مواجه شد.", trackInfo.Title)))
+			b.api.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf(tr(lang, "spotify.track_failed"), trackInfo.Title)))
 			continue
 		}
 
-		downloadedFiles = append(downloadedFiles, downloadedFile{FilePath: downloadedFilePath, TrackInfo: trackInfo})
+		if !b.fitsUploadLimit(downloadedFilePath, mediaAudio) {
+			log.Printf("[%s] Track %s is above the upload limit. Skipping.", userIdentifier, trackInfo.Title)
+			b.downloader.RemoveDownload(downloadedFilePath)
+			continue
+		}
+
+		downloadedFiles = append(downloadedFiles, downloadedFile{FilePath: downloadedFilePath, CacheKey: cacheKey, Source: source, TrackInfo: trackInfo})
 	}
 
+	if ctx.Err() != nil {
+		log.Printf("[%s] Spotify album job %s was cancelled. Removing %d downloaded files.", userIdentifier, job.ID, len(downloadedFiles))
+		if !jobs.Interrupted(ctx) {
+			b.api.Send(b.statusEdit(chatID, statusMessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "spotify.album_cancelled")), ""))
+		}
+		b.jobs.Finish(job.ID, ctx.Err())
+		return
+	}
 	if len(downloadedFiles) == 0 {
-		errorText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "متاسفانه دانلود هیچ یک از آهنگ‌های آلبوم اسپاتیفای موفقیت‌آمیز نبود.")
-		b.api.Send(tgbotapi.NewEditMessageText(chatID, statusMessageID, errorText))
+		errorText := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "spotify.album_all_failed"))
+		b.api.Send(b.statusEdit(chatID, statusMessageID, errorText, ""))
+		b.jobs.Finish(job.ID, errors.New("all spotify tracks failed to download"))
 		return
 	}
 
-	finalProgressText := fmt.Sprintf("✅ تعداد %d از %d آهنگ با موفقیت دانلود شد. در حال ارسال...", len(downloadedFiles), totalTracks)
-	b.api.Send(tgbotapi.NewEditMessageText(chatID, statusMessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, finalProgressText)))
+	finalProgressText := fmt.Sprintf(tr(lang, "spotify.album_done"), len(downloadedFiles), totalTracks)
+	b.api.Send(b.statusEdit(chatID, statusMessageID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, finalProgressText), ""))
 
 	log.Printf("[%s] All %d Spotify tracks downloaded. Now sending as media group(s).", userIdentifier, len(downloadedFiles))
+	b.jobs.SetState(job.ID, jobs.StateUploading)
+
+	b.sendAudioMediaGroups(chatID, downloadedFiles, userIdentifier)
+
+	b.api.Send(tgbotapi.NewDeleteMessage(chatID, statusMessageID))
+
+	b.jobs.Finish(job.ID, nil)
+	log.Printf("[%s] Spotify album download and send process finished for album: %s", userIdentifier, collectionName)
+}
 
+func (b *Bot) sendAudioMediaGroups(chatID int64, downloadedFiles []downloadedFile, userIdentifier string) {
 	chunkSize := 10
 	for i := 0; i < len(downloadedFiles); i += chunkSize {
 		end := i + chunkSize
@@ -791,63 +1286,118 @@ func (b *Bot) processSpotifyAlbum(chatID int64, linkType string, linkID spotify.
 
 		mediaGroup := []interface{}{}
 		for _, file := range chunk {
-			audioFile := tgbotapi.NewInputMediaAudio(tgbotapi.FilePath(file.FilePath))
+			fileData := b.uploadFile(file.FilePath, file.TrackInfo)
+			if file.FileID != "" {
+				fileData = tgbotapi.FileID(file.FileID)
+			}
+			audioFile := tgbotapi.NewInputMediaAudio(fileData)
 			audioFile.Title = file.TrackInfo.Title
 			audioFile.Performer = file.TrackInfo.Artist
 			mediaGroup = append(mediaGroup, audioFile)
 		}
 
-		if _, err := b.api.SendMediaGroup(tgbotapi.NewMediaGroup(chatID, mediaGroup)); err != nil {
-			log.Printf("[%s] Error sending spotify media group chunk %d: %v", userIdentifier, i/chunkSize+1, err)
+		sentMessages, err := b.api.SendMediaGroup(tgbotapi.NewMediaGroup(chatID, mediaGroup))
+		if err != nil {
+			log.Printf("[%s] Error sending media group chunk %d: %v", userIdentifier, i/chunkSize+1, err)
+			continue
+		}
+		for idx, file := range chunk {
+			if file.FileID == "" && idx < len(sentMessages) {
+				b.rememberFileID(file.CacheKey, file.Source, mediaAudio, sentMessages[idx], file.TrackInfo)
+			}
 		}
 	}
+}
 
-	b.api.Send(tgbotapi.NewDeleteMessage(chatID, statusMessageID))
-
+func (b *Bot) removeDownloadedFiles(downloadedFiles []downloadedFile) {
 	for _, file := range downloadedFiles {
-		os.Remove(file.FilePath)
+		if file.FilePath != "" {
+			b.downloader.RemoveDownload(file.FilePath)
+		}
 	}
-	log.Printf("[%s] Spotify album download and send process finished for album: %s", userIdentifier, collectionName)
 }
 
-func (b *Bot) processDownloadRequest(chatID int64, originalLinkMessageID int, urlToDownload string, dlType downloader.DownloadType, trackInfo *downloader.TrackInfo, userName string, userID int64, fromFirstName string) {
+func (b *Bot) processDownloadRequest(ctx context.Context, job *jobs.Job, chatID int64, originalLinkMessageID int, urlToDownload string, spec downloader.MediaSpec, trackInfo *downloader.TrackInfo, userName string, userID int64, fromFirstName string) {
 	userIdentifier := userName + "_" + strconv.FormatInt(userID, 10)
 	escapedArtist := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, trackInfo.Artist)
 	escapedTitle := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, trackInfo.Title)
-	escapedFileType := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, typeToString(dlType))
+	settings := b.userSettings(userID)
+	escapedFileType := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, typeToString(settings.Language, spec.Type))
+
+	b.saveResumeData(job.ID, resumeData{ReplyTo: originalLinkMessageID, URL: urlToDownload, UserName: userName, FirstName: fromFirstName, Spec: &spec, Track: trackInfo})
+
+	source := cacheSource(trackInfo, urlToDownload)
+	cacheKey := cache.Key(source, downloadTypeKey(spec.Type), spec.Key())
+	if b.sendCachedMedia(chatID, originalLinkMessageID, cacheKey, trackInfo, settings.Caption, userIdentifier) {
+		b.jobs.Finish(job.ID, nil)
+		b.audit(userID, "download_cached", job.ID+" "+urlToDownload)
+		return
+	}
+
+	if estimate := trackInfo.EstimateSize(spec); estimate > 0 && estimate > b.uploadLimit(mediaKindFor(spec.Type, "")) {
+		log.Printf("[%s] Estimated size %d for %s is above the upload limit.", userIdentifier, estimate, urlToDownload)
+		if spec.Type == downloader.VideoBest && b.hasOversizeStrategy("lower") {
+			if fitting := fittingResolutions(trackInfo, b.uploadLimit(mediaVideo)); len(fitting) > 0 && b.offerLowerResolutions(chatID, originalLinkMessageID, userID, urlToDownload, trackInfo, fitting, estimate, userIdentifier) {
+				b.jobs.Finish(job.ID, errTooLarge)
+				return
+			}
+		}
+	}
+
+	if !b.ensureDiskSpace(chatID, originalLinkMessageID, settings.Language, userIdentifier) {
+		b.jobs.Finish(job.ID, errLowDisk)
+		return
+	}
 
 	var sentMsg tgbotapi.Message
 	var err error
+	downloadingMsgText := ""
 
-	if !(dlType == downloader.AudioOnly && originalLinkMessageID == 0) {
-		downloadingMsgText := ""
+	if !(spec.Type == downloader.AudioOnly && originalLinkMessageID == 0) {
 		if trackInfo.Title != "Unknown Title" && trackInfo.Artist != "Unknown Artist" {
-			downloadingMsgText = fmt.Sprintf("در حال آماده‌سازی و دانلود *%s* برای:\n`%s \\- %s`\n\nاین فرآیند ممکن است کمی طول بکشد، لطفاً صبور باشید\\.\\.\\. ⏳", escapedFileType, escapedArtist, escapedTitle)
+			downloadingMsgText = fmt.Sprintf(tr(settings.Language, "download.preparing_info"), escapedFileType, escapedArtist, escapedTitle)
 		} else {
-			downloadingMsgText = fmt.Sprintf("در حال آماده‌سازی و دانلود *%s* شما\\.\\.\\. ⏳", escapedFileType)
+			downloadingMsgText = fmt.Sprintf(tr(settings.Language, "download.preparing"), escapedFileType)
 		}
 		dlNoticeMsg := tgbotapi.NewMessage(chatID, downloadingMsgText)
 		dlNoticeMsg.ParseMode = tgbotapi.ModeMarkdownV2
 		if originalLinkMessageID != 0 {
 			dlNoticeMsg.ReplyToMessageID = originalLinkMessageID
 		}
+		dlNoticeMsg.ReplyMarkup = cancelKeyboard(settings.Language, job.ID)
 		sentMsg, err = b.api.Send(dlNoticeMsg)
 		if err != nil {
 			log.Printf("[%s] Error sending 'downloading media' message: %v", userIdentifier, err)
 		}
 	}
 
-	downloadedFilePath, actualExt, err := b.downloader.DownloadMedia(urlToDownload, userIdentifier, dlType, trackInfo)
+	b.jobs.SetState(job.ID, jobs.StateDownloading)
+	reporter := b.newProgressReporter(chatID, sentMsg.MessageID, job.ID, settings.Language, downloadingMsgText)
+	downloadedFilePath, actualExt, err := b.downloader.DownloadMedia(ctx, urlToDownload, userIdentifier, spec, trackInfo, reporter.callback())
+	reporter.stop()
 	if sentMsg.MessageID != 0 {
 		b.api.Send(tgbotapi.NewDeleteMessage(chatID, sentMsg.MessageID))
 	}
 
+	if err != nil && errors.Is(err, context.Canceled) {
+		log.Printf("[%s] Download job %s for URL %s was cancelled.", userIdentifier, job.ID, urlToDownload)
+		b.jobs.Finish(job.ID, err)
+		if jobs.Interrupted(ctx) {
+			return
+		}
+		cancelMsg := tgbotapi.NewMessage(chatID, tr(settings.Language, "download.cancelled"))
+		if originalLinkMessageID != 0 {
+			cancelMsg.ReplyToMessageID = originalLinkMessageID
+		}
+		b.api.Send(cancelMsg)
+		return
+	}
 	if err != nil {
+		b.jobs.Finish(job.ID, err)
+		b.audit(userID, "download_failed", job.ID+" "+urlToDownload)
 		log.Printf("[%s] Error downloading media for URL %s: %v\n", userIdentifier, urlToDownload, err)
-		escapedError := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, err.Error())
-		errorMsgText := fmt.Sprintf("❌ متاسفانه در فرآیند دانلود برای آهنگ `%s` مشکلی پیش آمد\\.\n\nجزئیات خطا:\n`%s`", escapedTitle, escapedError)
+		errorMsgText := fmt.Sprintf(tr(settings.Language, "error.download_failed"), trackInfo.Title) + "\n\n" + downloadErrorText(settings.Language, err)
 		errMsg := tgbotapi.NewMessage(chatID, errorMsgText)
-		errMsg.ParseMode = tgbotapi.ModeMarkdownV2
 		if originalLinkMessageID != 0 {
 			errMsg.ReplyToMessageID = originalLinkMessageID
 		}
@@ -855,83 +1405,81 @@ func (b *Bot) processDownloadRequest(chatID int64, originalLinkMessageID int, ur
 		return
 	}
 
-	log.Printf("[%s] Media downloaded: %s (ext: %s). Sending to user.\n", userIdentifier, downloadedFilePath, actualExt)
+	// Re-encoded files and parts are written next to the download, so this
+	// removes them as well.
+	defer b.downloader.RemoveDownload(downloadedFilePath)
 
-	escapedBotUsernameMention := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "@"+b.api.Self.UserName)
+	log.Printf("[%s] Media downloaded: %s (ext: %s). Sending to user.\n", userIdentifier, downloadedFilePath, actualExt)
+	b.jobs.SetState(job.ID, jobs.StateUploading)
 
-	if dlType == downloader.AudioOnly || actualExt == "mp3" {
-		caption := fmt.Sprintf("🎵 *%s*\n👤 _%s_\n\n%s", escapedTitle, escapedArtist, escapedBotUsernameMention)
-		audioFile := tgbotapi.NewAudio(chatID, tgbotapi.FilePath(downloadedFilePath))
-		if originalLinkMessageID != 0 {
-			audioFile.ReplyToMessageID = originalLinkMessageID
-		}
-		audioFile.Title = trackInfo.Title
-		audioFile.Performer = trackInfo.Artist
-		audioFile.Caption = caption
-		audioFile.ParseMode = tgbotapi.ModeMarkdownV2
-		_, sendErr := b.api.Send(audioFile)
-		if sendErr != nil {
-			log.Printf("[%s] Error sending audio file %s: %v\n", userIdentifier, downloadedFilePath, sendErr)
-		} else {
-			log.Printf("[%s] Audio file %s sent successfully.\n", userIdentifier, downloadedFilePath)
+	kind := mediaKindFor(spec.Type, actualExt)
+	if kind == mediaDocument {
+		log.Printf("[%s] Unknown/unhandled extension '%s', sending as document.\n", userIdentifier, actualExt)
+	}
+	plan, planErr := b.planUpload(ctx, downloadedFilePath, kind, trackInfo, settings.Language, userIdentifier)
+	if planErr != nil {
+		b.jobs.Finish(job.ID, planErr)
+		b.audit(userID, "download_failed", job.ID+" "+urlToDownload)
+		log.Printf("[%s] Could not prepare %s for upload: %v\n", userIdentifier, downloadedFilePath, planErr)
+		errText := tr(settings.Language, "upload.failed")
+		if errors.Is(planErr, errTooLarge) {
+			errText = fmt.Sprintf(tr(settings.Language, "upload.too_large"), formatBytes(b.uploadLimit(kind)))
 		}
-	} else if dlType == downloader.VideoBest || actualExt == "mp4" || actualExt == "mkv" || actualExt == "webm" {
-		caption := fmt.Sprintf("🎬 *%s*\n👤 _%s_\n\n%s", escapedTitle, escapedArtist, escapedBotUsernameMention)
-		videoFile := tgbotapi.NewVideo(chatID, tgbotapi.FilePath(downloadedFilePath))
+		errMsg := tgbotapi.NewMessage(chatID, errText)
 		if originalLinkMessageID != 0 {
-			videoFile.ReplyToMessageID = originalLinkMessageID
+			errMsg.ReplyToMessageID = originalLinkMessageID
 		}
-		videoFile.Caption = caption
-		videoFile.ParseMode = tgbotapi.ModeMarkdownV2
-		_, sendErr := b.api.Send(videoFile)
-		if sendErr != nil {
-			log.Printf("[%s] Error sending video file %s: %v\n", userIdentifier, downloadedFilePath, sendErr)
+		b.api.Send(errMsg)
+		return
+	}
+	if len(plan.OfferLower) > 0 {
+		if b.offerLowerResolutions(chatID, originalLinkMessageID, userID, urlToDownload, trackInfo, plan.OfferLower, plan.Size, userIdentifier) {
+			b.jobs.Finish(job.ID, errTooLarge)
 		} else {
-			log.Printf("[%s] Video file %s sent successfully.\n", userIdentifier, downloadedFilePath)
+			b.jobs.Finish(job.ID, errors.New("could not offer lower resolutions"))
 		}
-	} else if dlType == downloader.ImageBest || actualExt == "jpg" || actualExt == "jpeg" || actualExt == "webp" || actualExt == "png" {
-		caption := fmt.Sprintf("🖼️ *%s*\n👤 _%s_\n\n%s", escapedTitle, escapedArtist, escapedBotUsernameMention)
-		photoFile := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(downloadedFilePath))
+		return
+	}
+	if plan.Notice != "" {
+		notice := tgbotapi.NewMessage(chatID, plan.Notice)
 		if originalLinkMessageID != 0 {
-			photoFile.ReplyToMessageID = originalLinkMessageID
-		}
-		photoFile.Caption = caption
-		photoFile.ParseMode = tgbotapi.ModeMarkdownV2
-		_, sendErr := b.api.Send(photoFile)
-		if sendErr != nil {
-			log.Printf("[%s] Error sending photo file %s: %v\n", userIdentifier, downloadedFilePath, sendErr)
-		} else {
-			log.Printf("[%s] Photo file %s sent successfully.\n", userIdentifier, downloadedFilePath)
+			notice.ReplyToMessageID = originalLinkMessageID
 		}
-	} else {
-		log.Printf("[%s] Unknown/unhandled extension '%s', sending as document.\n", userIdentifier, actualExt)
-		caption := fmt.Sprintf("📄 *%s*\n👤 _%s_\n\n%s", escapedTitle, escapedArtist, escapedBotUsernameMention)
-		docFile := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(downloadedFilePath))
-		if originalLinkMessageID != 0 {
-			docFile.ReplyToMessageID = originalLinkMessageID
+		b.api.Send(notice)
+	}
+
+	var sendErr error
+	for i, filePath := range plan.Files {
+		partInfo := partTrackInfo(trackInfo, i+1, len(plan.Files))
+		sentMedia, err := b.sendMediaFile(chatID, originalLinkMessageID, plan.Kind, b.uploadFile(filePath, partInfo), partInfo, settings.Caption)
+		if err != nil {
+			log.Printf("[%s] Error sending %s file %s: %v\n", userIdentifier, plan.Kind, filePath, err)
+			sendErr = err
+			continue
 		}
-		docFile.Caption = caption
-		docFile.ParseMode = tgbotapi.ModeMarkdownV2
-		_, sendErr := b.api.Send(docFile)
-		if sendErr != nil {
-			log.Printf("[%s] Error sending document file %s: %v\n", userIdentifier, downloadedFilePath, sendErr)
-		} else {
-			log.Printf("[%s] Document file %s sent successfully.\n", userIdentifier, downloadedFilePath)
+		log.Printf("[%s] %s file %s sent successfully.\n", userIdentifier, plan.Kind, filePath)
+		if plan.Cacheable {
+			b.rememberFileID(cacheKey, source, plan.Kind, sentMedia, trackInfo)
 		}
 	}
 
-	os.Remove(downloadedFilePath)
+	b.jobs.Finish(job.ID, sendErr)
+	if sendErr != nil {
+		b.audit(userID, "download_failed", job.ID+" "+urlToDownload)
+	} else {
+		b.audit(userID, "download", job.ID+" "+urlToDownload)
+	}
 }
 
-func typeToString(dlType downloader.DownloadType) string {
+func typeToString(lang string, dlType downloader.DownloadType) string {
 	if dlType == downloader.AudioOnly {
-		return "فایل صوتی"
+		return tr(lang, "filetype.audio")
 	}
 	if dlType == downloader.VideoBest {
-		return "فایل ویدیویی"
+		return tr(lang, "filetype.video")
 	}
 	if dlType == downloader.ImageBest {
-		return "فایل عکس"
+		return tr(lang, "filetype.photo")
 	}
-	return "فایل"
+	return tr(lang, "filetype.file")
 }
@@ -0,0 +1,41 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var errLowDisk = errors.New("not enough free disk space")
+
+// ensureDiskSpace tells the user to try later and returns false when the
+// server is too low on disk space to start a download.
+func (b *Bot) ensureDiskSpace(chatID int64, replyToMessageID int, lang string, userIdentifier string) bool {
+	if b.janitor.HasFreeSpace() {
+		return true
+	}
+	log.Printf("[%s] Refusing download because free disk space is below %d bytes.", userIdentifier, b.janitor.MinFree())
+	msg := tgbotapi.NewMessage(chatID, tr(lang, "error.low_disk"))
+	if replyToMessageID != 0 {
+		msg.ReplyToMessageID = replyToMessageID
+	}
+	b.api.Send(msg)
+	return false
+}
+
+func (b *Bot) diskText(lang string) string {
+	usage, err := b.janitor.Usage()
+	if err != nil {
+		log.Printf("Error reading disk usage: %v", err)
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "admin.disk_error"))
+	}
+	text := fmt.Sprintf(tr(lang, "admin.disk"), usage.Entries, formatBytes(usage.Size), formatBytes(b.janitor.MaxSize()))
+	if usage.DiskKnown {
+		text += fmt.Sprintf(tr(lang, "admin.disk_free"), formatBytes(usage.Free), formatBytes(usage.Total), formatBytes(b.janitor.MinFree()))
+	} else {
+		text += tr(lang, "admin.disk_free_unknown")
+	}
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, text)
+}
@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type laneItem struct {
+	userID int64
+	update tgbotapi.Update
+	// job is set for updates that may start a download, so they show in
+	// /queue and can be cancelled while they wait.
+	job *queuedJob
+	// run replaces the update handler for work split off from an update,
+	// like the links of a batch.
+	run func(queued *queuedJob)
+	// resume describes run, so the item can be queued again after a restart.
+	resume *resumeData
+}
+
+type chatLane struct {
+	pending []laneItem
+	busy    bool
+}
+
+// dispatcher runs updates on a bounded pool of workers. Updates from the same
+// chat are handled one after another, different chats run in parallel, and a
+// single user never occupies more than perUser workers at once.
+type dispatcher struct {
+	handle     func(laneItem)
+	drop       func(laneItem)
+	workers    chan struct{}
+	perUser    int
+	maxPending int
+
+	mu         sync.Mutex
+	userCond   *sync.Cond
+	lanes      map[int64]*chatLane
+	userActive map[int64]int
+	waiting    int
+	closed     bool
+	// active counts submitted updates that have not been handled or dropped.
+	active sync.WaitGroup
+}
+
+func newDispatcher(poolSize, perUser, maxPending int, handle func(laneItem), drop func(laneItem)) *dispatcher {
+	d := &dispatcher{
+		handle:     handle,
+		drop:       drop,
+		workers:    make(chan struct{}, poolSize),
+		perUser:    perUser,
+		maxPending: maxPending,
+		lanes:      make(map[int64]*chatLane),
+		userActive: make(map[int64]int),
+	}
+	d.userCond = sync.NewCond(&d.mu)
+	return d
+}
+
+// submit queues the item on its chat lane. It returns the position of the
+// item in the queue (0 when it starts right away) and false when the lane is
+// already full or the dispatcher is closed.
+func (d *dispatcher) submit(chatID int64, item laneItem) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return 0, false
+	}
+	lane, exists := d.lanes[chatID]
+	if !exists {
+		lane = &chatLane{}
+		d.lanes[chatID] = lane
+	}
+	if len(lane.pending) >= d.maxPending {
+		return len(lane.pending), false
+	}
+
+	position := len(lane.pending)
+	if lane.busy {
+		position++
+	}
+	if position == 0 && len(d.workers) == cap(d.workers) {
+		position = d.waiting + 1
+	}
+
+	lane.pending = append(lane.pending, item)
+	d.active.Add(1)
+	if !exists {
+		go d.runLane(chatID, lane)
+	}
+	return position, true
+}
+
+func (d *dispatcher) runLane(chatID int64, lane *chatLane) {
+	for {
+		d.mu.Lock()
+		if len(lane.pending) == 0 {
+			delete(d.lanes, chatID)
+			d.mu.Unlock()
+			return
+		}
+		item := lane.pending[0]
+		lane.pending = lane.pending[1:]
+		lane.busy = true
+		for d.userActive[item.userID] >= d.perUser {
+			d.userCond.Wait()
+		}
+		d.userActive[item.userID]++
+		d.waiting++
+		d.mu.Unlock()
+
+		d.workers <- struct{}{}
+
+		d.mu.Lock()
+		d.waiting--
+		closed := d.closed
+		d.mu.Unlock()
+
+		if closed {
+			d.drop(item)
+		} else {
+			d.run(item)
+		}
+		d.active.Done()
+
+		<-d.workers
+		d.mu.Lock()
+		d.userActive[item.userID]--
+		if d.userActive[item.userID] <= 0 {
+			delete(d.userActive, item.userID)
+		}
+		lane.busy = false
+		d.userCond.Broadcast()
+		d.mu.Unlock()
+	}
+}
+
+// close stops the dispatcher from accepting updates and drops the ones that
+// have not started yet. Updates already running are left to finish.
+func (d *dispatcher) close() {
+	d.mu.Lock()
+	d.closed = true
+	var dropped []laneItem
+	for _, lane := range d.lanes {
+		dropped = append(dropped, lane.pending...)
+		lane.pending = nil
+	}
+	d.mu.Unlock()
+
+	for _, item := range dropped {
+		d.drop(item)
+		d.active.Done()
+	}
+}
+
+func (d *dispatcher) isClosed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closed
+}
+
+func (d *dispatcher) run(item laneItem) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("RECOVERED from panic while handling update %d for user %d: %v\n%s", item.update.UpdateID, item.userID, r, string(debug.Stack()))
+		}
+	}()
+	d.handle(item)
+}
@@ -0,0 +1,174 @@
+package bot
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// testDispatcher runs items until release is closed and reports the update ID
+// of each item as it starts.
+type testDispatcher struct {
+	*dispatcher
+	started chan int
+	release chan struct{}
+}
+
+func newTestDispatcher(t *testing.T, poolSize, perUser, maxPending int) *testDispatcher {
+	t.Helper()
+	td := &testDispatcher{started: make(chan int, 100), release: make(chan struct{})}
+	td.dispatcher = newDispatcher(poolSize, perUser, maxPending, func(item laneItem) {
+		td.started <- item.update.UpdateID
+		<-td.release
+	}, func(laneItem) {})
+	t.Cleanup(func() {
+		select {
+		case <-td.release:
+		default:
+			close(td.release)
+		}
+		td.active.Wait()
+	})
+	return td
+}
+
+func (td *testDispatcher) submitUpdate(t *testing.T, chatID, userID int64, updateID int) int {
+	t.Helper()
+	position, ok := td.submit(chatID, laneItem{userID: userID, update: tgbotapi.Update{UpdateID: updateID}})
+	if !ok {
+		t.Fatalf("update %d was rejected", updateID)
+	}
+	return position
+}
+
+func (td *testDispatcher) expectStart(t *testing.T, want int) {
+	t.Helper()
+	select {
+	case got := <-td.started:
+		if got != want {
+			t.Fatalf("update %d started, want %d", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("update %d did not start", want)
+	}
+}
+
+func (td *testDispatcher) expectNoStart(t *testing.T) {
+	t.Helper()
+	select {
+	case got := <-td.started:
+		t.Fatalf("update %d started, want it to wait", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDispatcherKeepsChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []int
+	d := newDispatcher(4, 4, 10, func(item laneItem) {
+		mu.Lock()
+		order = append(order, item.update.UpdateID)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}, func(laneItem) {})
+
+	for id := 1; id <= 5; id++ {
+		if _, ok := d.submit(1, laneItem{userID: 7, update: tgbotapi.Update{UpdateID: id}}); !ok {
+			t.Fatalf("update %d was rejected", id)
+		}
+	}
+	d.active.Wait()
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(order, want) {
+		t.Errorf("handled %v, want %v", order, want)
+	}
+}
+
+func TestDispatcherRunsChatsInParallel(t *testing.T) {
+	d := newTestDispatcher(t, 2, 1, 10)
+	d.submitUpdate(t, 1, 7, 1)
+	d.submitUpdate(t, 2, 8, 2)
+
+	got := map[int]bool{}
+	for range 2 {
+		select {
+		case id := <-d.started:
+			got[id] = true
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %v started, want both chats at once", got)
+		}
+	}
+}
+
+func TestDispatcherLimitsUser(t *testing.T) {
+	d := newTestDispatcher(t, 4, 1, 10)
+	d.submitUpdate(t, 1, 7, 1)
+	d.expectStart(t, 1)
+
+	// Another chat of the same user waits although workers are free, while
+	// another user starts right away.
+	d.submitUpdate(t, 2, 7, 2)
+	d.expectNoStart(t)
+	d.submitUpdate(t, 3, 8, 3)
+	d.expectStart(t, 3)
+
+	close(d.release)
+	d.expectStart(t, 2)
+}
+
+func TestDispatcherQueuePosition(t *testing.T) {
+	d := newTestDispatcher(t, 1, 1, 10)
+	if position := d.submitUpdate(t, 1, 7, 1); position != 0 {
+		t.Errorf("first update got position %d, want 0", position)
+	}
+	d.expectStart(t, 1)
+
+	// The lane is busy, so the next updates of the chat wait behind it.
+	if position := d.submitUpdate(t, 1, 7, 2); position != 1 {
+		t.Errorf("second update got position %d, want 1", position)
+	}
+	if position := d.submitUpdate(t, 1, 7, 3); position != 2 {
+		t.Errorf("third update got position %d, want 2", position)
+	}
+
+	// Other chats wait for the only worker.
+	if position := d.submitUpdate(t, 2, 8, 4); position != 1 {
+		t.Errorf("update of another chat got position %d, want 1", position)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		d.mu.Lock()
+		waiting := d.waiting
+		d.mu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the update of the second chat never waited for a worker")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if position := d.submitUpdate(t, 3, 9, 5); position != 2 {
+		t.Errorf("update of a third chat got position %d, want 2", position)
+	}
+}
+
+func TestDispatcherRejectsFullLane(t *testing.T) {
+	d := newTestDispatcher(t, 1, 1, 2)
+	d.submitUpdate(t, 1, 7, 1)
+	d.expectStart(t, 1)
+	d.submitUpdate(t, 1, 7, 2)
+	d.submitUpdate(t, 1, 7, 3)
+
+	position, ok := d.submit(1, laneItem{userID: 7, update: tgbotapi.Update{UpdateID: 4}})
+	if ok {
+		t.Fatal("update was accepted by a full lane")
+	}
+	if position != 2 {
+		t.Errorf("got position %d, want 2", position)
+	}
+	// Other chats still have room.
+	d.submitUpdate(t, 2, 8, 5)
+}
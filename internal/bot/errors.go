@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"errors"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+	"github.com/Mohammad-Alipour/Zebio/internal/urlguard"
+)
+
+var downloadErrorKeys = []struct {
+	kind error
+	key  string
+}{
+	{urlguard.ErrInvalidURL, "error.invalid_url"},
+	{urlguard.ErrScheme, "error.invalid_url"},
+	{urlguard.ErrBlockedAddress, "error.url_blocked"},
+	{urlguard.ErrDomainDenied, "error.domain_denied"},
+	{downloader.ErrUnsupportedURL, "error.unsupported_url"},
+	{downloader.ErrUnavailable, "error.unavailable"},
+	{downloader.ErrPrivateContent, "error.private"},
+	{downloader.ErrGeoBlocked, "error.geo_blocked"},
+	{downloader.ErrBotCheck, "error.bot_check"},
+	{downloader.ErrLoginRequired, "error.login_required"},
+	{downloader.ErrCookies, "error.login_required"},
+	{downloader.ErrRateLimited, "error.rate_limited"},
+	{downloader.ErrTooLarge, "error.too_large"},
+	{downloader.ErrTimeout, "error.timeout"},
+	{downloader.ErrNetwork, "error.network"},
+	{downloader.ErrFormatUnavailable, "error.format_unavailable"},
+	{downloader.ErrLiveStream, "error.live"},
+	{downloader.ErrDRM, "error.drm"},
+}
+
+// downloadErrorText explains a downloader failure to the user. The error
+// itself is only meant for the logs.
+func downloadErrorText(lang string, err error) string {
+	for _, entry := range downloadErrorKeys {
+		if errors.Is(err, entry.kind) {
+			return tr(lang, entry.key)
+		}
+	}
+	return tr(lang, "error.unknown")
+}
@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type audioPreset struct {
+	ID      string
+	Format  string
+	Quality string
+}
+
+var audioPresets = []audioPreset{
+	{ID: "orig", Format: downloader.AudioFormatOriginal},
+	{ID: "mp3-128", Format: "mp3", Quality: "128K"},
+	{ID: "mp3-320", Format: "mp3", Quality: "320K"},
+	{ID: "mp3-v0", Format: "mp3", Quality: "0"},
+	{ID: "m4a", Format: "m4a", Quality: "192K"},
+	{ID: "opus", Format: "opus", Quality: "128K"},
+	{ID: "ogg", Format: "ogg", Quality: "5"},
+	{ID: "flac", Format: "flac"},
+	{ID: "wav", Format: "wav"},
+}
+
+func findAudioPreset(id string) (audioPreset, bool) {
+	for _, preset := range audioPresets {
+		if preset.ID == id {
+			return preset, true
+		}
+	}
+	return audioPreset{}, false
+}
+
+func (p audioPreset) label(lang string) string {
+	label := audioFormatLabel(lang, p.Format)
+	if p.Quality != "" {
+		label += " " + audioQualityLabel(lang, p.Quality)
+	}
+	return label
+}
+
+func audioFormatKeyboard(lang string, token string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, preset := range audioPresets {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(preset.label(lang), "dlaudio:"+preset.ID+":"+token))
+		if len(row) == 3 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	backButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.back"), "dlformats:back:"+token)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(backButton))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func resolutionButtonLabel(res downloader.Resolution) string {
+	label := fmt.Sprintf("%dp", res.Height)
+	if res.FPS > 30 {
+		label += strconv.Itoa(int(res.FPS))
+	}
+	if res.Size > 0 {
+		label += " · ≈" + formatBytes(res.Size)
+	}
+	return label
+}
+
+func resolutionKeyboard(lang string, resolutions []downloader.Resolution, token string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, res := range resolutions {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(resolutionButtonLabel(res), "dlres:"+strconv.Itoa(res.Height)+":"+token))
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	backButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.back"), "dlformats:back:"+token)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(backButton))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
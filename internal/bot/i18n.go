@@ -0,0 +1,355 @@
+package bot
+
+var translations = map[string]map[string]string{
+	"fa": {
+		"start":           "سلام *%s* عزیز\\! 👋\n\nبه ربات دانلودر *%s* خوش اومدی\\.\nمن می‌تونم از لینک‌هایی که می‌فرستی \\(مثل یوتیوب، ساندکلود، اینستاگرام و\\.\\.\\.\\) برات فایل صوتی یا ویدیویی دانلود کنم\\.\n\n🔗 کافیه لینک مورد نظرت رو برام ارسال کنی\\!\n\nراهنمایی بیشتر: /help",
+		"help":            "راهنمای استفاده از ربات *%s* 🤖\n\n۱\\. لینک مستقیم از پلتفرم‌هایی مثل:\n   یوتیوب 🔴\n   ساندکلود 🟠\n   اینستاگرام 🟣\n   و \\.\\.\\. رو برای من ارسال کن\\.\n\n۲\\. اگر محتوای لینک هم صوتی و هم تصویری باشه، ازت می‌پرسم که کدوم رو می‌خوای برات دانلود کنم:\n   🎵 *صدا* \\(فایل صوتی با کاور\\)\n   🎬 *ویدیو* \\(فایل MP4\\)\n\n۳\\. بعد از انتخاب، فایل رو برات آماده و ارسال می‌کنم\\!\n\n⚙️ /settings \\- تنظیمات پیش‌فرض دانلود\n📋 /queue \\- مشاهده کارهای در حال انجام\n🚫 /cancel \\<شناسه\\> \\- لغو یک کار\n🔎 /search \\<عبارت\\> \\- جستجو در یوتیوب و ساندکلود",
+		"unknown_command": "دستور شناخته نشد\\. برای راهنمایی /help رو بزنید\\.",
+
+		"choice.with_info":     "✅ اطلاعات با موفقیت دریافت شد:\n*پیج/خواننده:* `%s`\n*عنوان:* `%s`\n\nحالا انتخاب کنید که کدام مورد را برای شما آماده کنم؟ 👇",
+		"choice.generic":       "✅ اطلاعات اولیه لینک دریافت شد\\.\n\nلطفاً نوع دانلود مورد نظرتون رو انتخاب کنید: 👇",
+		"button.video":         "دانلود ویدیو 🎬",
+		"button.audio":         "دانلود صدا 🎵",
+		"button.photo":         "دانلود عکس 🖼️",
+		"button.audio_formats": "🎚 فرمت‌های دیگر صدا",
+		"button.back":          "🔙 بازگشت",
+		"button.cancel":        "❌ لغو",
+		"button.batch_audio":   "🎵 همه به صورت صدا",
+		"button.batch_video":   "🎬 همه به صورت ویدیو",
+		"button.batch_each":    "🔍 انتخاب جداگانه برای هر لینک",
+		"batch.found":          "🔗 %d لینک در پیام شما پیدا شد:\n\n%s\n\nچطور دانلود شوند؟",
+		"batch.started":        "⏳ %d لینک در صف دانلود قرار گرفت. وضعیت هر کدام را با /queue ببینید.",
+		"batch.skipped":        "⚠️ %d لینک به دلیل پر بودن صف اضافه نشد:\n%s",
+		"button.previous":      "◀️ قبلی",
+		"button.next":          "بعدی ▶️",
+		"search.usage":         "لطفاً عبارت جستجو را بعد از دستور بنویسید. مثال:\n/search Shadmehr Aghili",
+		"search.searching":     "🔎 در حال جستجو در یوتیوب و ساندکلود...",
+		"search.no_results":    "نتیجه‌ای برای این جستجو پیدا نشد.",
+		"search.results":       "🔎 نتایج جستجو برای «%s» (صفحه %d از %d):",
+		"inline.downloading":   "⏳ در حال آماده‌سازی «%s»...",
+		"inline.not_started":   "❌ ربات نمی‌تواند فایل را برای شما آماده کند، چون هنوز آن را استارت نکرده‌اید. ربات را در چت خصوصی استارت کنید و دوباره تلاش کنید.",
+		"inline.open_bot":      "🤖 باز کردن ربات",
+		"inline.start_bot":     "برای استفاده، ابتدا ربات را استارت کنید",
+		"inline.upload_failed": "❌ ارسال فایل ممکن نشد. لطفاً دوباره تلاش کنید.",
+
+		"job.queued":      "در صف ⏳",
+		"job.fetching":    "دریافت اطلاعات 🔍",
+		"job.downloading": "در حال دانلود ⬇️",
+		"job.uploading":   "در حال ارسال ⬆️",
+		"job.done":        "انجام شد ✅",
+		"job.failed":      "ناموفق ❌",
+		"job.cancelled":   "لغو شد 🚫",
+		"job.interrupted": "متوقف شده با راه‌اندازی مجدد ⏸",
+
+		"settings.title":          "⚙️ تنظیمات شما",
+		"settings.hint":           "برای تغییر هر مورد روی دکمه آن بزنید.",
+		"settings.default_type":   "نوع پیش‌فرض",
+		"settings.audio_format":   "فرمت صدا",
+		"settings.audio_quality":  "کیفیت صدا",
+		"settings.max_resolution": "حداکثر کیفیت ویدیو",
+		"settings.thumbnail":      "کاور در فایل",
+		"settings.caption":        "کپشن",
+		"settings.language":       "زبان",
+		"settings.saved":          "✅ ذخیره شد",
+		"settings.not_yours":      "⛔️ این منو مربوط به تنظیمات شخص دیگری است. برای تنظیمات خودتان /settings را بزنید.",
+		"settings.error":          "خطا در ذخیره تنظیمات. لطفاً دوباره تلاش کنید.",
+
+		"value.ask":      "بپرس",
+		"value.audio":    "صدا",
+		"value.video":    "ویدیو",
+		"value.on":       "روشن",
+		"value.off":      "خاموش",
+		"value.auto":     "خودکار",
+		"value.best":     "بهترین",
+		"value.original": "اصلی ⚡️",
+
+		"error.link_failed":        "⚠️ متاسفانه در پردازش اولیه لینک شما مشکلی پیش آمد.",
+		"error.download_failed":    "❌ متاسفانه در فرآیند دانلود برای «%s» مشکلی پیش آمد.",
+		"error.invalid_url":        "لطفاً یک لینک معتبر که با http یا https شروع می‌شود ارسال کنید.",
+		"error.url_blocked":        "این لینک به یک آدرس داخلی یا غیرعمومی اشاره می‌کند و دانلود نمی‌شود.",
+		"error.domain_denied":      "دانلود از این سایت در این ربات مجاز نیست.",
+		"error.unsupported_url":    "این لینک پشتیبانی نمی‌شود. لطفاً لینک مستقیم یک ویدیو یا آهنگ را ارسال کنید.",
+		"error.unavailable":        "این محتوا در دسترس نیست یا حذف شده است.",
+		"error.private":            "این محتوا خصوصی است و ربات به آن دسترسی ندارد.",
+		"error.geo_blocked":        "این محتوا در منطقه‌ی سرور ربات مسدود شده است.",
+		"error.login_required":     "دانلود این محتوا نیاز به ورود به حساب کاربری دارد (مثلاً محدودیت سنی یا محتوای مخصوص اعضا).",
+		"error.bot_check":          "یوتیوب از ربات خواسته برای اثبات ربات نبودن وارد حساب شود. تا وقتی مدیر ربات کوکی‌های آن را به‌روز نکند، این ویدیو دانلود نمی‌شود.",
+		"error.rate_limited":       "سایت مبدأ موقتاً درخواست‌های ربات را محدود کرده است. لطفاً چند دقیقه دیگر دوباره تلاش کنید.",
+		"error.too_large":          "حجم این فایل بیش از حد مجاز است.",
+		"error.timeout":            "پاسخ سایت مبدأ بیش از حد طول کشید. لطفاً بعداً دوباره تلاش کنید.",
+		"error.network":            "ارتباط با سایت مبدأ برقرار نشد. لطفاً چند دقیقه دیگر دوباره تلاش کنید.",
+		"error.format_unavailable": "کیفیت یا فرمت درخواستی برای این محتوا موجود نیست. لطفاً کیفیت دیگری را انتخاب کنید.",
+		"error.live":               "پخش زنده قابل دانلود نیست. لطفاً بعد از پایان پخش دوباره تلاش کنید.",
+		"error.drm":                "این محتوا با DRM محافظت شده و قابل دانلود نیست.",
+		"error.unknown":            "خطای نامشخصی رخ داد. لطفاً از صحت لینک مطمئن شوید یا بعداً دوباره تلاش کنید.",
+
+		"error.internal":          "خطای داخلی رخ داد. لطفاً دوباره تلاش کنید.",
+		"error.low_disk":          "⚠️ فضای ذخیره‌سازی سرور در حال حاضر پر است. لطفاً چند دقیقه دیگر دوباره تلاش کنید.",
+		"error.membership_check":  "خطا در بررسی عضویت کانال. لطفاً لحظاتی دیگر دوباره امتحان کنید.",
+		"error.not_allowed":       "متاسفم، شما اجازه استفاده از این ربات را ندارید.",
+		"error.not_allowed_alert": "شما مجاز نیستید.",
+		"error.no_content":        "محتوای قابل دانلودی (ویدیو، صدا یا عکس) در این لینک پیدا نشد.",
+		"error.unsupported_link":  "نوع لینک ارسال شده پشتیبانی نمی‌شود یا محتوایی در آن یافت نشد.",
+
+		"join.text":   "⚠️ کاربر گرامی، برای استفاده از امکانات ربات *%s*، ابتدا باید در کانال رسمی ما عضو شوید:\n\n%s\n\nپس از عضویت، دوباره دستور خود را ارسال کنید یا /start را بزنید\\.",
+		"join.button": "عضویت در کانال 🚀",
+		"join.alert":  "لطفا ابتدا در کانال عضو شوید.",
+
+		"queue.full":           "⛔️ تعداد درخواست‌های در انتظار شما زیاد است. لطفاً صبر کنید تا درخواست‌های قبلی انجام شوند.",
+		"queue.position":       "⏳ درخواست شما در صف قرار گرفت. شما نفر #%d در صف هستید.",
+		"job.list_empty":       "📭 در حال حاضر هیچ کاری برای شما ثبت نشده است.",
+		"job.list_title":       "📋 *کارهای شما:*\n\n",
+		"job.list_hint":        "برای لغو یک کار: /cancel <شناسه>",
+		"job.cancel_usage":     "لطفاً شناسه کار را وارد کنید. مثال: /cancel a1b2c3d4\nبرای دیدن شناسه‌ها /queue را بزنید.",
+		"job.cancel_done":      "🚫 کار %s لغو شد.",
+		"job.already_finished": "این کار قبلاً به پایان رسیده است.",
+		"job.not_found":        "کاری با این شناسه پیدا نشد.",
+		"job.cancel_failed":    "لغو کار با خطا مواجه شد.",
+		"job.cancelled_alert":  "🚫 لغو شد",
+		"button.cancel_job":    "🚫 لغو",
+		"session.expired":      "⌛️ این درخواست منقضی شده است. لطفاً لینک را دوباره ارسال کنید.",
+		"session.not_yours":    "⛔️ این دکمه‌ها مربوط به درخواست شخص دیگری است.",
+
+		"link.fetching":            "🔍 در حال بررسی و دریافت اطلاعات از لینک شما... لطفاً چند لحظه صبر کنید.",
+		"download.preparing_info":  "در حال آماده‌سازی و دانلود *%s* برای:\n`%s \\- %s`\n\nاین فرآیند ممکن است کمی طول بکشد، لطفاً صبور باشید\\.\\.\\. ⏳",
+		"download.preparing":       "در حال آماده‌سازی و دانلود *%s* شما\\.\\.\\. ⏳",
+		"download.cancelled":       "🚫 دانلود لغو شد.",
+		"progress.post_processing": "⚙️ در حال پردازش نهایی فایل...",
+		"filetype.audio":           "فایل صوتی",
+		"filetype.video":           "فایل ویدیویی",
+		"filetype.photo":           "فایل عکس",
+		"filetype.file":            "فایل",
+		"upload.as_document":       "ℹ️ حجم فایل برای ارسال به صورت رسانه زیاد بود، به همین دلیل به صورت فایل ارسال می‌شود.",
+		"upload.reencoded":         "ℹ️ حجم ویدیو (%s) از حد مجاز تلگرام (%s) بیشتر بود، به همین دلیل با کیفیت پایین‌تر فشرده شد.",
+		"upload.split":             "ℹ️ حجم فایل (%s) از حد مجاز تلگرام (%s) بیشتر بود، به همین دلیل در %d بخش ارسال می‌شود.",
+		"upload.offer_lower":       "⚠️ حجم این کیفیت حدود %s است و از حد مجاز تلگرام (%s) بیشتر است. لطفاً یک کیفیت پایین‌تر انتخاب کنید:",
+		"upload.failed":            "❌ ارسال فایل با خطا مواجه شد.",
+		"upload.too_large":         "❌ حجم فایل از حد مجاز تلگرام (%s) بیشتر است و امکان کاهش حجم یا تقسیم آن وجود نداشت.",
+
+		"album.found":             "آلبوم یا پلی‌لیست پیدا شد:\n*%s*\nتوسط: `%s`\nتعداد آهنگ‌ها: *%d*\n\nآیا می‌خواهید تمام آهنگ‌ها دانلود شوند؟",
+		"album.started":           "✅ بسیار خب! فرآیند دانلود آلبوم ساندکلود آغاز شد...",
+		"album.panic":             "❌ یک خطای داخلی بسیار جدی در حین دانلود آلبوم رخ داد و فرآیند متوقف شد.",
+		"album.info_error":        "خطایی در دریافت اطلاعات آلبوم رخ داد. لطفاً دوباره تلاش کنید.",
+		"album.fetching_track":    "در حال دریافت اطلاعات آهنگ %d از %d...",
+		"album.downloading_track": "در حال دانلود آهنگ %d از %d\n*%s*",
+		"album.cancelled":         "🚫 دانلود آلبوم لغو شد.",
+		"album.all_failed":        "متاسفانه دانلود هیچ یک از آهنگ‌های آلبوم موفقیت‌آمیز نبود.",
+		"button.album_yes":        "✅ بله، دانلود کن",
+		"button.album_no":         "❌ نه",
+
+		"spotify.disabled":           "قابلیت اسپاتیفای در حال حاضر فعال نیست.",
+		"spotify.processing":         "🔗 لینک اسپاتیفای دریافت شد. در حال پردازش...",
+		"spotify.invalid_link":       "خطا: لینک اسپاتیفای معتبر به نظر نمی‌رسد.",
+		"spotify.api_error":          "خطا در دریافت اطلاعات از API اسپاتیفای.",
+		"spotify.album_api_error":    "خطا در دریافت اطلاعات آلبوم از API اسپاتیفای.",
+		"spotify.playlist_api_error": "خطا در دریافت اطلاعات پلی‌لیست از API اسپاتیفای.",
+		"spotify.track_found":        "✅ اطلاعات آهنگ دریافت شد. در حال جستجوی آهنگ جایگزین...",
+		"spotify.trying_soundcloud":  "در یوتیوب پیدا نشد. در حال جستجو در ساندکلود...",
+		"spotify.not_found":          "متاسفانه آهنگ مورد نظر در یوتیوب و ساندکلود پیدا نشد.",
+		"spotify.album_found":        "آلبوم/پلی‌لیست اسپاتیفای پیدا شد:\n*%s*\nتوسط: `%s`\nتعداد آهنگ‌ها: *%d*\n\nبرای دانلود، هر آهنگ در یوتیوب/ساندکلود جستجو خواهد شد\\. این فرآیند ممکن است بسیار زمان‌بر باشد\\. ادامه می‌دهید؟",
+		"spotify.album_started":      "✅ بسیار خب! فرآیند دانلود آلبوم اسپاتیفای آغاز شد. این کار زمان‌بر خواهد بود...",
+		"spotify.album_panic":        "❌ یک خطای داخلی بسیار جدی در حین دانلود آلبوم اسپاتیفای رخ داد و فرآیند متوقف شد.",
+		"spotify.searching_track":    "در حال جستجوی آهنگ %d از %d:\n*%s*",
+		"spotify.track_skipped":      "⚠️ آهنگ '%s' پیدا نشد و از لیست دانلود حذف شد.",
+		"spotify.track_failed":       "❌ دانلود آهنگ '%s' با خطا مواجه شد.",
+		"spotify.album_cancelled":    "🚫 دانلود آلبوم اسپاتیفای لغو شد.",
+		"spotify.album_all_failed":   "متاسفانه دانلود هیچ یک از آهنگ‌های آلبوم اسپاتیفای موفقیت‌آمیز نبود.",
+		"spotify.album_done":         "✅ تعداد %d از %d آهنگ با موفقیت دانلود شد. در حال ارسال...",
+
+		"shutdown.cancelled": "🚫 ربات در حال خاموش شدن است و کار «%s» لغو شد. لطفاً بعداً دوباره تلاش کنید.",
+		"shutdown.paused":    "⏸ ربات در حال راه‌اندازی مجدد است. کار «%s» متوقف شد و پس از راه‌اندازی دوباره به طور خودکار ادامه پیدا می‌کند.",
+		"shutdown.dropped":   "⚠️ ربات در حال خاموش شدن است و درخواست شما انجام نشد. لطفاً چند دقیقه دیگر دوباره ارسال کنید.",
+		"shutdown.resumed":   "🔄 ربات دوباره راه‌اندازی شد و کار «%s» از سر گرفته می‌شود.",
+
+		"admin.purge_usage":       "استفاده: /purge all یا /purge <لینک یا extractor:id>",
+		"admin.purged":            "🧹 تعداد %d مورد از کش حذف شد.",
+		"admin.stats":             "📊 وضعیت کش فایل‌ها:\nتعداد موارد: %d\nموفق (hit): %d\nناموفق (miss): %d\nنرخ موفقیت: %.1f%%",
+		"admin.disk":              "💾 وضعیت پوشه دانلود:\nتعداد موارد: %d\nحجم: %s از %s مجاز",
+		"admin.disk_free":         "\nفضای آزاد دیسک: %s از %s\nحداقل فضای آزاد لازم: %s",
+		"admin.disk_free_unknown": "\nفضای آزاد دیسک روی این سیستم قابل اندازه‌گیری نیست.",
+		"admin.disk_error":        "❌ خواندن وضعیت دیسک با خطا مواجه شد.",
+	},
+	"en": {
+		"start":           "Hi *%s*\\! 👋\n\nWelcome to the *%s* downloader bot\\.\nI can download audio or video from the links you send me \\(YouTube, SoundCloud, Instagram and more\\)\\.\n\n🔗 Just send me a link\\!\n\nMore help: /help",
+		"help":            "How to use *%s* 🤖\n\n1\\. Send me a direct link from platforms like:\n   YouTube 🔴\n   SoundCloud 🟠\n   Instagram 🟣\n   and more\\.\n\n2\\. If the link has both audio and video, I'll ask which one you want:\n   🎵 *Audio* \\(audio file with cover\\)\n   🎬 *Video* \\(MP4 file\\)\n\n3\\. After you choose, I'll prepare the file and send it to you\\!\n\n⚙️ /settings \\- default download settings\n📋 /queue \\- see your running jobs\n🚫 /cancel \\<id\\> \\- cancel a job\n🔎 /search \\<query\\> \\- search YouTube and SoundCloud",
+		"unknown_command": "Unknown command\\. Send /help for help\\.",
+
+		"choice.with_info":     "✅ Got the details:\n*Artist/Page:* `%s`\n*Title:* `%s`\n\nWhat should I prepare for you? 👇",
+		"choice.generic":       "✅ Got the link details\\.\n\nPlease choose a download type: 👇",
+		"button.video":         "Download video 🎬",
+		"button.audio":         "Download audio 🎵",
+		"button.photo":         "Download photo 🖼️",
+		"button.audio_formats": "🎚 More audio formats",
+		"button.back":          "🔙 Back",
+		"button.cancel":        "❌ Cancel",
+		"button.batch_audio":   "🎵 All as audio",
+		"button.batch_video":   "🎬 All as video",
+		"button.batch_each":    "🔍 Choose for each link",
+		"batch.found":          "🔗 Found %d links in your message:\n\n%s\n\nHow should they be downloaded?",
+		"batch.started":        "⏳ Queued %d links for download. See each of them with /queue.",
+		"batch.skipped":        "⚠️ %d links were not added because the queue is full:\n%s",
+		"button.previous":      "◀️ Previous",
+		"button.next":          "Next ▶️",
+		"search.usage":         "Please write your search after the command. Example:\n/search Shadmehr Aghili",
+		"search.searching":     "🔎 Searching YouTube and SoundCloud...",
+		"search.no_results":    "Nothing was found for this search.",
+		"search.results":       "🔎 Search results for “%s” (page %d of %d):",
+		"inline.downloading":   "⏳ Preparing “%s”...",
+		"inline.not_started":   "❌ The bot cannot prepare the file for you because you have not started it yet. Start the bot in a private chat and try again.",
+		"inline.open_bot":      "🤖 Open the bot",
+		"inline.start_bot":     "Start the bot first to use it",
+		"inline.upload_failed": "❌ Could not send the file. Please try again.",
+
+		"job.queued":      "Queued ⏳",
+		"job.fetching":    "Fetching info 🔍",
+		"job.downloading": "Downloading ⬇️",
+		"job.uploading":   "Uploading ⬆️",
+		"job.done":        "Done ✅",
+		"job.failed":      "Failed ❌",
+		"job.cancelled":   "Cancelled 🚫",
+		"job.interrupted": "Stopped by a restart ⏸",
+
+		"settings.title":          "⚙️ Your settings",
+		"settings.hint":           "Tap a button to change that option.",
+		"settings.default_type":   "Default type",
+		"settings.audio_format":   "Audio format",
+		"settings.audio_quality":  "Audio quality",
+		"settings.max_resolution": "Max video resolution",
+		"settings.thumbnail":      "Embed cover",
+		"settings.caption":        "Caption",
+		"settings.language":       "Language",
+		"settings.saved":          "✅ Saved",
+		"settings.not_yours":      "⛔️ This menu belongs to someone else. Send /settings to change your own settings.",
+		"settings.error":          "Could not save your settings. Please try again.",
+
+		"value.ask":      "Ask",
+		"value.audio":    "Audio",
+		"value.video":    "Video",
+		"value.on":       "On",
+		"value.off":      "Off",
+		"value.auto":     "Auto",
+		"value.best":     "Best",
+		"value.original": "Original ⚡️",
+
+		"error.link_failed":        "⚠️ Sorry, something went wrong while reading your link.",
+		"error.download_failed":    "❌ Sorry, downloading “%s” failed.",
+		"error.invalid_url":        "Please send a valid link starting with http or https.",
+		"error.url_blocked":        "This link points to an internal or non-public address and will not be downloaded.",
+		"error.domain_denied":      "Downloading from this site is not allowed on this bot.",
+		"error.unsupported_url":    "This link is not supported. Please send a direct link to a video or track.",
+		"error.unavailable":        "This content is unavailable or has been removed.",
+		"error.private":            "This content is private and the bot cannot access it.",
+		"error.geo_blocked":        "This content is blocked in the region of the bot's server.",
+		"error.login_required":     "This content requires signing in (for example age restricted or members-only content).",
+		"error.bot_check":          "YouTube asked the bot to sign in to prove it is not a bot. This video cannot be downloaded until the bot's admin updates its cookies.",
+		"error.rate_limited":       "The site is temporarily limiting the bot's requests. Please try again in a few minutes.",
+		"error.too_large":          "This file is larger than allowed.",
+		"error.timeout":            "The site took too long to respond. Please try again later.",
+		"error.network":            "Could not reach the site. Please try again in a few minutes.",
+		"error.format_unavailable": "The requested quality or format is not available for this content. Please pick another one.",
+		"error.live":               "Live streams cannot be downloaded. Please try again after the stream has ended.",
+		"error.drm":                "This content is DRM protected and cannot be downloaded.",
+		"error.unknown":            "An unknown error occurred. Please check the link or try again later.",
+
+		"error.internal":          "An internal error occurred. Please try again.",
+		"error.low_disk":          "⚠️ The server's storage is full right now. Please try again in a few minutes.",
+		"error.membership_check":  "Could not check your channel membership. Please try again in a moment.",
+		"error.not_allowed":       "Sorry, you are not allowed to use this bot.",
+		"error.not_allowed_alert": "You are not allowed.",
+		"error.no_content":        "No downloadable content (video, audio or photo) was found in this link.",
+		"error.unsupported_link":  "This type of link is not supported or it has no content.",
+
+		"join.text":   "⚠️ To use *%s*, please join our official channel first:\n\n%s\n\nAfter joining, send your command again or tap /start\\.",
+		"join.button": "Join the channel 🚀",
+		"join.alert":  "Please join the channel first.",
+
+		"queue.full":           "⛔️ You have too many pending requests. Please wait for the earlier ones to finish.",
+		"queue.position":       "⏳ Your request was queued. You are number %d in the queue.",
+		"job.list_empty":       "📭 You have no jobs right now.",
+		"job.list_title":       "📋 *Your jobs:*\n\n",
+		"job.list_hint":        "To cancel a job: /cancel <id>",
+		"job.cancel_usage":     "Please enter the job ID, for example: /cancel a1b2c3d4\nSend /queue to see the IDs.",
+		"job.cancel_done":      "🚫 Job %s was cancelled.",
+		"job.already_finished": "This job has already finished.",
+		"job.not_found":        "No job with this ID was found.",
+		"job.cancel_failed":    "Cancelling the job failed.",
+		"job.cancelled_alert":  "🚫 Cancelled",
+		"button.cancel_job":    "🚫 Cancel",
+		"session.expired":      "⌛️ This request has expired. Please send the link again.",
+		"session.not_yours":    "⛔️ These buttons belong to someone else's request.",
+
+		"link.fetching":            "🔍 Checking your link and fetching its information... Please wait a moment.",
+		"download.preparing_info":  "Preparing and downloading the *%s* for:\n`%s \\- %s`\n\nThis may take a little while, please be patient\\.\\.\\. ⏳",
+		"download.preparing":       "Preparing and downloading your *%s*\\.\\.\\. ⏳",
+		"download.cancelled":       "🚫 The download was cancelled.",
+		"progress.post_processing": "⚙️ Finishing up the file...",
+		"filetype.audio":           "audio file",
+		"filetype.video":           "video file",
+		"filetype.photo":           "photo",
+		"filetype.file":            "file",
+		"upload.as_document":       "ℹ️ The file was too large to send as media, so it is sent as a file.",
+		"upload.reencoded":         "ℹ️ The video (%s) was larger than Telegram's limit (%s), so it was compressed to a lower quality.",
+		"upload.split":             "ℹ️ The file (%s) was larger than Telegram's limit (%s), so it is sent in %d parts.",
+		"upload.offer_lower":       "⚠️ This quality is about %s, which is above Telegram's limit (%s). Please pick a lower quality:",
+		"upload.failed":            "❌ Sending the file failed.",
+		"upload.too_large":         "❌ The file is larger than Telegram's limit (%s) and could not be reduced or split.",
+
+		"album.found":             "Album or playlist found:\n*%s*\nBy: `%s`\nTracks: *%d*\n\nDo you want to download all tracks?",
+		"album.started":           "✅ Okay! The SoundCloud album download has started...",
+		"album.panic":             "❌ A serious internal error occurred while downloading the album and the process was stopped.",
+		"album.info_error":        "Could not get the album information. Please try again.",
+		"album.fetching_track":    "Fetching information of track %d of %d...",
+		"album.downloading_track": "Downloading track %d of %d\n*%s*",
+		"album.cancelled":         "🚫 The album download was cancelled.",
+		"album.all_failed":        "Sorry, none of the album's tracks could be downloaded.",
+		"button.album_yes":        "✅ Yes, download",
+		"button.album_no":         "❌ No",
+
+		"spotify.disabled":           "Spotify support is not enabled right now.",
+		"spotify.processing":         "🔗 Spotify link received. Processing...",
+		"spotify.invalid_link":       "Error: this does not look like a valid Spotify link.",
+		"spotify.api_error":          "Could not get information from the Spotify API.",
+		"spotify.album_api_error":    "Could not get the album information from the Spotify API.",
+		"spotify.playlist_api_error": "Could not get the playlist information from the Spotify API.",
+		"spotify.track_found":        "✅ Track information received. Searching for a matching track...",
+		"spotify.trying_soundcloud":  "Not found on YouTube. Searching SoundCloud...",
+		"spotify.not_found":          "Sorry, this track was not found on YouTube or SoundCloud.",
+		"spotify.album_found":        "Spotify album/playlist found:\n*%s*\nBy: `%s`\nTracks: *%d*\n\nEach track will be searched on YouTube/SoundCloud to download it\\. This can take a long time\\. Continue?",
+		"spotify.album_started":      "✅ Okay! The Spotify album download has started. This will take a while...",
+		"spotify.album_panic":        "❌ A serious internal error occurred while downloading the Spotify album and the process was stopped.",
+		"spotify.searching_track":    "Searching for track %d of %d:\n*%s*",
+		"spotify.track_skipped":      "⚠️ Track '%s' was not found and was removed from the download list.",
+		"spotify.track_failed":       "❌ Downloading track '%s' failed.",
+		"spotify.album_cancelled":    "🚫 The Spotify album download was cancelled.",
+		"spotify.album_all_failed":   "Sorry, none of the Spotify album's tracks could be downloaded.",
+		"spotify.album_done":         "✅ Downloaded %d of %d tracks. Sending...",
+
+		"shutdown.cancelled": "🚫 The bot is shutting down and “%s” was cancelled. Please try again later.",
+		"shutdown.paused":    "⏸ The bot is restarting. “%s” was paused and will continue automatically once the bot is back.",
+		"shutdown.dropped":   "⚠️ The bot is shutting down and your request was not handled. Please send it again in a few minutes.",
+		"shutdown.resumed":   "🔄 The bot has restarted and “%s” is being resumed.",
+
+		"admin.purge_usage":       "Usage: /purge all or /purge <link or extractor:id>",
+		"admin.purged":            "🧹 Removed %d entries from the cache.",
+		"admin.stats":             "📊 File cache status:\nEntries: %d\nHits: %d\nMisses: %d\nHit ratio: %.1f%%",
+		"admin.disk":              "💾 Download directory status:\nEntries: %d\nSize: %s of %s allowed",
+		"admin.disk_free":         "\nFree disk space: %s of %s\nMinimum free space required: %s",
+		"admin.disk_free_unknown": "\nFree disk space cannot be measured on this system.",
+		"admin.disk_error":        "❌ Could not read the disk status.",
+	},
+}
+
+var languageNames = map[string]string{
+	"fa": "فارسی",
+	"en": "English",
+}
+
+func tr(lang string, key string) string {
+	if text, ok := translations[lang][key]; ok {
+		return text
+	}
+	if text, ok := translations["fa"][key]; ok {
+		return text
+	}
+	return key
+}
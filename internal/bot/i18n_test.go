@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+)
+
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestTranslationsMatch(t *testing.T) {
+	for lang, texts := range translations {
+		for other, otherTexts := range translations {
+			if lang == other {
+				continue
+			}
+			for key, text := range texts {
+				otherText, ok := otherTexts[key]
+				if !ok {
+					t.Errorf("key %q is in %q but missing in %q", key, lang, other)
+					continue
+				}
+				if got, want := formatVerb.FindAllString(otherText, -1), formatVerb.FindAllString(text, -1); len(got) != len(want) {
+					t.Errorf("key %q has verbs %v in %q but %v in %q", key, got, other, want, lang)
+				}
+			}
+		}
+	}
+}
+
+func TestTypeToString(t *testing.T) {
+	if got := typeToString("en", downloader.VideoBest); got != "video file" {
+		t.Errorf("typeToString(en) = %q, want %q", got, "video file")
+	}
+	if got := typeToString("", downloader.AudioOnly); got != "فایل صوتی" {
+		t.Errorf("typeToString(\"\") = %q, want the Persian fallback", got)
+	}
+}
+
+func TestFormatProgressPostProcessing(t *testing.T) {
+	got := formatProgress("en", downloader.Progress{Phase: downloader.PhasePostProcessing})
+	want := progressBar(100) + " 100%\n" + tr("en", "progress.post_processing")
+	if got != want {
+		t.Errorf("formatProgress() = %q, want %q", got, want)
+	}
+}
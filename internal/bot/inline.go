@@ -0,0 +1,464 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/cache"
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+	"github.com/Mohammad-Alipour/Zebio/internal/jobs"
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	sessionKindInline = "inline"
+	// Telegram drops inline queries that are not answered within about ten
+	// seconds, so searches get less time than in a chat.
+	inlineSearchTimeout = 8 * time.Second
+	inlineCacheTime     = 60
+	// inlineDebounce is how long a query waits for the user to keep typing
+	// before it starts searching.
+	inlineDebounce = 400 * time.Millisecond
+	// maxInlineResults is the most results answerInlineQuery accepts.
+	maxInlineResults = 50
+)
+
+// inlineSearches limits the work inline queries cause. Telegram sends one for
+// every keystroke, so a new query cancels the running one of the same user,
+// each query waits a moment before it searches and only a few search at once.
+type inlineSearches struct {
+	mu      sync.Mutex
+	running map[int64]*inlineSearch
+	slots   chan struct{}
+	closed  bool
+	active  sync.WaitGroup
+}
+
+type inlineSearch struct {
+	cancel context.CancelFunc
+}
+
+func newInlineSearches(maxRunning int) *inlineSearches {
+	return &inlineSearches{running: make(map[int64]*inlineSearch), slots: make(chan struct{}, max(maxRunning, 1))}
+}
+
+// submitInlineQuery handles an inline query outside the dispatcher, where it
+// would wait behind downloads in the private chat lane of the user.
+func (b *Bot) submitInlineQuery(update tgbotapi.Update) {
+	s := b.inline
+	userID := update.InlineQuery.From.ID
+	ctx, cancel := context.WithCancel(context.Background())
+	search := &inlineSearch{cancel: cancel}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		cancel()
+		return
+	}
+	if previous, ok := s.running[userID]; ok {
+		previous.cancel()
+	}
+	s.running[userID] = search
+	s.active.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.active.Done()
+		defer func() {
+			s.mu.Lock()
+			if s.running[userID] == search {
+				delete(s.running, userID)
+			}
+			s.mu.Unlock()
+			cancel()
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("RECOVERED from panic while handling inline query %s for user %d: %v\n%s", update.InlineQuery.ID, userID, r, string(debug.Stack()))
+			}
+		}()
+
+		select {
+		case <-time.After(inlineDebounce):
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-s.slots }()
+		b.handleInlineUpdate(ctx, nil, update)
+	}()
+}
+
+// close cancels the running inline queries and refuses new ones.
+func (s *inlineSearches) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, search := range s.running {
+		search.cancel()
+	}
+}
+
+// handleInlineUpdate handles inline queries and the results picked from them.
+// They come without a chat, so users who may not use the bot are only told
+// so through the inline answer.
+func (b *Bot) handleInlineUpdate(ctx context.Context, queued *queuedJob, update tgbotapi.Update) {
+	from := update.SentFrom()
+	if from == nil {
+		return
+	}
+	userName := from.UserName
+	if userName == "" {
+		userName = from.FirstName
+	}
+	b.rememberUser(from)
+	allowed := b.inlineAllowed(from.ID)
+
+	if query := update.InlineQuery; query != nil {
+		log.Printf("[%s (%d)] Received inline query: %s\n", userName, from.ID, query.Query)
+		if !allowed {
+			b.answerInline(query.ID, nil, tr(b.userSettings(from.ID).Language, "inline.start_bot"))
+			return
+		}
+		b.handleInlineQuery(ctx, query, userName, from.ID)
+		return
+	}
+
+	chosen := update.ChosenInlineResult
+	log.Printf("[%s (%d)] Chose inline result %s\n", userName, from.ID, chosen.ResultID)
+	if !allowed {
+		return
+	}
+	b.handleChosenInlineResult(queued, chosen, userName, from.ID)
+}
+
+// inlineAllowed applies the access rules of handleUpdate without sending any
+// messages.
+func (b *Bot) inlineAllowed(userID int64) bool {
+	if len(b.cfg.AllowedUserIDs) > 0 {
+		isAllowed := false
+		for _, allowedID := range b.cfg.AllowedUserIDs {
+			if userID == allowedID {
+				isAllowed = true
+				break
+			}
+		}
+		if !isAllowed {
+			log.Printf("User %d is not in AllowedUserIDs list. Ignoring inline update.", userID)
+			return false
+		}
+	}
+	if b.cfg.ForceJoinChannel != "" {
+		isMember, _, err := b.isUserMemberOfRequiredChannel(userID)
+		if err != nil {
+			log.Printf("Error during channel membership check for user %d: %v. Ignoring inline update.", userID, err)
+			return false
+		}
+		if !isMember {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Bot) answerInline(queryID string, results []interface{}, switchPMText string) {
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: queryID,
+		Results:       results,
+		CacheTime:     inlineCacheTime,
+		IsPersonal:    true,
+	}
+	if switchPMText != "" {
+		answer.SwitchPMText = switchPMText
+		answer.SwitchPMParameter = "inline"
+	}
+	if results == nil {
+		answer.Results = []interface{}{}
+	}
+	if _, err := b.api.Request(answer); err != nil {
+		log.Printf("Error answering inline query %s: %v", queryID, err)
+	}
+}
+
+// inlineCacheKey is the key the audio of result is cached under with the
+// settings of the user.
+func inlineCacheKey(result downloader.SearchResult, spec downloader.MediaSpec) string {
+	return cache.Key(cache.Source(result.Extractor, result.ID, result.URL), downloadTypeKey(downloader.AudioOnly), spec.Key())
+}
+
+// handleInlineQuery answers with the search results. Tracks already in the
+// file ID cache are sent as audio right away; the others send a placeholder
+// that is replaced with the audio once it has been downloaded.
+func (b *Bot) handleInlineQuery(ctx context.Context, query *tgbotapi.InlineQuery, userName string, userID int64) {
+	userIdentifier := userName + "_" + strconv.FormatInt(userID, 10)
+	text := strings.TrimSpace(query.Query)
+	if text == "" {
+		b.answerInline(query.ID, nil, "")
+		return
+	}
+	settings := b.userSettings(userID)
+
+	searchCtx, cancel := context.WithTimeout(ctx, inlineSearchTimeout)
+	results, err := b.searchAll(searchCtx, text, userIdentifier)
+	cancel()
+	if ctx.Err() != nil {
+		log.Printf("[%s] Inline query '%s' was replaced by a newer one.", userIdentifier, text)
+		return
+	}
+	if len(results) == 0 {
+		if err != nil {
+			log.Printf("[%s] Inline search for '%s' failed: %v", userIdentifier, text, err)
+		}
+		b.answerInline(query.ID, nil, "")
+		return
+	}
+
+	token, err := b.newSession(sessionKindInline, userID, 0, 0, "", searchPayload{Query: text, Results: results})
+	if err != nil {
+		log.Printf("[%s] Error creating session for inline query: %v", userIdentifier, err)
+		b.answerInline(query.ID, nil, "")
+		return
+	}
+
+	answers, cached := b.inlineAnswers(settings, token, results)
+	log.Printf("[%s] Answering inline query '%s' with %d results, %d of them cached.", userIdentifier, text, len(answers), cached)
+	b.answerInline(query.ID, answers, "")
+}
+
+// inlineAnswers turns at most maxInlineResults search results into inline
+// results and counts the cached ones.
+func (b *Bot) inlineAnswers(settings store.Settings, token string, results []downloader.SearchResult) ([]interface{}, int) {
+	lang := settings.Language
+	spec := mediaSpec(settings, downloader.AudioOnly)
+	botLink := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonURL(tr(lang, "inline.open_bot"), "https://t.me/"+b.api.Self.UserName),
+	))
+	var answers []interface{}
+	cached := 0
+	for i, result := range results[:min(len(results), maxInlineResults)] {
+		id := token + ":" + strconv.Itoa(i)
+		if entry, ok := b.cachedFileID(inlineCacheKey(result, spec)); ok && mediaKind(entry.MediaKind) == mediaAudio {
+			audio := tgbotapi.NewInlineQueryResultCachedAudio(id, entry.FileID)
+			if settings.Caption {
+				audio.Caption = b.mediaCaption(mediaAudio, &downloader.TrackInfo{Title: entry.Title, Artist: entry.Artist})
+				audio.ParseMode = tgbotapi.ModeMarkdownV2
+			}
+			answers = append(answers, audio)
+			cached++
+			continue
+		}
+		// The placeholder needs a keyboard, otherwise Telegram does not report
+		// the inline message ID needed to edit it later.
+		article := tgbotapi.NewInlineQueryResultArticle(id, siteIcon(result.Site)+" "+result.Title, fmt.Sprintf(tr(lang, "inline.downloading"), result.Title))
+		article.Description = resultDetails(result)
+		article.ReplyMarkup = &botLink
+		answers = append(answers, article)
+	}
+	return answers, cached
+}
+
+// inlineResult finds the search result behind the ID of a chosen inline
+// result.
+func (b *Bot) inlineResult(resultID string, userID int64) (downloader.SearchResult, bool) {
+	token, index, found := strings.Cut(resultID, ":")
+	n, err := strconv.Atoi(index)
+	if !found || err != nil {
+		log.Printf("Malformed inline result ID: %s", resultID)
+		return downloader.SearchResult{}, false
+	}
+	session, err := b.store.GetSession(context.Background(), token)
+	if err != nil {
+		log.Printf("Error loading inline session %s: %v", token, err)
+		return downloader.SearchResult{}, false
+	}
+	if session.Kind != sessionKindInline || session.UserID != userID || time.Now().After(session.ExpiresAt) {
+		log.Printf("Inline session %s is expired or belongs to someone else.", token)
+		return downloader.SearchResult{}, false
+	}
+	var payload searchPayload
+	if err := json.Unmarshal(session.Payload, &payload); err != nil {
+		log.Printf("Error decoding inline session %s: %v", token, err)
+		return downloader.SearchResult{}, false
+	}
+	if n < 0 || n >= len(payload.Results) {
+		log.Printf("Inline result %d is out of range for session %s.", n, token)
+		return downloader.SearchResult{}, false
+	}
+	return payload.Results[n], true
+}
+
+// handleChosenInlineResult downloads the audio of a placeholder that was
+// sent. Cached results were sent as audio already and have no inline message
+// ID, as they carry no keyboard.
+func (b *Bot) handleChosenInlineResult(queued *queuedJob, chosen *tgbotapi.ChosenInlineResult, userName string, userID int64) {
+	userIdentifier := userName + "_" + strconv.FormatInt(userID, 10)
+	result, ok := b.inlineResult(chosen.ResultID, userID)
+	if chosen.InlineMessageID == "" {
+		if ok {
+			log.Printf("[%s] Sent cached inline result: %s", userIdentifier, result.URL)
+			b.audit(userID, "inline_cached", result.URL)
+		}
+		return
+	}
+	lang := b.userSettings(userID).Language
+	if !ok {
+		b.editInlineText(chosen.InlineMessageID, tr(lang, "error.unknown"))
+		return
+	}
+
+	job, jobCtx := b.takeJob(queued, userID, userID, jobs.KindSingle, result.Title, result.URL)
+	b.processInlineDownload(jobCtx, job, chosen.InlineMessageID, result, userName, userID)
+}
+
+func (b *Bot) editInlineText(inlineMessageID string, text string) {
+	edit := tgbotapi.EditMessageTextConfig{BaseEdit: tgbotapi.BaseEdit{InlineMessageID: inlineMessageID}, Text: text}
+	if _, err := b.api.Request(edit); err != nil {
+		log.Printf("Error editing inline message %s: %v", inlineMessageID, err)
+	}
+}
+
+// editInlineMedia replaces an inline placeholder with a file Telegram already
+// has. Inline messages cannot take new uploads.
+func (b *Bot) editInlineMedia(inlineMessageID string, kind mediaKind, fileID string, trackInfo *downloader.TrackInfo, withCaption bool) error {
+	caption := ""
+	if withCaption {
+		caption = b.mediaCaption(kind, trackInfo)
+	}
+	var media interface{}
+	if kind == mediaAudio {
+		audio := tgbotapi.NewInputMediaAudio(tgbotapi.FileID(fileID))
+		audio.Title = trackInfo.Title
+		audio.Performer = trackInfo.Artist
+		audio.Caption = caption
+		audio.ParseMode = tgbotapi.ModeMarkdownV2
+		media = audio
+	} else {
+		document := tgbotapi.NewInputMediaDocument(tgbotapi.FileID(fileID))
+		document.Caption = caption
+		document.ParseMode = tgbotapi.ModeMarkdownV2
+		media = document
+	}
+	_, err := b.api.Request(tgbotapi.EditMessageMediaConfig{BaseEdit: tgbotapi.BaseEdit{InlineMessageID: inlineMessageID}, Media: media})
+	return err
+}
+
+// isForbidden reports whether Telegram refused a request with 403, which it
+// does for users who never started the bot or blocked it.
+func isForbidden(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == 403
+}
+
+// processInlineDownload downloads the audio of an inline result, uploads it
+// to get a file ID and puts it in place of the placeholder.
+func (b *Bot) processInlineDownload(ctx context.Context, job *jobs.Job, inlineMessageID string, result downloader.SearchResult, userName string, userID int64) {
+	userIdentifier := userName + "_" + strconv.FormatInt(userID, 10)
+	settings := b.userSettings(userID)
+	fail := func(err error, text string) {
+		b.jobs.Finish(job.ID, err)
+		b.audit(userID, "download_failed", job.ID+" "+result.URL)
+		log.Printf("[%s] Inline download of %s failed: %v", userIdentifier, result.URL, err)
+		b.editInlineText(inlineMessageID, text)
+	}
+	failText := func(err error) string {
+		return fmt.Sprintf(tr(settings.Language, "error.download_failed"), result.Title) + "\n\n" + downloadErrorText(settings.Language, err)
+	}
+
+	// Without an upload chat the file is uploaded to the user, which only
+	// works once they started the bot. Find out before downloading.
+	if b.cfg.InlineUploadChatID == 0 {
+		if _, err := b.api.Request(tgbotapi.NewChatAction(userID, tgbotapi.ChatUploadDocument)); isForbidden(err) {
+			fail(err, tr(settings.Language, "inline.not_started"))
+			return
+		}
+	}
+
+	b.jobs.SetState(job.ID, jobs.StateFetching)
+	linkInfo, err := b.downloader.GetLinkInfo(ctx, result.URL, userIdentifier)
+	if err == nil && len(linkInfo.Tracks) == 0 {
+		err = errors.New("link has no tracks")
+	}
+	if err != nil {
+		fail(err, failText(err))
+		return
+	}
+	trackInfo := linkInfo.Tracks[0]
+	b.jobs.SetTitle(job.ID, trackInfo.Title)
+
+	spec := mediaSpec(settings, downloader.AudioOnly)
+	source := cacheSource(trackInfo, result.URL)
+	cacheKey := cache.Key(source, downloadTypeKey(spec.Type), spec.Key())
+	if entry, ok := b.cachedFileID(cacheKey); ok {
+		if err := b.editInlineMedia(inlineMessageID, mediaKind(entry.MediaKind), entry.FileID, trackInfo, settings.Caption); err == nil {
+			b.jobs.Finish(job.ID, nil)
+			b.audit(userID, "download_cached", job.ID+" "+result.URL)
+			return
+		}
+		log.Printf("[%s] Cached file ID for %s was rejected: %v. Removing entry.", userIdentifier, cacheKey, err)
+		b.fileCache.Delete(cacheKey)
+	}
+
+	b.jobs.SetState(job.ID, jobs.StateDownloading)
+	filePath, actualExt, err := b.downloader.DownloadMedia(ctx, trackDownloadURL(trackInfo, result.URL), userIdentifier, spec, trackInfo, nil)
+	if err != nil {
+		fail(err, failText(err))
+		return
+	}
+	defer b.downloader.RemoveDownload(filePath)
+
+	kind := mediaKindFor(spec.Type, actualExt)
+	if stat, err := os.Stat(filePath); err != nil {
+		fail(err, failText(err))
+		return
+	} else if stat.Size() > b.uploadLimit(kind) {
+		err := fmt.Errorf("%w: %s is above the upload limit", downloader.ErrTooLarge, formatBytes(stat.Size()))
+		fail(err, failText(err))
+		return
+	}
+
+	b.jobs.SetState(job.ID, jobs.StateUploading)
+	uploadChatID := b.cfg.InlineUploadChatID
+	if uploadChatID == 0 {
+		uploadChatID = userID
+	}
+	sentMedia, err := b.sendMediaFile(uploadChatID, 0, kind, b.uploadFile(filePath, trackInfo), trackInfo, false)
+	if err != nil {
+		text := tr(settings.Language, "inline.upload_failed")
+		if b.cfg.InlineUploadChatID == 0 && isForbidden(err) {
+			text = tr(settings.Language, "inline.not_started")
+		}
+		fail(err, text)
+		return
+	}
+	if b.cfg.InlineUploadChatID == 0 {
+		if _, err := b.api.Request(tgbotapi.NewDeleteMessage(uploadChatID, sentMedia.MessageID)); err != nil {
+			log.Printf("[%s] Error deleting inline upload message %d: %v", userIdentifier, sentMedia.MessageID, err)
+		}
+	}
+	fileID := fileIDFromMessage(sentMedia, kind)
+	b.rememberFileID(cacheKey, source, kind, sentMedia, trackInfo)
+
+	if err := b.editInlineMedia(inlineMessageID, kind, fileID, trackInfo, settings.Caption); err != nil {
+		fail(err, failText(err))
+		return
+	}
+	log.Printf("[%s] Inline result %s sent.", userIdentifier, result.URL)
+	b.jobs.Finish(job.ID, nil)
+	b.audit(userID, "download", job.ID+" "+result.URL)
+}
@@ -0,0 +1,30 @@
+package bot
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/config"
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+)
+
+func TestInlineAnswersAreCapped(t *testing.T) {
+	_, api := newFakeTelegram(t)
+	b := &Bot{api: api, cfg: &config.Config{}, store: store.NewMemory()}
+
+	// Two sites with SEARCH_RESULTS=30 give 60 results.
+	var results []downloader.SearchResult
+	for i := range 60 {
+		results = append(results, downloader.SearchResult{Site: downloader.SearchYouTube, Title: "Song " + strconv.Itoa(i), URL: "https://youtu.be/" + strconv.Itoa(i)})
+	}
+	answers, cached := b.inlineAnswers(store.Settings{Language: "en"}, "token", results)
+	if len(answers) != maxInlineResults || cached != 0 {
+		t.Errorf("got %d answers, %d cached, want %d answers, none cached", len(answers), cached, maxInlineResults)
+	}
+
+	answers, _ = b.inlineAnswers(store.Settings{Language: "en"}, "token", results[:3])
+	if len(answers) != 3 {
+		t.Errorf("got %d answers for 3 results, want 3", len(answers))
+	}
+}
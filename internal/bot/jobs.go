@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/jobs"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func isControlUpdate(update tgbotapi.Update) bool {
+	if update.CallbackQuery != nil {
+		return strings.HasPrefix(update.CallbackQuery.Data, "jobcancel:") || strings.HasPrefix(update.CallbackQuery.Data, "settings:")
+	}
+	if update.Message != nil && update.Message.IsCommand() {
+		switch update.Message.Command() {
+		case "queue", "cancel", "settings":
+			return true
+		}
+	}
+	return false
+}
+
+// queuedJob is the job created for an update when it was queued. The first
+// download the update starts takes it over; when it starts none, the job is
+// discarded once the update has been handled.
+type queuedJob struct {
+	job   *jobs.Job
+	ctx   context.Context
+	taken bool
+}
+
+// mayStartJob reports whether handling the update can start a download.
+func mayStartJob(update tgbotapi.Update) bool {
+	if update.Message != nil {
+		return update.Message.Text != "" && !update.Message.IsCommand()
+	}
+	if update.CallbackQuery != nil {
+		prefix, _, _ := strings.Cut(update.CallbackQuery.Data, ":")
+		switch prefix {
+		case "dlalbum", "spotifyalbum", "dlaudio", "dltype", "dlres", "dlsearch", "dlbatch":
+			return true
+		}
+		return false
+	}
+	return update.ChosenInlineResult != nil && update.ChosenInlineResult.InlineMessageID != ""
+}
+
+// queueJob creates the job of an update that is about to be queued. It shows
+// the link or text of the update until the handler knows more.
+func (b *Bot) queueJob(chatID, userID int64, update tgbotapi.Update) *queuedJob {
+	url := ""
+	switch {
+	case update.Message != nil:
+		url = update.Message.Text
+	case update.CallbackQuery != nil:
+		parts := strings.Split(update.CallbackQuery.Data, ":")
+		if session, err := b.store.GetSession(context.Background(), parts[len(parts)-1]); err == nil {
+			url = session.URL
+		}
+	case update.ChosenInlineResult != nil:
+		url = update.ChosenInlineResult.Query
+	}
+	return b.newQueuedJob(chatID, userID, url)
+}
+
+func (b *Bot) newQueuedJob(chatID, userID int64, url string) *queuedJob {
+	job, ctx := b.jobs.Create(context.Background(), userID, chatID, jobs.KindSingle, "", url)
+	return &queuedJob{job: job, ctx: ctx}
+}
+
+// takeJob returns the queued job of the update for the first download it
+// starts, and a new job for any further ones.
+func (b *Bot) takeJob(queued *queuedJob, userID, chatID int64, kind jobs.Kind, title, url string) (*jobs.Job, context.Context) {
+	if queued != nil && !queued.taken {
+		queued.taken = true
+		if job, ok := b.jobs.Assign(queued.job.ID, kind, title, url); ok {
+			return job, queued.ctx
+		}
+	}
+	return b.jobs.Create(context.Background(), userID, chatID, kind, title, url)
+}
+
+// queuedContext is the context the handler of an update runs with, so
+// cancelling the queued job also stops fetching link info.
+func queuedContext(queued *queuedJob) context.Context {
+	if queued == nil {
+		return context.Background()
+	}
+	return queued.ctx
+}
+
+func (b *Bot) releaseQueuedJob(queued *queuedJob) {
+	if queued != nil && !queued.taken {
+		b.jobs.Discard(queued.job.ID)
+	}
+}
+
+func jobStateLabel(lang string, state jobs.State) string {
+	switch state {
+	case jobs.StateQueued, jobs.StateFetching, jobs.StateDownloading, jobs.StateUploading,
+		jobs.StateDone, jobs.StateFailed, jobs.StateCancelled, jobs.StateInterrupted:
+		return tr(lang, "job."+string(state))
+	}
+	return string(state)
+}
+
+func cancelKeyboard(lang string, jobID string) tgbotapi.InlineKeyboardMarkup {
+	cancelButton := tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.cancel_job"), "jobcancel:"+jobID)
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(cancelButton))
+}
+
+// jobLanguage returns the language of the user who owns the job.
+func (b *Bot) jobLanguage(jobID string) string {
+	job, ok := b.jobs.Get(jobID)
+	if !ok {
+		return ""
+	}
+	return b.userSettings(job.UserID).Language
+}
+
+func (b *Bot) statusEdit(chatID int64, messageID int, text string, jobID string) tgbotapi.EditMessageTextConfig {
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	editMsg.ParseMode = tgbotapi.ModeMarkdownV2
+	if jobID != "" {
+		keyboard := cancelKeyboard(b.jobLanguage(jobID), jobID)
+		editMsg.ReplyMarkup = &keyboard
+	}
+	return editMsg
+}
+
+func (b *Bot) queueListText(userID int64) string {
+	userJobs := b.jobs.ListByUser(userID)
+	lang := b.userSettings(userID).Language
+	if len(userJobs) == 0 {
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "job.list_empty"))
+	}
+	var sb strings.Builder
+	sb.WriteString(tr(lang, "job.list_title"))
+	for _, job := range userJobs {
+		title := job.Title
+		if title == "" {
+			title = job.URL
+		}
+		sb.WriteString(fmt.Sprintf("🆔 `%s` \\| %s\n%s\n\n", job.ID, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, jobStateLabel(lang, job.State)), tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, title)))
+	}
+	sb.WriteString(tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "job.list_hint")))
+	return sb.String()
+}
+
+func (b *Bot) cancelJobText(userID int64, args string) string {
+	lang := b.userSettings(userID).Language
+	jobID := strings.TrimSpace(args)
+	if jobID == "" {
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, tr(lang, "job.cancel_usage"))
+	}
+	if err := b.jobs.Cancel(jobID, userID); err != nil {
+		log.Printf("User %d could not cancel job %s: %v", userID, jobID, err)
+		return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, cancelErrorText(lang, err))
+	}
+	log.Printf("User %d cancelled job %s", userID, jobID)
+	b.audit(userID, "job_cancel", jobID)
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, fmt.Sprintf(tr(lang, "job.cancel_done"), jobID))
+}
+
+func cancelErrorText(lang string, err error) string {
+	switch {
+	case errors.Is(err, jobs.ErrAlreadyFinished):
+		return tr(lang, "job.already_finished")
+	case errors.Is(err, jobs.ErrNotFound), errors.Is(err, jobs.ErrNotOwner):
+		return tr(lang, "job.not_found")
+	}
+	return tr(lang, "job.cancel_failed")
+}
+
+func (b *Bot) handleJobCancelCallback(callback *tgbotapi.CallbackQuery, userIdentifier string) {
+	jobID := strings.TrimPrefix(callback.Data, "jobcancel:")
+	lang := b.userSettings(callback.From.ID).Language
+	if err := b.jobs.Cancel(jobID, callback.From.ID); err != nil {
+		log.Printf("[%s] Cancel button for job %s failed: %v", userIdentifier, jobID, err)
+		b.api.Send(tgbotapi.NewCallback(callback.ID, cancelErrorText(lang, err)))
+		return
+	}
+	log.Printf("[%s] Job %s cancelled via inline button.", userIdentifier, jobID)
+	b.audit(callback.From.ID, "job_cancel", jobID)
+	b.api.Send(tgbotapi.NewCallback(callback.ID, tr(lang, "job.cancelled_alert")))
+	if callback.Message != nil {
+		b.api.Send(tgbotapi.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+	}
+}
@@ -0,0 +1,33 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestMayStartJob(t *testing.T) {
+	command := &tgbotapi.Message{Text: "/queue", Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 6}}}
+	tests := []struct {
+		name   string
+		update tgbotapi.Update
+		want   bool
+	}{
+		{"link", tgbotapi.Update{Message: &tgbotapi.Message{Text: "https://example.com/a"}}, true},
+		{"command", tgbotapi.Update{Message: command}, false},
+		{"photo without text", tgbotapi.Update{Message: &tgbotapi.Message{}}, false},
+		{"download type", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: "dltype:audio:token"}}, true},
+		{"album", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: "spotifyalbum:yes:token"}}, true},
+		{"settings", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: "settings:lang:en"}}, false},
+		{"formats menu", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: "dlformats:show:token"}}, false},
+		{"chosen placeholder", tgbotapi.Update{ChosenInlineResult: &tgbotapi.ChosenInlineResult{InlineMessageID: "abc"}}, true},
+		{"chosen cached audio", tgbotapi.Update{ChosenInlineResult: &tgbotapi.ChosenInlineResult{}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mayStartJob(tt.update); got != tt.want {
+				t.Errorf("mayStartJob() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
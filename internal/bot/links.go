@@ -0,0 +1,202 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const sessionKindBatch = "batch"
+
+// linkPattern finds links in text where Telegram marked none.
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'«»]+`)
+
+type batchPayload struct {
+	URLs []string `json:"urls"`
+}
+
+// entityText returns the part of text an entity covers. Entity offsets count
+// UTF-16 code units, not bytes.
+func entityText(text string, entity tgbotapi.MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if entity.Offset < 0 || entity.Length <= 0 || entity.Offset+entity.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[entity.Offset : entity.Offset+entity.Length]))
+}
+
+// textLinks lists the links of a text with its entities, falling back to a
+// plain search when no entity is a link. Other entities such as bold text do
+// not stop the search.
+func textLinks(text string, entities []tgbotapi.MessageEntity) []string {
+	var links []string
+	for _, entity := range entities {
+		switch {
+		case entity.IsURL():
+			links = append(links, entityText(text, entity))
+		case entity.IsTextLink():
+			links = append(links, entity.URL)
+		}
+	}
+	if len(links) == 0 {
+		links = linkPattern.FindAllString(text, -1)
+	}
+	return links
+}
+
+// linkKey identifies a link for de-duplication, ignoring the letter case of
+// the scheme and host, a trailing slash and the fragment.
+func linkKey(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment, u.RawFragment = "", ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u.String()
+}
+
+// extractLinks collects the links of a message from its text and the caption
+// of forwarded media. A text reply without links of its own takes those of
+// the message it replies to, unless a bot sent that one. Duplicates are
+// dropped and at most limit links are returned.
+func extractLinks(message *tgbotapi.Message, limit int) []string {
+	links := textLinks(message.Text, message.Entities)
+	links = append(links, textLinks(message.Caption, message.CaptionEntities)...)
+	if reply := message.ReplyToMessage; len(links) == 0 && message.Text != "" && reply != nil && (reply.From == nil || !reply.From.IsBot) {
+		links = textLinks(reply.Text, reply.Entities)
+		links = append(links, textLinks(reply.Caption, reply.CaptionEntities)...)
+	}
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, link := range links {
+		link = strings.TrimRight(strings.TrimSpace(link), ".,;:!?)]}")
+		if link == "" || seen[linkKey(link)] {
+			continue
+		}
+		seen[linkKey(link)] = true
+		unique = append(unique, link)
+	}
+	if limit > 0 && len(unique) > limit {
+		log.Printf("Message %d has %d links. Keeping the first %d.", message.MessageID, len(unique), limit)
+		unique = unique[:limit]
+	}
+	return unique
+}
+
+func isSpotifyLink(link string) bool {
+	return strings.Contains(link, "spotify.com")
+}
+
+// routeLink handles a single link as if it were the whole message.
+func (b *Bot) routeLink(queued *queuedJob, message *tgbotapi.Message, link string, defaultType string, userName string, userID int64, fromFirstName string) {
+	linkMessage := *message
+	linkMessage.Text = link
+	if isSpotifyLink(link) {
+		b.handleSpotifyLink(queued, &linkMessage, userName, userID, fromFirstName)
+		return
+	}
+	b.handleLink(queued, &linkMessage, defaultType, userName, userID, fromFirstName)
+}
+
+// handleBatch asks how to download the links of a message that has several.
+func (b *Bot) handleBatch(message *tgbotapi.Message, links []string, userName string, userID int64) {
+	chatID := message.Chat.ID
+	lang := b.userSettings(userID).Language
+	log.Printf("[%s (%d)] Received %d links in one message.", userName, userID, len(links))
+
+	token, err := b.newSession(sessionKindBatch, userID, chatID, message.MessageID, links[0], batchPayload{URLs: links})
+	if err != nil {
+		log.Printf("[%s (%d)] Error creating session for batch: %v", userName, userID, err)
+		b.api.Send(tgbotapi.NewMessage(chatID, tr(lang, "error.internal")))
+		return
+	}
+
+	var list strings.Builder
+	for i, link := range links {
+		fmt.Fprintf(&list, "%d. %s\n", i+1, link)
+	}
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf(tr(lang, "batch.found"), len(links), strings.TrimSpace(list.String())))
+	msg.ReplyToMessageID = message.MessageID
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.batch_audio"), "dlbatch:audio:"+token),
+			tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.batch_video"), "dlbatch:video:"+token),
+		),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.batch_each"), "dlbatch:each:"+token)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.cancel"), "dlbatch:no:"+token)),
+	)
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("[%s (%d)] Error sending batch choice message: %v", userName, userID, err)
+	}
+}
+
+func (b *Bot) handleBatchCallback(queued *queuedJob, callback *tgbotapi.CallbackQuery, action string, token string, userName string, userID int64, fromFirstName string) {
+	userIdentifier := userName + "_" + strconv.FormatInt(userID, 10)
+	chatID := callback.Message.Chat.ID
+	session, ok := b.loadSession(callback, token, sessionKindBatch)
+	if !ok {
+		return
+	}
+	b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+	b.deleteSession(token)
+	if action == "no" {
+		log.Printf("[%s] User cancelled batch download.", userIdentifier)
+		b.api.Send(tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID))
+		return
+	}
+	var payload batchPayload
+	if err := json.Unmarshal(session.Payload, &payload); err != nil {
+		log.Printf("[%s] Error decoding batch session %s: %v", userIdentifier, token, err)
+		return
+	}
+
+	defaultType := ""
+	if action == "audio" || action == "video" {
+		defaultType = action
+	}
+	// Each link is queued on the chat lane as a job of its own, so it shows
+	// in /queue and can be cancelled alone. Replies go to the message that
+	// carried the links.
+	original := &tgbotapi.Message{MessageID: session.MessageID, Chat: callback.Message.Chat, From: callback.From}
+	var added, skipped []string
+	for _, link := range payload.URLs {
+		item := laneItem{
+			userID: userID,
+			job:    b.newQueuedJob(chatID, userID, link),
+			resume: &resumeData{ReplyTo: session.MessageID, URL: link, UserName: userName, FirstName: fromFirstName, Queued: true, DefaultType: defaultType},
+		}
+		item.run = func(job *queuedJob) {
+			log.Printf("[%s] Processing batch link: %s", userIdentifier, link)
+			b.routeLink(job, original, link, defaultType, userName, userID, fromFirstName)
+		}
+		if _, accepted := b.dispatcher.submit(chatID, item); !accepted {
+			b.jobs.Discard(item.job.job.ID)
+			skipped = append(skipped, link)
+			continue
+		}
+		added = append(added, link)
+	}
+	log.Printf("[%s] Queued %d links of the batch, skipped %d.", userIdentifier, len(added), len(skipped))
+
+	lang := b.userSettings(userID).Language
+	text := fmt.Sprintf(tr(lang, "batch.started"), len(added))
+	if len(skipped) > 0 {
+		text += "\n\n" + fmt.Sprintf(tr(lang, "batch.skipped"), len(skipped), strings.Join(skipped, "\n"))
+	}
+	edit := tgbotapi.NewEditMessageText(chatID, callback.Message.MessageID, text)
+	edit.DisableWebPagePreview = true
+	b.api.Send(edit)
+}
@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func urlEntity(offset, length int) tgbotapi.MessageEntity {
+	return tgbotapi.MessageEntity{Type: "url", Offset: offset, Length: length}
+}
+
+func TestEntityText(t *testing.T) {
+	// "سلام " is five UTF-16 units and the emoji two, so the link starts at 8.
+	text := "سلام 🎵 https://youtu.be/abc"
+	tests := []struct {
+		name   string
+		entity tgbotapi.MessageEntity
+		want   string
+	}{
+		{"after persian and emoji", urlEntity(8, 20), "https://youtu.be/abc"},
+		{"emoji", urlEntity(5, 2), "🎵"},
+		{"past the end", urlEntity(8, 21), ""},
+		{"negative offset", urlEntity(-1, 3), ""},
+		{"empty", urlEntity(3, 0), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := entityText(text, tt.entity); got != tt.want {
+				t.Errorf("entityText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	user := &tgbotapi.User{ID: 1, FirstName: "Sara"}
+	bot := &tgbotapi.User{ID: 2, FirstName: "Zebio", IsBot: true}
+	tests := []struct {
+		name    string
+		message *tgbotapi.Message
+		limit   int
+		want    []string
+	}{
+		{
+			name: "url entity after persian text and emoji",
+			message: &tgbotapi.Message{
+				Text:     "سلام 🎵 https://youtu.be/abc و https://soundcloud.com/a/b",
+				Entities: []tgbotapi.MessageEntity{urlEntity(8, 20), urlEntity(31, 26)},
+			},
+			want: []string{"https://youtu.be/abc", "https://soundcloud.com/a/b"},
+		},
+		{
+			name: "text link",
+			message: &tgbotapi.Message{
+				Text:     "این آهنگ رو ببین",
+				Entities: []tgbotapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 8, URL: "https://youtu.be/xyz"}},
+			},
+			want: []string{"https://youtu.be/xyz"},
+		},
+		{
+			name:    "text without entities",
+			message: &tgbotapi.Message{Text: "listen to https://youtu.be/abc now"},
+			want:    []string{"https://youtu.be/abc"},
+		},
+		{
+			name: "bold entity and a bare link",
+			message: &tgbotapi.Message{
+				Text:     "new song https://youtu.be/abc",
+				Entities: []tgbotapi.MessageEntity{{Type: "bold", Offset: 0, Length: 8}},
+			},
+			want: []string{"https://youtu.be/abc"},
+		},
+		{
+			name: "caption",
+			message: &tgbotapi.Message{
+				Caption:         "🎧 https://soundcloud.com/a/b",
+				CaptionEntities: []tgbotapi.MessageEntity{urlEntity(3, 26)},
+			},
+			want: []string{"https://soundcloud.com/a/b"},
+		},
+		{
+			name: "reply to a user's message",
+			message: &tgbotapi.Message{
+				Text:           "این رو دانلود کن",
+				ReplyToMessage: &tgbotapi.Message{From: user, Text: "https://youtu.be/abc"},
+			},
+			want: []string{"https://youtu.be/abc"},
+		},
+		{
+			name: "reply to the bot's message",
+			message: &tgbotapi.Message{
+				Text:           "این رو دانلود کن",
+				ReplyToMessage: &tgbotapi.Message{From: bot, Text: "https://youtu.be/abc"},
+			},
+			want: nil,
+		},
+		{
+			name: "reply with a link of its own",
+			message: &tgbotapi.Message{
+				Text:           "https://youtu.be/own",
+				ReplyToMessage: &tgbotapi.Message{From: user, Text: "https://youtu.be/abc"},
+			},
+			want: []string{"https://youtu.be/own"},
+		},
+		{
+			name: "duplicates",
+			message: &tgbotapi.Message{
+				Text: "https://YouTu.be/abc https://youtu.be/abc/ https://youtu.be/abc#t=1 https://youtu.be/abc?t=1",
+			},
+			want: []string{"https://YouTu.be/abc", "https://youtu.be/abc?t=1"},
+		},
+		{
+			name:    "trailing punctuation",
+			message: &tgbotapi.Message{Text: "(https://youtu.be/abc), https://youtu.be/def!"},
+			want:    []string{"https://youtu.be/abc", "https://youtu.be/def"},
+		},
+		{
+			name:    "limit",
+			message: &tgbotapi.Message{Text: "https://a.com/1 https://a.com/2 https://a.com/3"},
+			limit:   2,
+			want:    []string{"https://a.com/1", "https://a.com/2"},
+		},
+		{
+			name:    "no links",
+			message: &tgbotapi.Message{Text: "Mr.Bean"},
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractLinks(tt.message, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractLinks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/cache"
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type mediaKind string
+
+const (
+	mediaAudio    mediaKind = "audio"
+	mediaVideo    mediaKind = "video"
+	mediaPhoto    mediaKind = "photo"
+	mediaDocument mediaKind = "document"
+)
+
+func mediaKindFor(dlType downloader.DownloadType, actualExt string) mediaKind {
+	switch {
+	case actualExt == "mp3" || actualExt == "m4a":
+		return mediaAudio
+	case dlType == downloader.AudioOnly:
+		// sendAudio only plays mp3 and m4a; other formats go out as files.
+		return mediaDocument
+	case dlType == downloader.VideoBest || actualExt == "mp4" || actualExt == "mkv" || actualExt == "webm":
+		return mediaVideo
+	case dlType == downloader.ImageBest || actualExt == "jpg" || actualExt == "jpeg" || actualExt == "webp" || actualExt == "png":
+		return mediaPhoto
+	}
+	return mediaDocument
+}
+
+func downloadTypeKey(dlType downloader.DownloadType) string {
+	switch dlType {
+	case downloader.AudioOnly:
+		return "audio"
+	case downloader.VideoBest:
+		return "video"
+	case downloader.ImageBest:
+		return "photo"
+	}
+	return "unknown"
+}
+
+// mediaCaption is the MarkdownV2 caption of a sent file.
+func (b *Bot) mediaCaption(kind mediaKind, trackInfo *downloader.TrackInfo) string {
+	escapedArtist := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, trackInfo.Artist)
+	escapedTitle := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, trackInfo.Title)
+	escapedBotUsernameMention := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, "@"+b.api.Self.UserName)
+	icon := "📄"
+	switch kind {
+	case mediaAudio:
+		icon = "🎵"
+	case mediaVideo:
+		icon = "🎬"
+	case mediaPhoto:
+		icon = "🖼️"
+	}
+	return fmt.Sprintf("%s *%s*\n👤 _%s_\n\n%s", icon, escapedTitle, escapedArtist, escapedBotUsernameMention)
+}
+
+func (b *Bot) sendMediaFile(chatID int64, replyToMessageID int, kind mediaKind, file tgbotapi.RequestFileData, trackInfo *downloader.TrackInfo, withCaption bool) (tgbotapi.Message, error) {
+	switch kind {
+	case mediaAudio:
+		audioFile := tgbotapi.NewAudio(chatID, file)
+		audioFile.ReplyToMessageID = replyToMessageID
+		audioFile.Title = trackInfo.Title
+		audioFile.Performer = trackInfo.Artist
+		if withCaption {
+			audioFile.Caption = b.mediaCaption(kind, trackInfo)
+		}
+		audioFile.ParseMode = tgbotapi.ModeMarkdownV2
+		return b.api.Send(audioFile)
+	case mediaVideo:
+		videoFile := tgbotapi.NewVideo(chatID, file)
+		videoFile.ReplyToMessageID = replyToMessageID
+		if withCaption {
+			videoFile.Caption = b.mediaCaption(kind, trackInfo)
+		}
+		videoFile.ParseMode = tgbotapi.ModeMarkdownV2
+		return b.api.Send(videoFile)
+	case mediaPhoto:
+		photoFile := tgbotapi.NewPhoto(chatID, file)
+		photoFile.ReplyToMessageID = replyToMessageID
+		if withCaption {
+			photoFile.Caption = b.mediaCaption(kind, trackInfo)
+		}
+		photoFile.ParseMode = tgbotapi.ModeMarkdownV2
+		return b.api.Send(photoFile)
+	default:
+		docFile := tgbotapi.NewDocument(chatID, file)
+		docFile.ReplyToMessageID = replyToMessageID
+		if withCaption {
+			docFile.Caption = b.mediaCaption(kind, trackInfo)
+		}
+		docFile.ParseMode = tgbotapi.ModeMarkdownV2
+		return b.api.Send(docFile)
+	}
+}
+
+func fileIDFromMessage(msg tgbotapi.Message, kind mediaKind) string {
+	switch kind {
+	case mediaAudio:
+		if msg.Audio != nil {
+			return msg.Audio.FileID
+		}
+	case mediaVideo:
+		if msg.Video != nil {
+			return msg.Video.FileID
+		}
+	case mediaPhoto:
+		if len(msg.Photo) > 0 {
+			return msg.Photo[len(msg.Photo)-1].FileID
+		}
+	}
+	if msg.Document != nil {
+		return msg.Document.FileID
+	}
+	return ""
+}
+
+func cacheSource(trackInfo *downloader.TrackInfo, fallbackURL string) string {
+	source := cache.Source(trackInfo.Extractor, trackInfo.ID, trackInfo.OriginalURL)
+	if source == "" {
+		source = fallbackURL
+	}
+	return source
+}
+
+func (b *Bot) cachedFileID(cacheKey string) (cache.Entry, bool) {
+	if b.fileCache == nil || cacheKey == "" {
+		return cache.Entry{}, false
+	}
+	return b.fileCache.Get(cacheKey)
+}
+
+func (b *Bot) rememberFileID(cacheKey, source string, kind mediaKind, msg tgbotapi.Message, trackInfo *downloader.TrackInfo) {
+	if b.fileCache == nil || cacheKey == "" {
+		return
+	}
+	fileID := fileIDFromMessage(msg, kind)
+	if fileID == "" {
+		return
+	}
+	b.fileCache.Put(cache.Entry{
+		Key:         cacheKey,
+		Source:      source,
+		OriginalURL: trackInfo.OriginalURL,
+		FileID:      fileID,
+		MediaKind:   string(kind),
+		Title:       trackInfo.Title,
+		Artist:      trackInfo.Artist,
+	})
+}
+
+// sendCachedMedia answers from the file ID cache. It returns false when there
+// is no usable entry, dropping entries Telegram no longer accepts.
+func (b *Bot) sendCachedMedia(chatID int64, replyToMessageID int, cacheKey string, trackInfo *downloader.TrackInfo, withCaption bool, userIdentifier string) bool {
+	entry, ok := b.cachedFileID(cacheKey)
+	if !ok {
+		return false
+	}
+	log.Printf("[%s] Cache hit for %s. Re-sending file ID.", userIdentifier, cacheKey)
+	if _, err := b.sendMediaFile(chatID, replyToMessageID, mediaKind(entry.MediaKind), tgbotapi.FileID(entry.FileID), trackInfo, withCaption); err != nil {
+		log.Printf("[%s] Cached file ID for %s was rejected: %v. Removing entry.", userIdentifier, cacheKey, err)
+		b.fileCache.Delete(cacheKey)
+		return false
+	}
+	return true
+}
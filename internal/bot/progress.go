@@ -0,0 +1,206 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const progressBarWidth = 12
+
+// progressReporter turns downloader progress into edits of a status message,
+// throttled so Telegram's edit rate limits are not hit. Updates only record
+// the latest progress; the edits are sent from the reporter's own goroutine so
+// a slow Telegram request never holds up the download's output.
+type progressReporter struct {
+	bot       *Bot
+	chatID    int64
+	messageID int
+	jobID     string
+	lang      string
+	header    string
+	interval  time.Duration
+
+	mu     sync.Mutex
+	latest downloader.Progress
+
+	wake      chan struct{}
+	done      chan struct{}
+	finished  chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+	started   bool
+
+	lastText  string
+	lastPhase downloader.ProgressPhase
+}
+
+func (b *Bot) newProgressReporter(chatID int64, messageID int, jobID string, lang string, header string) *progressReporter {
+	return &progressReporter{
+		bot:       b,
+		chatID:    chatID,
+		messageID: messageID,
+		jobID:     jobID,
+		lang:      lang,
+		header:    header,
+		interval:  b.cfg.ProgressEditInterval,
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		finished:  make(chan struct{}),
+	}
+}
+
+// callback starts the reporter and returns the function to pass to the
+// downloader. Every reporter whose callback was taken must be stopped.
+func (r *progressReporter) callback() downloader.ProgressFunc {
+	if r == nil || r.messageID == 0 {
+		return nil
+	}
+	r.startOnce.Do(func() {
+		r.started = true
+		go r.run()
+	})
+	return r.update
+}
+
+// stop ends the reporter and waits for an edit in flight, so it cannot
+// overwrite what is sent to the status message next.
+func (r *progressReporter) stop() {
+	if r == nil {
+		return
+	}
+	r.startOnce.Do(func() {})
+	if !r.started {
+		return
+	}
+	r.stopOnce.Do(func() { close(r.done) })
+	<-r.finished
+}
+
+func (r *progressReporter) update(p downloader.Progress) {
+	r.mu.Lock()
+	r.latest = p
+	r.mu.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *progressReporter) current() downloader.Progress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.latest
+}
+
+func (r *progressReporter) run() {
+	defer close(r.finished)
+	var nextEdit time.Time
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.wake:
+		}
+		p := r.current()
+		urgent := p.Phase == downloader.PhasePostProcessing && r.lastPhase != downloader.PhasePostProcessing
+		if wait := time.Until(nextEdit); wait > 0 && !urgent {
+			timer := time.NewTimer(wait)
+			select {
+			case <-r.done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			p = r.current()
+		}
+		if next, ok := r.edit(p); ok {
+			nextEdit = next
+		}
+	}
+}
+
+// edit sends p unless the text would not change. It returns when the next
+// edit may be sent.
+func (r *progressReporter) edit(p downloader.Progress) (time.Time, bool) {
+	r.lastPhase = p.Phase
+	text := r.header + "\n\n" + tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, formatProgress(r.lang, p))
+	if text == r.lastText {
+		return time.Time{}, false
+	}
+
+	now := time.Now()
+	_, err := r.bot.api.Send(r.bot.statusEdit(r.chatID, r.messageID, text, r.jobID))
+	if err != nil {
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			log.Printf("Progress edit for chat %d rate limited. Retrying after %ds.", r.chatID, apiErr.RetryAfter)
+			return now.Add(time.Duration(apiErr.RetryAfter) * time.Second), true
+		}
+		return now.Add(r.interval), true
+	}
+	r.lastText = text
+	return now.Add(r.interval), true
+}
+
+func formatProgress(lang string, p downloader.Progress) string {
+	if p.Phase == downloader.PhasePostProcessing {
+		return fmt.Sprintf("%s 100%%\n%s", progressBar(100), tr(lang, "progress.post_processing"))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s %.1f%%", progressBar(p.Percent), p.Percent))
+	if p.TotalBytes > 0 {
+		sb.WriteString(fmt.Sprintf("\n📦 %s / %s", formatBytes(p.DownloadedBytes), formatBytes(p.TotalBytes)))
+	} else if p.DownloadedBytes > 0 {
+		sb.WriteString(fmt.Sprintf("\n📦 %s", formatBytes(p.DownloadedBytes)))
+	}
+	if p.Speed > 0 {
+		sb.WriteString(fmt.Sprintf("\n🚀 %s/s", formatBytes(int64(p.Speed))))
+	}
+	if p.ETA > 0 {
+		sb.WriteString(fmt.Sprintf("\n⏱ %s", formatETA(p.ETA)))
+	}
+	return sb.String()
+}
+
+func progressBar(percent float64) string {
+	filled := int(percent / 100 * progressBarWidth)
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	if filled < 0 {
+		filled = 0
+	}
+	return strings.Repeat("▓", filled) + strings.Repeat("░", progressBarWidth-filled)
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func formatETA(eta time.Duration) string {
+	eta = eta.Round(time.Second)
+	minutes := int(eta / time.Minute)
+	seconds := int((eta % time.Minute) / time.Second)
+	if minutes >= 60 {
+		return fmt.Sprintf("%d:%02d:%02d", minutes/60, minutes%60, seconds)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/config"
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+)
+
+func TestProgressUpdateDoesNotWaitForEdits(t *testing.T) {
+	fake, api := newFakeTelegram(t)
+	hold := make(chan struct{})
+	fake.hold = hold
+	b := &Bot{api: api, cfg: &config.Config{ProgressEditInterval: time.Millisecond}, store: store.NewMemory()}
+	reporter := b.newProgressReporter(1, 10, "", "en", "header")
+	update := reporter.callback()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i <= 100; i++ {
+			update(downloader.Progress{Phase: downloader.PhaseDownloading, Percent: float64(i), DownloadedBytes: int64(i), TotalBytes: 100})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("update blocked while an edit was in flight")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(fake.called("editMessageText")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no edit was sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(hold)
+	reporter.stop()
+	if edits := len(fake.called("editMessageText")); edits < 1 || edits > 3 {
+		t.Errorf("sent %d edits for 101 updates during one slow edit, want 1 to 3", edits)
+	}
+}
+
+func TestProgressStopWithoutCallback(t *testing.T) {
+	b := &Bot{cfg: &config.Config{}}
+	b.newProgressReporter(1, 10, "", "en", "header").stop()
+	var none *progressReporter
+	none.stop()
+}
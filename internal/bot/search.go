@@ -0,0 +1,259 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+	"github.com/Mohammad-Alipour/Zebio/internal/urlguard"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	sessionKindSearch = "search"
+	searchPageSize    = 5
+)
+
+// searchSites are searched together and listed in this order.
+var searchSites = []downloader.SearchSite{downloader.SearchYouTube, downloader.SearchSoundCloud}
+
+type searchPayload struct {
+	Query   string                    `json:"query"`
+	Results []downloader.SearchResult `json:"results"`
+}
+
+// linkSyntax parses text that may be a link. The domain lists and address
+// checks are left to the downloader, so a denied link still gets its error
+// instead of being searched for.
+var linkSyntax = urlguard.New(urlguard.Options{AllowPrivate: true})
+
+// looksLikeLink tells a link without a scheme apart from a search query. A
+// single word with a dot, like "Mr.Bean" or "v1.2", is only taken as a link
+// when its host is an IP address or ends in a known top-level domain.
+func looksLikeLink(text string) bool {
+	u, err := linkSyntax.Normalize(text)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		return true
+	}
+	if !strings.Contains(host, ".") {
+		return false
+	}
+	_, icann := publicsuffix.PublicSuffix(host)
+	return icann
+}
+
+func formatCount(n int64) string {
+	switch {
+	case n >= 1_000_000_000:
+		return fmt.Sprintf("%.1fB", float64(n)/1e9)
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fK", float64(n)/1e3)
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func siteIcon(site downloader.SearchSite) string {
+	if site == downloader.SearchSoundCloud {
+		return "🟠"
+	}
+	return "🔴"
+}
+
+// resultDetails lists the channel, duration and views of a result, leaving
+// out what the site did not report.
+func resultDetails(result downloader.SearchResult) string {
+	var details []string
+	if result.Channel != "" {
+		details = append(details, "👤 "+result.Channel)
+	}
+	if result.Duration > 0 {
+		details = append(details, "⏱ "+formatETA(time.Duration(result.Duration*float64(time.Second))))
+	}
+	if result.Views > 0 {
+		details = append(details, "👁 "+formatCount(result.Views))
+	}
+	return strings.Join(details, " · ")
+}
+
+func searchPageCount(results []downloader.SearchResult) int {
+	return (len(results) + searchPageSize - 1) / searchPageSize
+}
+
+// searchPage renders one page of results with a button per result and the
+// page navigation below them.
+func searchPage(lang string, token string, payload searchPayload, page int) (string, tgbotapi.InlineKeyboardMarkup) {
+	pages := searchPageCount(payload.Results)
+	start := page * searchPageSize
+	end := min(start+searchPageSize, len(payload.Results))
+
+	var text strings.Builder
+	fmt.Fprintf(&text, tr(lang, "search.results"), payload.Query, page+1, pages)
+	var resultRow []tgbotapi.InlineKeyboardButton
+	for i := start; i < end; i++ {
+		result := payload.Results[i]
+		fmt.Fprintf(&text, "\n\n%d. %s %s", i+1, siteIcon(result.Site), result.Title)
+		if details := resultDetails(result); details != "" {
+			text.WriteString("\n    " + details)
+		}
+		resultRow = append(resultRow, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(i+1), fmt.Sprintf("dlsearch:r%d:%s", i, token)))
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{resultRow}
+	var navRow []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.previous"), fmt.Sprintf("dlsearch:p%d:%s", page-1, token)))
+	}
+	if page < pages-1 {
+		navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.next"), fmt.Sprintf("dlsearch:p%d:%s", page+1, token)))
+	}
+	if len(navRow) > 0 {
+		rows = append(rows, navRow)
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(tr(lang, "button.cancel"), "dlsearch:no:"+token)))
+	return text.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// searchAll searches every site at once. A site that fails is left out; the
+// error is only returned together with the results of the others.
+func (b *Bot) searchAll(ctx context.Context, query string, userIdentifier string) ([]downloader.SearchResult, error) {
+	found := make([][]downloader.SearchResult, len(searchSites))
+	errs := make([]error, len(searchSites))
+	var wg sync.WaitGroup
+	for i, site := range searchSites {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found[i], errs[i] = b.downloader.Search(ctx, site, query, b.cfg.SearchResults, userIdentifier)
+		}()
+	}
+	wg.Wait()
+
+	var results []downloader.SearchResult
+	var lastErr error
+	for i, site := range searchSites {
+		if errs[i] != nil {
+			log.Printf("[%s] %s search for '%s' failed: %v", userIdentifier, site, query, errs[i])
+			lastErr = errs[i]
+			continue
+		}
+		results = append(results, found[i]...)
+	}
+	return results, lastErr
+}
+
+// handleSearch searches every site for query and shows the first page of
+// results.
+func (b *Bot) handleSearch(queued *queuedJob, message *tgbotapi.Message, query string, userName string, userID int64) {
+	userIdentifier := userName + "_" + strconv.FormatInt(userID, 10)
+	chatID := message.Chat.ID
+	lang := b.userSettings(userID).Language
+	query = strings.TrimSpace(query)
+	if query == "" {
+		reply := tgbotapi.NewMessage(chatID, tr(lang, "search.usage"))
+		reply.ReplyToMessageID = message.MessageID
+		b.api.Send(reply)
+		return
+	}
+	log.Printf("[%s] Received search query: %s", userIdentifier, query)
+
+	statusMsg := tgbotapi.NewMessage(chatID, tr(lang, "search.searching"))
+	statusMsg.ReplyToMessageID = message.MessageID
+	sentStatusMsg, err := b.api.Send(statusMsg)
+	if err != nil {
+		log.Printf("[%s] Error sending search status message: %v", userIdentifier, err)
+		return
+	}
+
+	results, err := b.searchAll(queuedContext(queued), query, userIdentifier)
+	payload := searchPayload{Query: query, Results: results}
+	if len(payload.Results) == 0 {
+		text := tr(lang, "search.no_results")
+		if err != nil {
+			text = downloadErrorText(lang, err)
+		}
+		b.api.Send(tgbotapi.NewEditMessageText(chatID, sentStatusMsg.MessageID, text))
+		return
+	}
+
+	token, err := b.newSession(sessionKindSearch, userID, chatID, message.MessageID, "", payload)
+	if err != nil {
+		log.Printf("[%s] Error creating session for search: %v", userIdentifier, err)
+		b.api.Send(tgbotapi.NewEditMessageText(chatID, sentStatusMsg.MessageID, tr(lang, "error.internal")))
+		return
+	}
+	text, keyboard := searchPage(lang, token, payload, 0)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, sentStatusMsg.MessageID, text, keyboard)
+	edit.DisableWebPagePreview = true
+	if _, err := b.api.Send(edit); err != nil {
+		log.Printf("[%s] Error sending search results: %v", userIdentifier, err)
+	}
+}
+
+// handleSearchCallback turns the page or starts the download of a result.
+// The session is kept, so more than one result can be picked.
+func (b *Bot) handleSearchCallback(queued *queuedJob, callback *tgbotapi.CallbackQuery, action string, token string, userName string, userID int64, fromFirstName string) {
+	userIdentifier := userName + "_" + strconv.FormatInt(userID, 10)
+	chatID := callback.Message.Chat.ID
+	session, ok := b.loadSession(callback, token, sessionKindSearch)
+	if !ok {
+		return
+	}
+	b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+	if action == "no" {
+		log.Printf("[%s] User closed search results.", userIdentifier)
+		b.deleteSession(token)
+		b.api.Send(tgbotapi.NewDeleteMessage(chatID, callback.Message.MessageID))
+		return
+	}
+	var payload searchPayload
+	if err := json.Unmarshal(session.Payload, &payload); err != nil {
+		log.Printf("[%s] Error decoding search session %s: %v", userIdentifier, token, err)
+		return
+	}
+	if len(action) < 2 {
+		log.Printf("[%s] Malformed search action: %s", userIdentifier, action)
+		return
+	}
+	n, err := strconv.Atoi(action[1:])
+	if err != nil {
+		log.Printf("[%s] Malformed search action: %s", userIdentifier, action)
+		return
+	}
+
+	switch action[0] {
+	case 'p':
+		if n < 0 || n >= searchPageCount(payload.Results) {
+			return
+		}
+		text, keyboard := searchPage(b.userSettings(userID).Language, token, payload, n)
+		edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, callback.Message.MessageID, text, keyboard)
+		edit.DisableWebPagePreview = true
+		b.api.Send(edit)
+	case 'r':
+		if n < 0 || n >= len(payload.Results) {
+			return
+		}
+		result := payload.Results[n]
+		log.Printf("[%s] Picked search result %d: %s", userIdentifier, n+1, result.URL)
+		// Replies go to the message that carried the query.
+		original := &tgbotapi.Message{MessageID: session.MessageID, Chat: callback.Message.Chat, From: callback.From}
+		b.routeLink(queued, original, result.URL, "", userName, userID, fromFirstName)
+	default:
+		log.Printf("[%s] Malformed search action: %s", userIdentifier, action)
+	}
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+)
+
+func searchResults(n int) []downloader.SearchResult {
+	var results []downloader.SearchResult
+	for i := range n {
+		results = append(results, downloader.SearchResult{
+			Site:     downloader.SearchSoundCloud,
+			URL:      "https://soundcloud.com/artist/song-" + strconv.Itoa(i),
+			Title:    "Song " + strconv.Itoa(i),
+			Channel:  "Artist",
+			Duration: 200,
+			Views:    1500,
+		})
+	}
+	return results
+}
+
+func TestSearchPage(t *testing.T) {
+	token, err := newSessionToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		results int
+		page    int
+		// wantResults are the result numbers on the page, wantNav the
+		// callback data of the navigation buttons.
+		wantResults []string
+		wantNav     []string
+	}{
+		{"only page", 3, 0, []string{"1", "2", "3"}, nil},
+		{"first page", 12, 0, []string{"1", "2", "3", "4", "5"}, []string{"dlsearch:p1:" + token}},
+		{"middle page", 12, 1, []string{"6", "7", "8", "9", "10"}, []string{"dlsearch:p0:" + token, "dlsearch:p2:" + token}},
+		{"last page", 12, 2, []string{"11", "12"}, []string{"dlsearch:p1:" + token}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := searchPayload{Query: "سیاوش قمیشی", Results: searchResults(tt.results)}
+			text, keyboard := searchPage("en", token, payload, tt.page)
+
+			pages := searchPageCount(payload.Results)
+			if want := fmt.Sprintf("(page %d of %d)", tt.page+1, pages); !strings.Contains(text, want) {
+				t.Errorf("text %q does not contain %q", text, want)
+			}
+			if !strings.Contains(text, "👤 Artist · ⏱ ") || !strings.Contains(text, "👁 1.5K") {
+				t.Errorf("text %q is missing the result details", text)
+			}
+
+			rows := keyboard.InlineKeyboard
+			var results []string
+			for i, button := range rows[0] {
+				results = append(results, button.Text)
+				if want := fmt.Sprintf("dlsearch:r%d:%s", tt.page*searchPageSize+i, token); *button.CallbackData != want {
+					t.Errorf("result button %s has data %q, want %q", button.Text, *button.CallbackData, want)
+				}
+			}
+			if !reflect.DeepEqual(results, tt.wantResults) {
+				t.Errorf("result buttons %v, want %v", results, tt.wantResults)
+			}
+
+			var nav []string
+			if len(rows) == 3 {
+				for _, button := range rows[1] {
+					nav = append(nav, *button.CallbackData)
+				}
+			}
+			if !reflect.DeepEqual(nav, tt.wantNav) {
+				t.Errorf("navigation buttons %v, want %v", nav, tt.wantNav)
+			}
+			if cancel := rows[len(rows)-1]; len(cancel) != 1 || *cancel[0].CallbackData != "dlsearch:no:"+token {
+				t.Errorf("last row %+v is not the cancel button", cancel)
+			}
+
+			for _, row := range rows {
+				for _, button := range row {
+					if len(*button.CallbackData) > 64 {
+						t.Errorf("callback data %q is longer than 64 bytes", *button.CallbackData)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSearchPageCallbackDataFitsLargestIndex(t *testing.T) {
+	token, err := newSessionToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The longest result index still fits the 64 bytes Telegram allows.
+	payload := searchPayload{Query: "q", Results: searchResults(1000)}
+	_, keyboard := searchPage("en", token, payload, searchPageCount(payload.Results)-1)
+	for _, row := range keyboard.InlineKeyboard {
+		for _, button := range row {
+			if len(*button.CallbackData) > 64 {
+				t.Errorf("callback data %q is longer than 64 bytes", *button.CallbackData)
+			}
+		}
+	}
+}
+
+func TestLooksLikeLink(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"youtube.com/watch?v=abc", true},
+		{"youtu.be/abc", true},
+		{"music.youtube.com", true},
+		{"soundcloud.com/artist/song", true},
+		{"t.me/zebio", true},
+		{"  example.ir  ", true},
+		{"192.168.1.1/song.mp3", true},
+		{"Mr.Bean", false},
+		{"v1.2", false},
+		{"1.2", false},
+		{"file.mp3", false},
+		{"song", false},
+		{"two words.com", false},
+		{"", false},
+		{"ftp://example.com/a", false},
+	}
+	for _, tt := range tests {
+		if got := looksLikeLink(tt.text); got != tt.want {
+			t.Errorf("looksLikeLink(%q) = %t, want %t", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestFormatCount(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1_000, "1.0K"},
+		{1_540, "1.5K"},
+		{1_000_000, "1.0M"},
+		{12_300_000, "12.3M"},
+		{2_500_000_000, "2.5B"},
+	}
+	for _, tt := range tests {
+		if got := formatCount(tt.n); got != tt.want {
+			t.Errorf("formatCount(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	sessionKindLink         = "link"
+	sessionKindAlbum        = "album"
+	sessionKindSpotifyAlbum = "spotify_album"
+)
+
+type spotifyAlbumPayload struct {
+	LinkType string `json:"link_type"`
+	LinkID   string `json:"link_id"`
+}
+
+func newSessionToken() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// newSession stores the state behind an inline keyboard and returns the token
+// that goes into its callback data.
+func (b *Bot) newSession(kind string, userID int64, chatID int64, messageID int, url string, payload interface{}) (string, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session payload: %w", err)
+	}
+	now := time.Now()
+	session := store.Session{
+		Token:     token,
+		Kind:      kind,
+		UserID:    userID,
+		ChatID:    chatID,
+		MessageID: messageID,
+		URL:       url,
+		Payload:   data,
+		CreatedAt: now,
+		ExpiresAt: now.Add(b.cfg.SessionTTL),
+	}
+	if err := b.store.SaveSession(context.Background(), session); err != nil {
+		return "", fmt.Errorf("failed to save session: %w", err)
+	}
+	return token, nil
+}
+
+// loadSession answers the callback with an alert and returns false when the
+// token is unknown, expired, of another kind or belongs to another user.
+func (b *Bot) loadSession(callback *tgbotapi.CallbackQuery, token string, kind string) (store.Session, bool) {
+	lang := b.userSettings(callback.From.ID).Language
+	session, err := b.store.GetSession(context.Background(), token)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Error loading session %s: %v", token, err)
+		}
+		b.api.Send(tgbotapi.NewCallbackWithAlert(callback.ID, tr(lang, "session.expired")))
+		return store.Session{}, false
+	}
+	if session.Kind != kind || time.Now().After(session.ExpiresAt) {
+		b.deleteSession(token)
+		b.api.Send(tgbotapi.NewCallbackWithAlert(callback.ID, tr(lang, "session.expired")))
+		return store.Session{}, false
+	}
+	if session.UserID != callback.From.ID {
+		log.Printf("User %d tapped a button of session %s owned by user %d. Rejecting.", callback.From.ID, token, session.UserID)
+		b.api.Send(tgbotapi.NewCallbackWithAlert(callback.ID, tr(lang, "session.not_yours")))
+		return store.Session{}, false
+	}
+	return session, true
+}
+
+func linkSessionTrack(session store.Session) (*downloader.TrackInfo, error) {
+	var linkInfo downloader.LinkInfo
+	if err := json.Unmarshal(session.Payload, &linkInfo); err != nil {
+		return nil, err
+	}
+	if len(linkInfo.Tracks) == 0 {
+		return nil, errors.New("session has no tracks")
+	}
+	return linkInfo.Tracks[0], nil
+}
+
+func (b *Bot) deleteSession(token string) {
+	if err := b.store.DeleteSession(context.Background(), token); err != nil {
+		log.Printf("Error deleting session %s: %v", token, err)
+	}
+}
+
+func (b *Bot) sweepSessions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		removed, err := b.store.DeleteExpiredSessions(context.Background(), time.Now())
+		if err != nil {
+			log.Printf("Error removing expired sessions: %v", err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("Removed %d expired callback sessions.", removed)
+		}
+	}
+}
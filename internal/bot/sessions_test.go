@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/config"
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestLoadSession(t *testing.T) {
+	const owner, other = 7, 8
+	tests := []struct {
+		name     string
+		token    string
+		kind     string
+		expires  time.Duration
+		from     int64
+		wantOK   bool
+		wantText string
+		// wantKept is whether the session is still stored afterwards.
+		wantKept bool
+	}{
+		{name: "valid", kind: sessionKindLink, expires: time.Hour, from: owner, wantOK: true, wantKept: true},
+		{name: "unknown token", token: "missing", kind: sessionKindLink, expires: time.Hour, from: owner, wantText: "session.expired", wantKept: true},
+		{name: "expired", kind: sessionKindLink, expires: -time.Minute, from: owner, wantText: "session.expired"},
+		{name: "wrong kind", kind: sessionKindSearch, expires: time.Hour, from: owner, wantText: "session.expired"},
+		{name: "wrong owner", kind: sessionKindLink, expires: time.Hour, from: other, wantText: "session.not_yours", wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, api := newFakeTelegram(t)
+			st := store.NewMemory()
+			b := &Bot{api: api, cfg: &config.Config{}, store: st}
+
+			now := time.Now()
+			saved := store.Session{
+				Token:     "token",
+				Kind:      sessionKindLink,
+				UserID:    owner,
+				ChatID:    100,
+				MessageID: 11,
+				CreatedAt: now.Add(-2 * time.Hour),
+				ExpiresAt: now.Add(tt.expires),
+			}
+			if err := st.SaveSession(context.Background(), saved); err != nil {
+				t.Fatal(err)
+			}
+			token := tt.token
+			if token == "" {
+				token = saved.Token
+			}
+
+			callback := &tgbotapi.CallbackQuery{ID: "cb", From: &tgbotapi.User{ID: tt.from}}
+			session, ok := b.loadSession(callback, token, tt.kind)
+			if ok != tt.wantOK {
+				t.Fatalf("loadSession() ok = %t, want %t", ok, tt.wantOK)
+			}
+			if ok && session.Token != saved.Token {
+				t.Errorf("loadSession() returned session %q, want %q", session.Token, saved.Token)
+			}
+
+			answers := fake.called("answerCallbackQuery")
+			if tt.wantOK {
+				if len(answers) != 0 {
+					t.Errorf("answered the callback %d times, want it left to the caller", len(answers))
+				}
+			} else {
+				want := tr(b.userSettings(tt.from).Language, tt.wantText)
+				if len(answers) != 1 || answers[0].params.Get("text") != want || answers[0].params.Get("show_alert") != "true" {
+					t.Errorf("got callback answers %+v, want one alert %q", answers, want)
+				}
+			}
+
+			_, err := st.GetSession(context.Background(), saved.Token)
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("session kept = %t (error %v), want %t", kept, err, tt.wantKept)
+			}
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("GetSession() error = %v, want %v", err, store.ErrNotFound)
+			}
+		})
+	}
+}
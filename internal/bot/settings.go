@@ -0,0 +1,207 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+var (
+	defaultTypeChoices   = []string{"ask", "audio", "video"}
+	audioQualityChoices  = []string{"", "128K", "192K", "256K", "320K", "0", "5"}
+	maxResolutionChoices = []int{0, 1080, 720, 480, 360}
+	languageChoices      = []string{"fa", "en"}
+)
+
+func defaultSettings(userID int64) store.Settings {
+	return store.Settings{
+		UserID:         userID,
+		Language:       "fa",
+		DefaultType:    "ask",
+		AudioFormat:    "mp3",
+		EmbedThumbnail: true,
+		Caption:        true,
+	}
+}
+
+func (b *Bot) userSettings(userID int64) store.Settings {
+	settings, err := b.store.GetSettings(context.Background(), userID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Error loading settings for user %d: %v", userID, err)
+		}
+		return defaultSettings(userID)
+	}
+	defaults := defaultSettings(userID)
+	if settings.Language == "" {
+		settings.Language = defaults.Language
+	}
+	if settings.DefaultType == "" {
+		settings.DefaultType = defaults.DefaultType
+	}
+	if settings.AudioFormat == "" {
+		settings.AudioFormat = defaults.AudioFormat
+	}
+	return settings
+}
+
+func mediaSpec(settings store.Settings, dlType downloader.DownloadType) downloader.MediaSpec {
+	return downloader.MediaSpec{
+		Type:           dlType,
+		AudioFormat:    settings.AudioFormat,
+		AudioQuality:   settings.AudioQuality,
+		MaxHeight:      settings.MaxResolution,
+		EmbedThumbnail: settings.EmbedThumbnail,
+	}
+}
+
+// defaultDownloadType reports the type to download without asking, if the
+// user picked one in /settings and the link offers it.
+func defaultDownloadType(settings store.Settings, trackInfo *downloader.TrackInfo) (downloader.DownloadType, bool) {
+	switch settings.DefaultType {
+	case "audio":
+		if trackInfo.HasVideo || trackInfo.IsAudioOnly {
+			return downloader.AudioOnly, true
+		}
+	case "video":
+		if trackInfo.HasVideo {
+			return downloader.VideoBest, true
+		}
+		if trackInfo.IsAudioOnly {
+			return downloader.AudioOnly, true
+		}
+	}
+	return 0, false
+}
+
+func onOff(lang string, value bool) string {
+	if value {
+		return tr(lang, "value.on")
+	}
+	return tr(lang, "value.off")
+}
+
+func audioFormatLabel(lang string, format string) string {
+	if format == downloader.AudioFormatOriginal {
+		return tr(lang, "value.original")
+	}
+	return format
+}
+
+func audioQualityLabel(lang string, quality string) string {
+	switch {
+	case quality == "":
+		return tr(lang, "value.auto")
+	case strings.HasSuffix(quality, "K"):
+		return strings.ToLower(quality)
+	}
+	return "VBR " + quality
+}
+
+func resolutionLabel(lang string, height int) string {
+	if height == 0 {
+		return tr(lang, "value.best")
+	}
+	return fmt.Sprintf("%dp", height)
+}
+
+func settingsText(settings store.Settings) string {
+	lang := settings.Language
+	text := fmt.Sprintf("%s\n\n%s", tr(lang, "settings.title"), tr(lang, "settings.hint"))
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, text)
+}
+
+func settingsKeyboard(settings store.Settings) tgbotapi.InlineKeyboardMarkup {
+	lang := settings.Language
+	button := func(labelKey string, value string, field string) []tgbotapi.InlineKeyboardButton {
+		label := fmt.Sprintf("%s: %s", tr(lang, labelKey), value)
+		data := fmt.Sprintf("settings:%s:%d", field, settings.UserID)
+		return tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, data))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(
+		button("settings.default_type", tr(lang, "value."+settings.DefaultType), "type"),
+		button("settings.audio_format", audioFormatLabel(lang, settings.AudioFormat), "format"),
+		button("settings.audio_quality", audioQualityLabel(lang, settings.AudioQuality), "quality"),
+		button("settings.max_resolution", resolutionLabel(lang, settings.MaxResolution), "res"),
+		button("settings.thumbnail", onOff(lang, settings.EmbedThumbnail), "thumb"),
+		button("settings.caption", onOff(lang, settings.Caption), "caption"),
+		button("settings.language", languageNames[settings.Language], "lang"),
+	)
+}
+
+func nextString(choices []string, current string) string {
+	for i, choice := range choices {
+		if choice == current {
+			return choices[(i+1)%len(choices)]
+		}
+	}
+	return choices[0]
+}
+
+func nextInt(choices []int, current int) int {
+	for i, choice := range choices {
+		if choice == current {
+			return choices[(i+1)%len(choices)]
+		}
+	}
+	return choices[0]
+}
+
+func (b *Bot) handleSettingsCallback(callback *tgbotapi.CallbackQuery, userIdentifier string) {
+	parts := strings.Split(callback.Data, ":")
+	if len(parts) < 3 || callback.Message == nil {
+		b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+	settings := b.userSettings(callback.From.ID)
+	ownerID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || ownerID != callback.From.ID {
+		b.api.Send(tgbotapi.NewCallbackWithAlert(callback.ID, tr(settings.Language, "settings.not_yours")))
+		return
+	}
+
+	switch parts[1] {
+	case "type":
+		settings.DefaultType = nextString(defaultTypeChoices, settings.DefaultType)
+	case "format":
+		settings.AudioFormat = nextString(downloader.AudioFormats, settings.AudioFormat)
+	case "quality":
+		settings.AudioQuality = nextString(audioQualityChoices, settings.AudioQuality)
+	case "res":
+		settings.MaxResolution = nextInt(maxResolutionChoices, settings.MaxResolution)
+	case "thumb":
+		settings.EmbedThumbnail = !settings.EmbedThumbnail
+	case "caption":
+		settings.Caption = !settings.Caption
+	case "lang":
+		settings.Language = nextString(languageChoices, settings.Language)
+	default:
+		log.Printf("[%s] Unknown settings field in callback: %s", userIdentifier, parts[1])
+		b.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+	settings.UpdatedAt = time.Now()
+	if err := b.store.SaveSettings(context.Background(), settings); err != nil {
+		log.Printf("[%s] Error saving settings: %v", userIdentifier, err)
+		b.api.Send(tgbotapi.NewCallbackWithAlert(callback.ID, tr(settings.Language, "settings.error")))
+		return
+	}
+	log.Printf("[%s] Updated setting '%s'.", userIdentifier, parts[1])
+	b.audit(callback.From.ID, "settings", parts[1])
+	b.api.Send(tgbotapi.NewCallback(callback.ID, tr(settings.Language, "settings.saved")))
+
+	editMsg := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, settingsText(settings), settingsKeyboard(settings))
+	editMsg.ParseMode = tgbotapi.ModeMarkdownV2
+	if _, err := b.api.Send(editMsg); err != nil {
+		log.Printf("[%s] Error updating settings menu: %v", userIdentifier, err)
+	}
+}
@@ -0,0 +1,277 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+	"github.com/Mohammad-Alipour/Zebio/internal/jobs"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/zmb3/spotify/v2"
+)
+
+// After the shutdown deadline, interrupted jobs get this long to stop their
+// yt-dlp processes and remove their files.
+const interruptGracePeriod = 10 * time.Second
+
+// resumeData is stored with each job so it can be restarted after a shutdown.
+type resumeData struct {
+	ReplyTo         int                   `json:"reply_to,omitempty"`
+	StatusMessageID int                   `json:"status_message_id,omitempty"`
+	URL             string                `json:"url"`
+	UserName        string                `json:"user_name"`
+	FirstName       string                `json:"first_name"`
+	Spec            *downloader.MediaSpec `json:"spec,omitempty"`
+	Track           *downloader.TrackInfo `json:"track,omitempty"`
+	Album           *downloader.LinkInfo  `json:"album,omitempty"`
+	Spotify         *spotifyAlbumPayload  `json:"spotify,omitempty"`
+	// Queued marks work that was still waiting in its chat's queue. It is
+	// queued again on the next start instead of run directly.
+	Queued      bool   `json:"queued,omitempty"`
+	DefaultType string `json:"default_type,omitempty"`
+	// Message is set for a queued message, which is handled again from the
+	// start.
+	Message *tgbotapi.Message `json:"message,omitempty"`
+}
+
+func (b *Bot) saveResumeData(jobID string, data resumeData) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding resume data of job %s: %v", jobID, err)
+		return
+	}
+	b.jobs.SetResume(jobID, encoded)
+}
+
+func (b *Bot) runInBackground(fn func()) {
+	b.background.Add(1)
+	go func() {
+		defer b.background.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("RECOVERED from panic in background job: %v\n%s", r, string(debug.Stack()))
+			}
+		}()
+		fn()
+	}()
+}
+
+// shutdown stops taking updates, gives running work until the configured
+// deadline to finish and then interrupts the rest so it can be resumed on the
+// next start.
+func (b *Bot) shutdown() {
+	b.dispatcher.close()
+	b.stopReceiving()
+	b.inline.close()
+
+	log.Printf("Waiting up to %s for running jobs to finish...", b.cfg.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg.ShutdownTimeout)
+	defer cancel()
+	if b.waitForJobs(ctx) {
+		log.Println("All running jobs finished.")
+	} else {
+		interrupted := b.jobs.Interrupt()
+		log.Printf("Shutdown deadline reached. Interrupted %d running jobs.", len(interrupted))
+		for _, job := range interrupted {
+			b.notifyInterrupted(job)
+		}
+		graceCtx, graceCancel := context.WithTimeout(context.Background(), interruptGracePeriod)
+		defer graceCancel()
+		if !b.waitForJobs(graceCtx) {
+			log.Println("Warning: Some jobs did not stop in time. Their files are left in the download directory.")
+		}
+	}
+
+	removed, err := b.downloader.CleanDownloadDir()
+	if err != nil {
+		log.Printf("Error cleaning download directory: %v", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d leftover files from the download directory.", removed)
+	}
+}
+
+func (b *Bot) waitForJobs(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		b.dispatcher.active.Wait()
+		b.background.Wait()
+		b.inline.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func jobDisplayTitle(job jobs.Job) string {
+	if job.Title != "" {
+		return job.Title
+	}
+	return job.URL
+}
+
+func (b *Bot) notifyInterrupted(job jobs.Job) {
+	lang := b.userSettings(job.UserID).Language
+	text := fmt.Sprintf(tr(lang, "shutdown.cancelled"), jobDisplayTitle(job))
+	if len(job.Resume) > 0 {
+		text = fmt.Sprintf(tr(lang, "shutdown.paused"), jobDisplayTitle(job))
+	}
+	if _, err := b.api.Send(tgbotapi.NewMessage(job.ChatID, text)); err != nil {
+		log.Printf("Error notifying chat %d about interrupted job %s: %v", job.ChatID, job.ID, err)
+	}
+}
+
+func (b *Bot) dropUpdate(item laneItem) {
+	if item.job != nil {
+		if data, ok := queuedResumeData(item); ok {
+			jobID := item.job.job.ID
+			log.Printf("Keeping queued job %s of user %d for the next start.", jobID, item.userID)
+			b.saveResumeData(jobID, data)
+			b.jobs.MarkInterrupted(jobID)
+			if job, ok := b.jobs.Get(jobID); ok {
+				b.notifyInterrupted(job)
+			}
+			return
+		}
+		b.jobs.Finish(item.job.job.ID, jobs.ErrShutdown)
+	}
+	if item.run != nil {
+		log.Printf("Dropping queued job %s of user %d because of shutdown.", item.job.job.ID, item.userID)
+		if job, ok := b.jobs.Get(item.job.job.ID); ok {
+			b.notifyInterrupted(job)
+		}
+		return
+	}
+	chatID, _, ok := updateOrigin(item.update)
+	if !ok {
+		return
+	}
+	log.Printf("Dropping queued update %d from user %d because of shutdown.", item.update.UpdateID, item.userID)
+	b.sendQueueNotice(item.update, chatID, tr(b.userSettings(item.userID).Language, "shutdown.dropped"), "")
+}
+
+// queuedResumeData returns what is needed to queue item again after a
+// restart. Button taps and chosen inline results are not kept: Telegram no
+// longer accepts answers to them by then, and their sessions may be gone.
+func queuedResumeData(item laneItem) (resumeData, bool) {
+	if item.resume != nil {
+		return *item.resume, true
+	}
+	message := item.update.Message
+	if item.run != nil || message == nil || message.From == nil {
+		return resumeData{}, false
+	}
+	userName := message.From.UserName
+	if userName == "" {
+		userName = message.From.FirstName
+	}
+	return resumeData{ReplyTo: message.MessageID, URL: message.Text, UserName: userName, FirstName: message.From.FirstName, Queued: true, Message: message}, true
+}
+
+// resumeJobs restarts the jobs interrupted by the previous shutdown.
+func (b *Bot) resumeJobs() {
+	for _, pending := range b.jobs.Resumable() {
+		job, ctx, err := b.jobs.Resume(context.Background(), pending.ID)
+		if err != nil {
+			log.Printf("Could not resume job %s: %v", pending.ID, err)
+			continue
+		}
+		var data resumeData
+		if err := json.Unmarshal(job.Resume, &data); err != nil {
+			log.Printf("Error decoding resume data of job %s: %v", job.ID, err)
+			b.jobs.Finish(job.ID, fmt.Errorf("invalid resume data: %w", err))
+			continue
+		}
+		if data.Queued {
+			log.Printf("Queueing job %s for user %d again: %s", job.ID, job.UserID, data.URL)
+			b.requeueJob(ctx, job, data)
+			continue
+		}
+		log.Printf("Resuming %s job %s for user %d: %s", job.Kind, job.ID, job.UserID, data.URL)
+		b.runInBackground(func() {
+			b.runResumedJob(ctx, job, data)
+		})
+	}
+}
+
+// stopWaitingJob records a job whose context ended before it got a worker.
+// After a shutdown it stays interrupted with its resume data, otherwise it was
+// cancelled.
+func (b *Bot) stopWaitingJob(ctx context.Context, job *jobs.Job, userIdentifier string) {
+	if jobs.Interrupted(ctx) {
+		log.Printf("[%s] Job %s was interrupted while waiting for a worker.", userIdentifier, job.ID)
+		b.jobs.MarkInterrupted(job.ID)
+		return
+	}
+	log.Printf("[%s] Job %s was cancelled while waiting for a worker.", userIdentifier, job.ID)
+	b.jobs.Finish(job.ID, ctx.Err())
+}
+
+// requeueJob puts work that was waiting in a chat's queue at the last
+// shutdown back into the queue.
+func (b *Bot) requeueJob(ctx context.Context, job *jobs.Job, data resumeData) {
+	item := laneItem{userID: job.UserID, job: &queuedJob{job: job, ctx: ctx}}
+	if data.Message != nil {
+		item.update = tgbotapi.Update{Message: data.Message}
+	} else {
+		original := &tgbotapi.Message{
+			MessageID: data.ReplyTo,
+			Chat:      &tgbotapi.Chat{ID: job.ChatID},
+			From:      &tgbotapi.User{ID: job.UserID, UserName: data.UserName, FirstName: data.FirstName},
+		}
+		item.run = func(queued *queuedJob) {
+			b.routeLink(queued, original, data.URL, data.DefaultType, data.UserName, job.UserID, data.FirstName)
+		}
+		item.resume = &data
+	}
+	if _, accepted := b.dispatcher.submit(job.ChatID, item); !accepted {
+		log.Printf("Queue for chat %d is full. Could not queue job %s again.", job.ChatID, job.ID)
+		b.jobs.Finish(job.ID, errors.New("chat queue is full"))
+		return
+	}
+	b.sendResumeNotice(job, data)
+}
+
+func (b *Bot) sendResumeNotice(job *jobs.Job, data resumeData) {
+	notice := tgbotapi.NewMessage(job.ChatID, fmt.Sprintf(tr(b.userSettings(job.UserID).Language, "shutdown.resumed"), jobDisplayTitle(*job)))
+	if data.ReplyTo != 0 {
+		notice.ReplyToMessageID = data.ReplyTo
+	}
+	b.api.Send(notice)
+}
+
+func (b *Bot) runResumedJob(ctx context.Context, job *jobs.Job, data resumeData) {
+	userIdentifier := data.UserName + "_" + strconv.FormatInt(job.UserID, 10)
+	b.sendResumeNotice(job, data)
+
+	switch {
+	case job.Kind == jobs.KindSingle && data.Spec != nil && data.Track != nil:
+		// Single downloads normally run on a dispatcher worker, so they take
+		// a slot from the same pool.
+		select {
+		case b.dispatcher.workers <- struct{}{}:
+		case <-ctx.Done():
+			b.stopWaitingJob(ctx, job, userIdentifier)
+			return
+		}
+		defer func() { <-b.dispatcher.workers }()
+		b.processDownloadRequest(ctx, job, job.ChatID, data.ReplyTo, data.URL, *data.Spec, data.Track, data.UserName, job.UserID, data.FirstName)
+	case job.Kind == jobs.KindAlbum && data.Album != nil:
+		b.processSoundCloudAlbum(ctx, job, job.ChatID, data.URL, data.Album, userIdentifier, data.UserName, job.UserID, data.FirstName, data.StatusMessageID)
+	case job.Kind == jobs.KindSpotifyAlbum && data.Spotify != nil:
+		b.processSpotifyAlbum(ctx, job, job.ChatID, data.Spotify.LinkType, spotify.ID(data.Spotify.LinkID), userIdentifier, data.UserName, job.UserID, data.FirstName, data.StatusMessageID)
+	default:
+		log.Printf("[%s] Resume data of %s job %s is incomplete.", userIdentifier, job.Kind, job.ID)
+		b.jobs.Finish(job.ID, errors.New("incomplete resume data"))
+	}
+}
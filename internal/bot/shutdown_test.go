@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/config"
+	"github.com/Mohammad-Alipour/Zebio/internal/jobs"
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func newShutdownTestBot(t *testing.T, st store.Store) *Bot {
+	t.Helper()
+	_, api := newFakeTelegram(t)
+	manager, err := jobs.NewManager(context.Background(), st, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Bot{api: api, cfg: &config.Config{}, store: st, jobs: manager}
+}
+
+func TestDroppedQueuedJobsAreQueuedAgain(t *testing.T) {
+	st := store.NewMemory()
+	b := newShutdownTestBot(t, st)
+	const chatID, userID = 100, 7
+
+	message := &tgbotapi.Message{
+		MessageID: 11,
+		Chat:      &tgbotapi.Chat{ID: chatID},
+		From:      &tgbotapi.User{ID: userID, FirstName: "Sara"},
+		Text:      "https://example.com/a",
+	}
+	messageItem := laneItem{userID: userID, update: tgbotapi.Update{Message: message}, job: b.newQueuedJob(chatID, userID, message.Text)}
+	batchItem := laneItem{
+		userID: userID,
+		job:    b.newQueuedJob(chatID, userID, "https://example.com/b"),
+		run:    func(*queuedJob) {},
+		resume: &resumeData{ReplyTo: 12, URL: "https://example.com/b", UserName: "sara", FirstName: "Sara", Queued: true, DefaultType: "audio"},
+	}
+	callbackItem := laneItem{userID: userID, update: tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{ID: "1", Data: "dltype:audio:token"}}, job: b.newQueuedJob(chatID, userID, "")}
+	for _, item := range []laneItem{messageItem, batchItem, callbackItem} {
+		b.dropUpdate(item)
+	}
+
+	if job, _ := b.jobs.Get(callbackItem.job.job.ID); job.State != jobs.StateFailed {
+		t.Errorf("dropped button tap has state %s, want %s", job.State, jobs.StateFailed)
+	}
+	for _, item := range []laneItem{messageItem, batchItem} {
+		job, _ := b.jobs.Get(item.job.job.ID)
+		if job.State != jobs.StateInterrupted || len(job.Resume) == 0 {
+			t.Errorf("dropped job %s has state %s and %d bytes of resume data, want it kept for the next start", job.URL, job.State, len(job.Resume))
+		}
+	}
+
+	// The next start loads the jobs from the store and queues them again.
+	restarted := newShutdownTestBot(t, st)
+	handled := make(chan laneItem, 2)
+	restarted.dispatcher = newDispatcher(2, 2, 10, func(item laneItem) { handled <- item }, func(laneItem) {})
+	restarted.resumeJobs()
+
+	got := make(map[string]laneItem)
+	for i := 0; i < 2; i++ {
+		select {
+		case item := <-handled:
+			got[item.job.job.ID] = item
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d of 2 jobs were queued again", i)
+		}
+	}
+	if item := got[messageItem.job.job.ID]; item.update.Message == nil || item.update.Message.Text != message.Text || item.update.Message.Chat.ID != chatID {
+		t.Errorf("queued message job again with update %+v, want the original message", item.update)
+	}
+	item := got[batchItem.job.job.ID]
+	if item.run == nil || item.resume == nil || item.resume.URL != "https://example.com/b" || item.resume.DefaultType != "audio" || item.resume.ReplyTo != 12 {
+		t.Errorf("queued batch link again with resume data %+v, want the link, its reply and default type", item.resume)
+	}
+	if job, _ := restarted.jobs.Get(batchItem.job.job.ID); job.State != jobs.StateQueued {
+		t.Errorf("job queued again has state %s, want %s", job.State, jobs.StateQueued)
+	}
+}
+
+func TestQueuedResumeDataSkipsButtonTaps(t *testing.T) {
+	item := laneItem{update: tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: "dlalbum:yes:token"}}}
+	if _, ok := queuedResumeData(item); ok {
+		t.Error("a button tap was kept for the next start")
+	}
+	item = laneItem{update: tgbotapi.Update{Message: &tgbotapi.Message{MessageID: 3, Text: "https://example.com/a", From: &tgbotapi.User{ID: 7, FirstName: "Sara"}}}}
+	data, ok := queuedResumeData(item)
+	if !ok {
+		t.Fatal("a queued message was not kept")
+	}
+	encoded, _ := json.Marshal(data)
+	var decoded resumeData
+	if err := json.Unmarshal(encoded, &decoded); err != nil || decoded.Message == nil || decoded.Message.Text != "https://example.com/a" || decoded.UserName != "Sara" {
+		t.Errorf("resume data %s did not survive encoding: %v", encoded, err)
+	}
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type telegramCall struct {
+	method string
+	params url.Values
+}
+
+// fakeTelegram answers Bot API requests like Telegram would and records them.
+type fakeTelegram struct {
+	mu    sync.Mutex
+	calls []telegramCall
+	// hold, when set, delays every editMessageText until it is closed.
+	hold chan struct{}
+}
+
+func newFakeTelegram(t *testing.T) (*fakeTelegram, *tgbotapi.BotAPI) {
+	t.Helper()
+	fake := &fakeTelegram{}
+	server := httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(server.Close)
+	api, err := tgbotapi.NewBotAPIWithClient("test-token", server.URL+"/bot%s/%s", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, api
+}
+
+func (f *fakeTelegram) serve(w http.ResponseWriter, r *http.Request) {
+	r.ParseMultipartForm(1 << 20)
+	method := path.Base(r.URL.Path)
+	f.mu.Lock()
+	f.calls = append(f.calls, telegramCall{method: method, params: r.Form})
+	hold := f.hold
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch method {
+	case "getMe":
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Zebio","username":"zebio_bot"}}`))
+	case "answerCallbackQuery", "deleteMessage":
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	default:
+		if method == "editMessageText" && hold != nil {
+			<-hold
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}}`))
+	}
+}
+
+func (f *fakeTelegram) called(method string) []telegramCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []telegramCall
+	for _, call := range f.calls {
+		if call.method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
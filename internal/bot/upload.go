@@ -0,0 +1,201 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/downloader"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram rejects photos above 10 MB even when documents may be larger.
+const photoUploadLimit = 10 * 1024 * 1024
+
+var errTooLarge = errors.New("file exceeds the upload limit")
+
+type uploadPlan struct {
+	Files     []string
+	Kind      mediaKind
+	Notice    string
+	Cacheable bool
+	Size      int64
+	// OfferLower holds resolutions that fit the limit when the user should
+	// pick one instead of receiving a file.
+	OfferLower []downloader.Resolution
+}
+
+func (b *Bot) uploadLimit(kind mediaKind) int64 {
+	if kind == mediaPhoto && b.cfg.MaxUploadSize > photoUploadLimit {
+		return photoUploadLimit
+	}
+	return b.cfg.MaxUploadSize
+}
+
+// namedFile uploads a file from disk under the name the user should see
+// rather than the sanitized name it is stored under.
+type namedFile struct {
+	path string
+	name string
+}
+
+func (f namedFile) NeedsUpload() bool {
+	return true
+}
+
+func (f namedFile) UploadData() (string, io.Reader, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return "", nil, err
+	}
+	return f.name, file, nil
+}
+
+func (f namedFile) SendData() string {
+	panic("namedFile must be uploaded")
+}
+
+// uploadFile lets a local Bot API server read the file from disk instead of
+// receiving it over HTTP. Over HTTP the file is named after the track.
+func (b *Bot) uploadFile(path string, trackInfo *downloader.TrackInfo) tgbotapi.RequestFileData {
+	upload := namedFile{path: path, name: downloader.DisplayFilename(trackInfo, filepath.Ext(path))}
+	if !b.cfg.TelegramAPILocal {
+		return upload
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		log.Printf("Could not resolve absolute path of %s: %v. Uploading over HTTP.", path, err)
+		return upload
+	}
+	return tgbotapi.FileURL("file://" + absPath)
+}
+
+func (b *Bot) hasOversizeStrategy(name string) bool {
+	for _, strategy := range b.cfg.OversizeStrategies {
+		if strategy == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bot) fitsUploadLimit(path string, kind mediaKind) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Size() <= b.uploadLimit(kind)
+}
+
+func fittingResolutions(trackInfo *downloader.TrackInfo, limit int64) []downloader.Resolution {
+	var fitting []downloader.Resolution
+	for _, res := range trackInfo.Resolutions() {
+		if res.Size > 0 && res.Size <= limit*95/100 {
+			fitting = append(fitting, res)
+		}
+	}
+	return fitting
+}
+
+// planUpload decides how a downloaded file reaches the user, applying the
+// configured oversize strategies in order when it is above the limit.
+func (b *Bot) planUpload(ctx context.Context, path string, kind mediaKind, trackInfo *downloader.TrackInfo, lang string, userIdentifier string) (uploadPlan, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return uploadPlan{}, err
+	}
+	size := info.Size()
+	limit := b.uploadLimit(kind)
+	if size <= limit {
+		return uploadPlan{Files: []string{path}, Kind: kind, Cacheable: true}, nil
+	}
+	log.Printf("[%s] File %s is %d bytes, above the %d byte limit for %s. Trying strategies: %v", userIdentifier, path, size, limit, kind, b.cfg.OversizeStrategies)
+
+	for _, strategy := range b.cfg.OversizeStrategies {
+		switch strategy {
+		case "document":
+			if kind != mediaDocument && size <= b.cfg.MaxUploadSize {
+				return uploadPlan{
+					Files:     []string{path},
+					Kind:      mediaDocument,
+					Notice:    tr(lang, "upload.as_document"),
+					Cacheable: true,
+				}, nil
+			}
+		case "lower":
+			if kind == mediaVideo {
+				if fitting := fittingResolutions(trackInfo, limit); len(fitting) > 0 {
+					return uploadPlan{OfferLower: fitting, Size: size}, nil
+				}
+			}
+		case "reencode":
+			if kind != mediaVideo {
+				continue
+			}
+			output, err := b.media.FitToSize(ctx, path, limit, trackInfo.Duration)
+			if err != nil {
+				log.Printf("[%s] Re-encoding %s to fit the limit failed: %v", userIdentifier, path, err)
+				continue
+			}
+			return uploadPlan{
+				Files:     []string{output},
+				Kind:      kind,
+				Notice:    fmt.Sprintf(tr(lang, "upload.reencoded"), formatBytes(size), formatBytes(limit)),
+				Cacheable: true,
+			}, nil
+		case "split":
+			if kind != mediaVideo && kind != mediaAudio {
+				continue
+			}
+			parts, err := b.media.Split(ctx, path, limit, trackInfo.Duration)
+			if err != nil {
+				log.Printf("[%s] Splitting %s into parts failed: %v", userIdentifier, path, err)
+				continue
+			}
+			return uploadPlan{
+				Files:  parts,
+				Kind:   kind,
+				Notice: fmt.Sprintf(tr(lang, "upload.split"), formatBytes(size), formatBytes(limit), len(parts)),
+			}, nil
+		default:
+			log.Printf("[%s] Unknown oversize strategy '%s'. Skipping.", userIdentifier, strategy)
+		}
+		if ctx.Err() != nil {
+			return uploadPlan{}, ctx.Err()
+		}
+	}
+	return uploadPlan{}, fmt.Errorf("%w: %s over %s", errTooLarge, formatBytes(size), formatBytes(limit))
+}
+
+// offerLowerResolutions asks the user to pick one of the resolutions that fit
+// the upload limit. It returns false when the keyboard could not be sent.
+func (b *Bot) offerLowerResolutions(chatID int64, replyToMessageID int, userID int64, url string, trackInfo *downloader.TrackInfo, resolutions []downloader.Resolution, size int64, userIdentifier string) bool {
+	linkInfo := downloader.LinkInfo{Type: "track", Tracks: []*downloader.TrackInfo{trackInfo}, OriginalURL: url}
+	token, err := b.newSession(sessionKindLink, userID, chatID, replyToMessageID, url, linkInfo)
+	if err != nil {
+		log.Printf("[%s] Error creating session for lower resolutions: %v", userIdentifier, err)
+		return false
+	}
+	lang := b.userSettings(userID).Language
+	text := fmt.Sprintf(tr(lang, "upload.offer_lower"), formatBytes(size), formatBytes(b.uploadLimit(mediaVideo)))
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyToMessageID = replyToMessageID
+	msg.ReplyMarkup = resolutionKeyboard(lang, resolutions, token)
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("[%s] Error sending lower resolution choices: %v", userIdentifier, err)
+		b.deleteSession(token)
+		return false
+	}
+	return true
+}
+
+func partTrackInfo(trackInfo *downloader.TrackInfo, part, total int) *downloader.TrackInfo {
+	if total <= 1 {
+		return trackInfo
+	}
+	partInfo := *trackInfo
+	partInfo.Title = fmt.Sprintf("%s (%d/%d)", trackInfo.Title, part, total)
+	return &partInfo
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// lastSeenInterval is how stale the stored LastSeen of a user may get before
+// it is written again.
+const lastSeenInterval = time.Hour
+
+// seenUsers holds the user records last written to the store, so updates
+// from a known user do not each cost a write.
+type seenUsers struct {
+	mu    sync.Mutex
+	users map[int64]store.User
+}
+
+// rememberUser stores the user when the name changed or LastSeen is older
+// than lastSeenInterval.
+func (b *Bot) rememberUser(from *tgbotapi.User) {
+	now := time.Now()
+	b.seen.mu.Lock()
+	defer b.seen.mu.Unlock()
+	if b.seen.users == nil {
+		b.seen.users = make(map[int64]store.User)
+	}
+	known, ok := b.seen.users[from.ID]
+	if !ok {
+		if stored, err := b.store.GetUser(context.Background(), from.ID); err == nil {
+			known, ok = stored, true
+		}
+	}
+	if ok && known.UserName == from.UserName && known.FirstName == from.FirstName && now.Sub(known.LastSeen) < lastSeenInterval {
+		b.seen.users[from.ID] = known
+		return
+	}
+
+	user := store.User{
+		ID:        from.ID,
+		UserName:  from.UserName,
+		FirstName: from.FirstName,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+	if ok && !known.FirstSeen.IsZero() {
+		user.FirstSeen = known.FirstSeen
+	}
+	if err := b.store.UpsertUser(context.Background(), user); err != nil {
+		log.Printf("Error saving user %d: %v", from.ID, err)
+		return
+	}
+	b.seen.users[from.ID] = user
+}
+
+func (b *Bot) audit(userID int64, action string, detail string) {
+	event := store.AuditEvent{
+		Time:   time.Now(),
+		UserID: userID,
+		Action: action,
+		Detail: detail,
+	}
+	if err := b.store.AppendAudit(context.Background(), event); err != nil {
+		log.Printf("Error recording audit event '%s' for user %d: %v", action, userID, err)
+	}
+}
+
+// sweepAudit removes audit events older than the configured retention.
+func (b *Bot) sweepAudit(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		removed, err := b.store.DeleteAuditBefore(context.Background(), time.Now().Add(-b.cfg.AuditRetention))
+		if err != nil {
+			log.Printf("Error removing old audit events: %v", err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("Removed %d audit events older than %s.", removed, b.cfg.AuditRetention)
+		}
+	}
+}
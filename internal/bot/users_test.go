@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type countingStore struct {
+	*store.Memory
+	upserts int
+}
+
+func (s *countingStore) UpsertUser(ctx context.Context, user store.User) error {
+	s.upserts++
+	return s.Memory.UpsertUser(ctx, user)
+}
+
+func TestRememberUserWritesOnlyChanges(t *testing.T) {
+	st := &countingStore{Memory: store.NewMemory()}
+	b := &Bot{store: st}
+	from := &tgbotapi.User{ID: 7, UserName: "sara", FirstName: "Sara"}
+
+	b.rememberUser(from)
+	b.rememberUser(from)
+	if st.upserts != 1 {
+		t.Fatalf("upserts after the same user twice = %d, want 1", st.upserts)
+	}
+
+	renamed := *from
+	renamed.UserName = "sara_music"
+	b.rememberUser(&renamed)
+	if st.upserts != 2 {
+		t.Fatalf("upserts after a new user name = %d, want 2", st.upserts)
+	}
+
+	b.seen.mu.Lock()
+	user := b.seen.users[from.ID]
+	user.LastSeen = time.Now().Add(-2 * lastSeenInterval)
+	b.seen.users[from.ID] = user
+	b.seen.mu.Unlock()
+	b.rememberUser(&renamed)
+	if st.upserts != 3 {
+		t.Fatalf("upserts after LastSeen went stale = %d, want 3", st.upserts)
+	}
+}
+
+func TestRememberUserReadsKnownUsersFromStore(t *testing.T) {
+	st := &countingStore{Memory: store.NewMemory()}
+	firstSeen := time.Now().Add(-24 * time.Hour)
+	st.Memory.UpsertUser(context.Background(), store.User{ID: 7, UserName: "sara", FirstName: "Sara", FirstSeen: firstSeen, LastSeen: time.Now()})
+	b := &Bot{store: st}
+
+	b.rememberUser(&tgbotapi.User{ID: 7, UserName: "sara", FirstName: "Sara"})
+	if st.upserts != 0 {
+		t.Errorf("upserts for a user stored a moment ago = %d, want 0", st.upserts)
+	}
+}
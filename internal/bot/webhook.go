@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+func (b *Bot) webhookPath() string {
+	if b.cfg.WebhookPathSecret == "" {
+		return "/webhook"
+	}
+	return "/webhook/" + b.cfg.WebhookPathSecret
+}
+
+// setWebhook registers the public URL with Telegram. The request is built by
+// hand because WebhookConfig has no secret_token field.
+func (b *Bot) setWebhook() error {
+	params := tgbotapi.Params{}
+	params["url"] = b.cfg.WebhookURL + b.webhookPath()
+	params.AddNonEmpty("secret_token", b.cfg.WebhookSecretToken)
+	params.AddNonZero("max_connections", b.cfg.WorkerPoolSize)
+
+	var resp *tgbotapi.APIResponse
+	var err error
+	if b.cfg.WebhookUploadCert {
+		cert, readErr := os.ReadFile(b.cfg.WebhookTLSCert)
+		if readErr != nil {
+			return fmt.Errorf("failed to read webhook certificate: %w", readErr)
+		}
+		resp, err = b.api.UploadFiles("setWebhook", params, []tgbotapi.RequestFile{
+			{Name: "certificate", Data: tgbotapi.FileBytes{Name: "cert.pem", Bytes: cert}},
+		})
+	} else {
+		resp, err = b.api.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return fmt.Errorf("setWebhook failed: %w", err)
+	}
+	if !resp.Ok {
+		return fmt.Errorf("setWebhook failed: %s", resp.Description)
+	}
+	return nil
+}
+
+func (b *Bot) deleteWebhook() error {
+	if _, err := b.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return fmt.Errorf("deleteWebhook failed: %w", err)
+	}
+	return nil
+}
+
+func (b *Bot) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if b.cfg.WebhookSecretToken != "" {
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(b.cfg.WebhookSecretToken)) != 1 {
+			log.Printf("Rejected webhook request from %s with an invalid secret token.", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	update, err := b.api.HandleUpdate(r)
+	if err != nil {
+		log.Printf("Error decoding webhook update from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	// Telegram waits for the response before sending the next update, so the
+	// update is only queued here. During shutdown it is refused so Telegram
+	// retries it once the bot is back.
+	if !b.enqueueUpdate(*update) {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *Bot) newWebhookServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(b.webhookPath(), b.handleWebhook)
+	return &http.Server{
+		Addr:              b.cfg.WebhookListen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// serveWebhook runs the webhook listener. Webhook mode is single-replica:
+// sessions, jobs and settings live in a bbolt file or in memory owned by one
+// process, so a second replica behind a load balancer would not see the
+// buttons and jobs of the first.
+func (b *Bot) serveWebhook() error {
+	if err := b.setWebhook(); err != nil {
+		return err
+	}
+	log.Printf("Listening for webhook updates on %s", b.cfg.WebhookListen)
+
+	var err error
+	if b.cfg.WebhookTLSCert != "" {
+		err = b.server.ListenAndServeTLS(b.cfg.WebhookTLSCert, b.cfg.WebhookTLSKey)
+	} else {
+		err = b.server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// stopWebhook stops the server. The webhook stays registered unless
+// WEBHOOK_DELETE_ON_SHUTDOWN is set, so a restart or rolling deploy does not
+// lose the updates sent in between.
+func (b *Bot) stopWebhook() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := b.server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down webhook server: %v", err)
+	}
+	if !b.cfg.WebhookDeleteOnShutdown {
+		return
+	}
+	if err := b.deleteWebhook(); err != nil {
+		log.Printf("Error removing webhook: %v", err)
+	}
+}
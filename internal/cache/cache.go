@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+)
+
+type Entry = store.CacheEntry
+
+// Hits only change LastUsed and Hits, which are written to the store in
+// batches: once flushBatch entries changed or flushInterval passed.
+const (
+	flushBatch    = 100
+	flushInterval = 5 * time.Minute
+)
+
+type Stats struct {
+	Entries int
+	Hits    uint64
+	Misses  uint64
+}
+
+type Cache struct {
+	mu         sync.Mutex
+	backend    store.CacheStore
+	maxEntries int
+	ttl        time.Duration
+	entries    map[string]*Entry
+	// dirty holds the keys of entries whose hits are not yet in the store.
+	dirty     map[string]bool
+	lastFlush time.Time
+	hits      uint64
+	misses    uint64
+}
+
+func New(ctx context.Context, backend store.CacheStore, maxEntries int, ttl time.Duration) (*Cache, error) {
+	c := &Cache{
+		backend:    backend,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    make(map[string]*Entry),
+		dirty:      make(map[string]bool),
+		lastFlush:  time.Now(),
+	}
+	stored, err := backend.ListCacheEntries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache entries: %w", err)
+	}
+	now := time.Now()
+	for i := range stored {
+		entry := stored[i]
+		if entry.Key == "" {
+			continue
+		}
+		if entry.FileID == "" || c.expired(&entry, now) {
+			c.removeLocked(entry.Key)
+			continue
+		}
+		c.entries[entry.Key] = &entry
+	}
+	c.evictLocked()
+	log.Printf("File ID cache loaded with %d entries.\n", len(c.entries))
+	return c, nil
+}
+
+// Source identifies the media independently of the URL form it was shared
+// with: extractor and ID when yt-dlp reported them, the canonical URL otherwise.
+func Source(extractor, id, canonicalURL string) string {
+	if extractor != "" && id != "" {
+		return strings.ToLower(extractor) + ":" + id
+	}
+	return strings.TrimSpace(canonicalURL)
+}
+
+func Key(source, downloadType, quality string) string {
+	if quality == "" {
+		quality = "default"
+	}
+	return source + "|" + downloadType + "|" + quality
+}
+
+func (c *Cache) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return Entry{}, false
+	}
+	now := time.Now()
+	if c.expired(entry, now) {
+		c.removeLocked(key)
+		c.misses++
+		return Entry{}, false
+	}
+	c.hits++
+	entry.Hits++
+	entry.LastUsed = now
+	c.dirty[key] = true
+	if len(c.dirty) >= flushBatch || now.Sub(c.lastFlush) >= flushInterval {
+		c.flushLocked(now)
+	}
+	return *entry, true
+}
+
+func (c *Cache) Put(entry Entry) {
+	if entry.Key == "" || entry.FileID == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = now
+	}
+	entry.LastUsed = now
+	c.entries[entry.Key] = &entry
+	delete(c.dirty, entry.Key)
+	c.persistLocked(&entry)
+	c.evictLocked()
+}
+
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(key)
+}
+
+// Purge removes every entry whose source or original URL matches target, or
+// all entries when target is empty. It returns the number of removed entries.
+func (c *Cache) Purge(target string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, entry := range c.entries {
+		if target == "" || entry.Source == target || entry.OriginalURL == target {
+			c.removeLocked(key)
+			removed++
+		}
+	}
+	c.flushLocked(time.Now())
+	return removed
+}
+
+// Flush writes the hits that are not yet in the store. It is called on
+// shutdown so they are not lost.
+func (c *Cache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked(time.Now())
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{Entries: len(c.entries), Hits: c.hits, Misses: c.misses}
+}
+
+func (c *Cache) expired(entry *Entry, now time.Time) bool {
+	return c.ttl > 0 && now.Sub(entry.CreatedAt) > c.ttl
+}
+
+func (c *Cache) evictLocked() {
+	if c.maxEntries <= 0 || len(c.entries) <= c.maxEntries {
+		return
+	}
+	ordered := make([]*Entry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		ordered = append(ordered, entry)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].LastUsed.Before(ordered[j].LastUsed)
+	})
+	for _, entry := range ordered[:len(ordered)-c.maxEntries] {
+		c.removeLocked(entry.Key)
+	}
+	// The order depends on LastUsed, so the store must agree with it for the
+	// next start to evict the same entries.
+	c.flushLocked(time.Now())
+}
+
+func (c *Cache) flushLocked(now time.Time) {
+	for key := range c.dirty {
+		if entry, ok := c.entries[key]; ok {
+			c.persistLocked(entry)
+		}
+	}
+	clear(c.dirty)
+	c.lastFlush = now
+}
+
+func (c *Cache) persistLocked(entry *Entry) {
+	if err := c.backend.PutCacheEntry(context.Background(), *entry); err != nil {
+		log.Printf("Error persisting cache entry '%s': %v", entry.Key, err)
+	}
+}
+
+func (c *Cache) removeLocked(key string) {
+	delete(c.entries, key)
+	delete(c.dirty, key)
+	if err := c.backend.DeleteCacheEntry(context.Background(), key); err != nil {
+		log.Printf("Error deleting cache entry '%s': %v", key, err)
+	}
+}
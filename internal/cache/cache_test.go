@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+)
+
+type countingStore struct {
+	*store.Memory
+	puts int
+}
+
+func (s *countingStore) PutCacheEntry(ctx context.Context, entry store.CacheEntry) error {
+	s.puts++
+	return s.Memory.PutCacheEntry(ctx, entry)
+}
+
+func newTestCache(t *testing.T, maxEntries int) (*Cache, *countingStore) {
+	t.Helper()
+	st := &countingStore{Memory: store.NewMemory()}
+	c, err := New(context.Background(), st, maxEntries, 0)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c, st
+}
+
+func storedEntry(t *testing.T, st *countingStore, key string) (store.CacheEntry, bool) {
+	t.Helper()
+	entries, err := st.ListCacheEntries(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Key == key {
+			return entry, true
+		}
+	}
+	return store.CacheEntry{}, false
+}
+
+func TestGetDoesNotWriteEveryHit(t *testing.T) {
+	c, st := newTestCache(t, 0)
+	c.Put(Entry{Key: "a", FileID: "file-a"})
+	st.puts = 0
+
+	for i := 0; i < 10; i++ {
+		if _, ok := c.Get("a"); !ok {
+			t.Fatal("Get() missed a cached entry")
+		}
+	}
+	if st.puts != 0 {
+		t.Errorf("Get() wrote to the store %d times, want 0", st.puts)
+	}
+
+	c.Flush()
+	if st.puts != 1 {
+		t.Errorf("Flush() wrote %d entries, want 1", st.puts)
+	}
+	if entry, _ := storedEntry(t, st, "a"); entry.Hits != 10 {
+		t.Errorf("stored hits = %d, want 10", entry.Hits)
+	}
+}
+
+func TestGetFlushesInBatches(t *testing.T) {
+	c, st := newTestCache(t, 0)
+	for i := 0; i < flushBatch; i++ {
+		c.Put(Entry{Key: fmt.Sprintf("key-%d", i), FileID: "file"})
+	}
+	st.puts = 0
+
+	for key := range c.entries {
+		c.Get(key)
+	}
+	if st.puts != flushBatch {
+		t.Errorf("store writes after %d hit entries = %d, want %d", flushBatch, st.puts, flushBatch)
+	}
+	if len(c.dirty) != 0 {
+		t.Errorf("%d entries left unflushed", len(c.dirty))
+	}
+}
+
+func TestEvictionFlushesHits(t *testing.T) {
+	c, st := newTestCache(t, 2)
+	c.Put(Entry{Key: "old", FileID: "file-old"})
+	c.Put(Entry{Key: "used", FileID: "file-used"})
+	c.Get("used")
+
+	c.Put(Entry{Key: "new", FileID: "file-new"})
+	if _, ok := storedEntry(t, st, "old"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if entry, _ := storedEntry(t, st, "used"); entry.Hits != 1 {
+		t.Errorf("stored hits of the kept entry = %d, want 1", entry.Hits)
+	}
+}
+
+func TestPurgeFlushesHits(t *testing.T) {
+	c, st := newTestCache(t, 0)
+	c.Put(Entry{Key: "a", Source: "youtube:a", FileID: "file-a"})
+	c.Put(Entry{Key: "b", Source: "youtube:b", FileID: "file-b"})
+	c.Get("a")
+	c.Get("b")
+
+	if removed := c.Purge("youtube:a"); removed != 1 {
+		t.Fatalf("Purge() = %d, want 1", removed)
+	}
+	if entry, _ := storedEntry(t, st, "b"); entry.Hits != 1 {
+		t.Errorf("stored hits of the remaining entry = %d, want 1", entry.Hits)
+	}
+}
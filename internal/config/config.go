@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,10 +13,71 @@ type Config struct {
 	YTDLPPath           string
 	DownloadDir         string
 	AllowedUserIDs      []int64
+	AdminUserIDs        []int64
 	ForceJoinChannel    string
 	SpotifyClientID     string
 	SpotifyClientSecret string
 	YouTubeCookiesPath  string
+
+	WorkerPoolSize       int
+	MaxConcurrentPerUser int
+	MaxQueuedPerChat     int
+	MaxLinksPerMessage   int
+
+	SearchResults   int
+	SearchPlainText bool
+	// InlineUploadChatID receives the files downloaded for inline results.
+	// When 0 they go to the private chat of the user and are deleted there.
+	InlineUploadChatID int64
+	InlineMaxSearches  int
+
+	InfoTimeout     time.Duration
+	SearchTimeout   time.Duration
+	DownloadTimeout time.Duration
+	RetryAttempts   int
+	RetryBaseDelay  time.Duration
+	RetryMaxDelay   time.Duration
+
+	HTTPMaxFileSize  int64
+	HTTPMaxRedirects int
+
+	URLAllowDomains  []string
+	URLDenyDomains   []string
+	AllowPrivateURLs bool
+
+	ProgressEditInterval time.Duration
+	ShutdownTimeout      time.Duration
+
+	DownloadDirTTL     time.Duration
+	DownloadDirMaxSize int64
+	MinFreeDisk        int64
+	JanitorInterval    time.Duration
+
+	StoreDriver string
+	StorePath   string
+
+	CacheMaxEntries int
+	CacheTTL        time.Duration
+
+	SessionTTL     time.Duration
+	AuditRetention time.Duration
+
+	TelegramAPIEndpoint string
+	TelegramAPILocal    bool
+
+	WebhookURL              string
+	WebhookListen           string
+	WebhookPathSecret       string
+	WebhookSecretToken      string
+	WebhookTLSCert          string
+	WebhookTLSKey           string
+	WebhookUploadCert       bool
+	WebhookDeleteOnShutdown bool
+
+	MaxUploadSize      int64
+	OversizeStrategies []string
+	FFmpegPath         string
+	FFprobePath        string
 }
 
 func Load() (*Config, error) {
@@ -39,15 +101,7 @@ func Load() (*Config, error) {
 	var allowedUserIDs []int64
 	allowedUserIDsStr := os.Getenv("ALLOWED_USER_IDS")
 	if allowedUserIDsStr != "" {
-		ids := strings.Split(allowedUserIDsStr, ",")
-		for _, idStr := range ids {
-			id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
-			if err != nil {
-				log.Printf("Warning: Could not parse user ID '%s': %v. Skipping.\n", idStr, err)
-				continue
-			}
-			allowedUserIDs = append(allowedUserIDs, id)
-		}
+		allowedUserIDs = parseUserIDs(allowedUserIDsStr)
 		if len(allowedUserIDs) > 0 {
 			log.Printf("Allowed user IDs loaded: %v\n", allowedUserIDs)
 		}
@@ -55,6 +109,13 @@ func Load() (*Config, error) {
 		log.Println("ALLOWED_USER_IDS not set. Bot will be open to all (if no other checks are in place).")
 	}
 
+	adminUserIDs := parseUserIDs(os.Getenv("ADMIN_USER_IDS"))
+	if len(adminUserIDs) > 0 {
+		log.Printf("Admin user IDs loaded: %v\n", adminUserIDs)
+	} else {
+		log.Println("ADMIN_USER_IDS not set. Admin commands are disabled.")
+	}
+
 	forceJoinChannel := os.Getenv("FORCE_JOIN_CHANNEL")
 	if forceJoinChannel != "" {
 		if !strings.HasPrefix(forceJoinChannel, "@") {
@@ -81,14 +142,304 @@ func Load() (*Config, error) {
 		log.Println("Warning: YOUTUBE_COOKIES_PATH not set. Youtubees may fail due to bot detection.")
 	}
 
+	workerPoolSize := getEnvInt("WORKER_POOL_SIZE", 8)
+	maxLinksPerMessage := getEnvInt("MAX_LINKS_PER_MESSAGE", 10)
+	searchResults := getEnvInt("SEARCH_RESULTS", 10)
+	searchPlainText := getEnvBool("SEARCH_PLAIN_TEXT", false)
+	inlineUploadChatID := getEnvChatID("INLINE_UPLOAD_CHAT_ID", 0)
+	inlineMaxSearches := getEnvInt("INLINE_MAX_SEARCHES", 4)
+	maxConcurrentPerUser := getEnvInt("MAX_CONCURRENT_PER_USER", 1)
+	maxQueuedPerChat := getEnvInt("MAX_QUEUED_PER_CHAT", 10)
+
+	infoTimeout := getEnvDuration("YTDLP_INFO_TIMEOUT", 1*time.Minute)
+	retryAttempts := getEnvInt("YTDLP_RETRY_ATTEMPTS", 3)
+	retryBaseDelay := getEnvDuration("YTDLP_RETRY_BASE_DELAY", 2*time.Second)
+	retryMaxDelay := getEnvDuration("YTDLP_RETRY_MAX_DELAY", 30*time.Second)
+	httpMaxFileSize := getEnvSize("HTTP_MAX_FILE_SIZE", 2000*1024*1024)
+	httpMaxRedirects := getEnvInt("HTTP_MAX_REDIRECTS", 5)
+	urlAllowDomains := getEnvList("URL_ALLOW_DOMAINS", nil)
+	urlDenyDomains := getEnvList("URL_DENY_DOMAINS", nil)
+	allowPrivateURLs := getEnvBool("ALLOW_PRIVATE_URLS", false)
+	searchTimeout := getEnvDuration("YTDLP_SEARCH_TIMEOUT", 30*time.Second)
+	downloadTimeout := getEnvDuration("YTDLP_DOWNLOAD_TIMEOUT", 5*time.Minute)
+	progressEditInterval := getEnvDuration("PROGRESS_EDIT_INTERVAL", 3*time.Second)
+	shutdownTimeout := getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	downloadDirTTL := getEnvDuration("DOWNLOAD_DIR_TTL", 6*time.Hour)
+	downloadDirMaxSize := getEnvSize("DOWNLOAD_DIR_MAX_SIZE", 10<<30)
+	minFreeDisk := getEnvSize("MIN_FREE_DISK", 1<<30)
+	janitorInterval := getEnvDuration("JANITOR_INTERVAL", 10*time.Minute)
+
+	storeDriver := os.Getenv("STORE_DRIVER")
+	if storeDriver == "" {
+		storeDriver = "bolt"
+		log.Printf("STORE_DRIVER not set, using default: %s\n", storeDriver)
+	}
+	storePath := os.Getenv("STORE_PATH")
+	if storePath == "" {
+		storePath = "data/zebio.db"
+		log.Printf("STORE_PATH not set, using default: %s\n", storePath)
+	}
+
+	cacheMaxEntries := getEnvInt("CACHE_MAX_ENTRIES", 5000)
+	cacheTTL := getEnvDuration("CACHE_TTL", 30*24*time.Hour)
+	sessionTTL := getEnvDuration("SESSION_TTL", 1*time.Hour)
+	auditRetention := getEnvDuration("AUDIT_RETENTION", 90*24*time.Hour)
+
+	telegramAPIEndpoint := strings.TrimRight(os.Getenv("TELEGRAM_API_ENDPOINT"), "/")
+	if telegramAPIEndpoint != "" {
+		if !strings.Contains(telegramAPIEndpoint, "%s") {
+			telegramAPIEndpoint += "/bot%s/%s"
+		}
+		log.Printf("Custom Telegram Bot API endpoint configured: %s\n", telegramAPIEndpoint)
+	} else {
+		log.Println("TELEGRAM_API_ENDPOINT not set. Using api.telegram.org.")
+	}
+	telegramAPILocal := getEnvBool("TELEGRAM_API_LOCAL", false)
+	if telegramAPILocal && telegramAPIEndpoint == "" {
+		log.Println("Warning: TELEGRAM_API_LOCAL requires TELEGRAM_API_ENDPOINT. Local mode is disabled.")
+		telegramAPILocal = false
+	}
+
+	webhookURL := strings.TrimRight(os.Getenv("WEBHOOK_URL"), "/")
+	webhookListen := os.Getenv("WEBHOOK_LISTEN")
+	webhookPathSecret := os.Getenv("WEBHOOK_PATH_SECRET")
+	webhookSecretToken := os.Getenv("WEBHOOK_SECRET_TOKEN")
+	webhookTLSCert := os.Getenv("WEBHOOK_TLS_CERT")
+	webhookTLSKey := os.Getenv("WEBHOOK_TLS_KEY")
+	webhookUploadCert := false
+	webhookDeleteOnShutdown := false
+	if webhookURL != "" {
+		log.Printf("Webhook mode enabled with public URL: %s\n", webhookURL)
+		log.Printf("Webhook mode keeps its state in the %s store of this process. Run a single replica.\n", storeDriver)
+		if webhookListen == "" {
+			webhookListen = ":8443"
+			log.Printf("WEBHOOK_LISTEN not set, using default: %s\n", webhookListen)
+		}
+		if webhookPathSecret == "" {
+			log.Println("Warning: WEBHOOK_PATH_SECRET not set. The webhook path can be guessed.")
+		}
+		if webhookSecretToken == "" {
+			log.Println("Warning: WEBHOOK_SECRET_TOKEN not set. Incoming webhook requests are not verified.")
+		}
+		if (webhookTLSCert == "") != (webhookTLSKey == "") {
+			log.Println("Warning: Both WEBHOOK_TLS_CERT and WEBHOOK_TLS_KEY are needed for TLS. Serving plain HTTP.")
+			webhookTLSCert, webhookTLSKey = "", ""
+		}
+		webhookUploadCert = webhookTLSCert != "" && getEnvBool("WEBHOOK_UPLOAD_CERT", false)
+		webhookDeleteOnShutdown = getEnvBool("WEBHOOK_DELETE_ON_SHUTDOWN", false)
+	} else {
+		log.Println("WEBHOOK_URL not set. Using long polling.")
+	}
+
+	defaultUploadSize := int64(50 * 1024 * 1024)
+	if telegramAPILocal {
+		defaultUploadSize = 2000 * 1024 * 1024
+	}
+	maxUploadSize := getEnvSize("MAX_UPLOAD_SIZE", defaultUploadSize)
+	oversizeStrategies := getEnvList("OVERSIZE_STRATEGY", []string{"document", "reencode", "split"})
+	ffmpegPath := os.Getenv("FFMPEG_PATH")
+	if ffmpegPath == "" {
+		ffmpegPath = "ffmpeg"
+		log.Printf("FFMPEG_PATH not set, using default: %s\n", ffmpegPath)
+	}
+	ffprobePath := os.Getenv("FFPROBE_PATH")
+	if ffprobePath == "" {
+		ffprobePath = "ffprobe"
+		log.Printf("FFPROBE_PATH not set, using default: %s\n", ffprobePath)
+	}
+
 	return &Config{
 		TelegramBotToken:    token,
 		YTDLPPath:           ytDlpPath,
 		DownloadDir:         downloadDir,
 		AllowedUserIDs:      allowedUserIDs,
+		AdminUserIDs:        adminUserIDs,
 		ForceJoinChannel:    forceJoinChannel,
 		SpotifyClientID:     spotifyClientID,
 		SpotifyClientSecret: spotifyClientSecret,
 		YouTubeCookiesPath:  youTubeCookiesPath,
+
+		WorkerPoolSize:       workerPoolSize,
+		MaxConcurrentPerUser: maxConcurrentPerUser,
+		MaxQueuedPerChat:     maxQueuedPerChat,
+		MaxLinksPerMessage:   maxLinksPerMessage,
+
+		SearchResults:   searchResults,
+		SearchPlainText: searchPlainText,
+
+		InlineUploadChatID: inlineUploadChatID,
+		InlineMaxSearches:  inlineMaxSearches,
+
+		InfoTimeout:     infoTimeout,
+		SearchTimeout:   searchTimeout,
+		DownloadTimeout: downloadTimeout,
+		RetryAttempts:   retryAttempts,
+		RetryBaseDelay:  retryBaseDelay,
+		RetryMaxDelay:   retryMaxDelay,
+
+		HTTPMaxFileSize:  httpMaxFileSize,
+		HTTPMaxRedirects: httpMaxRedirects,
+
+		URLAllowDomains:  urlAllowDomains,
+		URLDenyDomains:   urlDenyDomains,
+		AllowPrivateURLs: allowPrivateURLs,
+
+		ProgressEditInterval: progressEditInterval,
+		ShutdownTimeout:      shutdownTimeout,
+
+		DownloadDirTTL:     downloadDirTTL,
+		DownloadDirMaxSize: downloadDirMaxSize,
+		MinFreeDisk:        minFreeDisk,
+		JanitorInterval:    janitorInterval,
+
+		StoreDriver: storeDriver,
+		StorePath:   storePath,
+
+		CacheMaxEntries: cacheMaxEntries,
+		CacheTTL:        cacheTTL,
+
+		SessionTTL:     sessionTTL,
+		AuditRetention: auditRetention,
+
+		TelegramAPIEndpoint: telegramAPIEndpoint,
+		TelegramAPILocal:    telegramAPILocal,
+
+		WebhookURL:              webhookURL,
+		WebhookListen:           webhookListen,
+		WebhookPathSecret:       webhookPathSecret,
+		WebhookSecretToken:      webhookSecretToken,
+		WebhookTLSCert:          webhookTLSCert,
+		WebhookTLSKey:           webhookTLSKey,
+		WebhookUploadCert:       webhookUploadCert,
+		WebhookDeleteOnShutdown: webhookDeleteOnShutdown,
+
+		MaxUploadSize:      maxUploadSize,
+		OversizeStrategies: oversizeStrategies,
+		FFmpegPath:         ffmpegPath,
+		FFprobePath:        ffprobePath,
 	}, nil
 }
+
+func parseUserIDs(value string) []int64 {
+	var userIDs []int64
+	if value == "" {
+		return userIDs
+	}
+	for _, idStr := range strings.Split(value, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
+		if err != nil {
+			log.Printf("Warning: Could not parse user ID '%s': %v. Skipping.\n", idStr, err)
+			continue
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs
+}
+
+func getEnvInt(name string, defaultValue int) int {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		log.Printf("%s not set, using default: %d\n", name, defaultValue)
+		return defaultValue
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(valueStr))
+	if err != nil || value <= 0 {
+		log.Printf("Warning: Invalid value '%s' for %s. Using default: %d\n", valueStr, name, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvChatID parses a Telegram chat ID. Unlike getEnvInt it accepts
+// negative values, which groups and channels have.
+func getEnvChatID(name string, defaultValue int64) int64 {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		log.Printf("%s not set, using default: %d\n", name, defaultValue)
+		return defaultValue
+	}
+	value, err := strconv.ParseInt(strings.TrimSpace(valueStr), 10, 64)
+	if err != nil || value == 0 {
+		log.Printf("Warning: Invalid value '%s' for %s. Using default: %d\n", valueStr, name, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDuration(name string, defaultValue time.Duration) time.Duration {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		log.Printf("%s not set, using default: %s\n", name, defaultValue)
+		return defaultValue
+	}
+	value, err := time.ParseDuration(strings.TrimSpace(valueStr))
+	if err != nil || value <= 0 {
+		log.Printf("Warning: Invalid duration '%s' for %s. Using default: %s\n", valueStr, name, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvBool(name string, defaultValue bool) bool {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		log.Printf("%s not set, using default: %t\n", name, defaultValue)
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(strings.TrimSpace(valueStr))
+	if err != nil {
+		log.Printf("Warning: Invalid boolean '%s' for %s. Using default: %t\n", valueStr, name, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvSize accepts a plain byte count or a number with a KB, MB or GB suffix.
+func getEnvSize(name string, defaultValue int64) int64 {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		log.Printf("%s not set, using default: %d bytes\n", name, defaultValue)
+		return defaultValue
+	}
+	value, err := parseSize(valueStr)
+	if err != nil || value <= 0 {
+		log.Printf("Warning: Invalid size '%s' for %s. Using default: %d bytes\n", valueStr, name, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.size
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+func getEnvList(name string, defaultValue []string) []string {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		log.Printf("%s not set, using default: %s\n", name, strings.Join(defaultValue, ","))
+		return defaultValue
+	}
+	var values []string
+	for _, item := range strings.Split(valueStr, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
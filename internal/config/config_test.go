@@ -0,0 +1,26 @@
+package config
+
+import "testing"
+
+func TestGetEnvChatID(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int64
+	}{
+		{"unset", "", 0},
+		{"channel", "-1001234567890", -1001234567890},
+		{"group", " -4242 ", -4242},
+		{"user", "123456789", 123456789},
+		{"zero", "0", 0},
+		{"not a number", "@channel", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_CHAT_ID", tt.value)
+			if got := getEnvChatID("TEST_CHAT_ID", 0); got != tt.want {
+				t.Errorf("getEnvChatID(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
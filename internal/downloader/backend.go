@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotSupported is returned by a backend for a request it cannot serve, so
+// the next backend gets a chance.
+var ErrNotSupported = errors.New("not supported by this backend")
+
+// SearchSite names a site a backend can search for a track.
+type SearchSite string
+
+const (
+	SearchYouTube    SearchSite = "YouTube"
+	SearchSoundCloud SearchSite = "SoundCloud"
+)
+
+// Backend fetches media for the URLs it handles. Downloader routes every call
+// to the first backend that handles the URL and does not return
+// ErrNotSupported.
+type Backend interface {
+	Name() string
+	Handles(urlStr string) bool
+	// Probe describes the media behind urlStr without downloading it.
+	Probe(ctx context.Context, urlStr string, username string) (*LinkInfo, error)
+	// Search returns up to limit matches for query on site, best first.
+	Search(ctx context.Context, site SearchSite, query string, limit int, username string) ([]SearchResult, error)
+	// Download saves the media to req.Dir and returns the path of the file.
+	Download(ctx context.Context, req DownloadRequest) (string, error)
+}
+
+type SearchResult struct {
+	Site    SearchSite `json:"site"`
+	URL     string     `json:"url"`
+	Title   string     `json:"title"`
+	Channel string     `json:"channel,omitempty"`
+	// Extractor and ID match the TrackInfo fields of the same media when the
+	// site reported them.
+	Extractor string `json:"extractor,omitempty"`
+	ID        string `json:"id,omitempty"`
+	// Duration is in seconds. It and Views are zero when unknown.
+	Duration float64 `json:"duration,omitempty"`
+	Views    int64   `json:"views,omitempty"`
+}
+
+type DownloadRequest struct {
+	URL      string
+	Username string
+	Spec     MediaSpec
+	Info     *TrackInfo
+	// Dir is an empty working directory owned by this download. The file
+	// should be named Name plus its extension.
+	Dir        string
+	Name       string
+	OnProgress ProgressFunc
+}
+
+// MediaURL is the URL the file itself is fetched from, which can differ from
+// the page the user sent.
+func (r DownloadRequest) MediaURL() string {
+	switch {
+	case r.Spec.Type == ImageBest && r.Info.DirectImageURL != "":
+		return r.Info.DirectImageURL
+	case r.Spec.Type != ImageBest && r.Info.URL != "":
+		return r.Info.URL
+	}
+	return r.URL
+}
@@ -1,35 +1,51 @@
 package downloader
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Mohammad-Alipour/Zebio/internal/config"
+	"github.com/Mohammad-Alipour/Zebio/internal/urlguard"
 )
 
 type DownloadType int
 
+// jobDirPrefix names the per-download working directories.
+const jobDirPrefix = "job-"
+
 const (
 	AudioOnly DownloadType = iota
 	VideoBest
 	ImageBest
 )
 
+// Downloader routes requests to its backends and owns the download directory
+// they write to.
 type Downloader struct {
-	ytDLPPath          string
-	downloadDir        string
-	youTubeCookiesPath string
+	backends    []Backend
+	downloadDir string
+	// guard vets every URL before a backend sees it. The backends connect
+	// through it as well, yt-dlp by way of proxy, so redirects and DNS
+	// answers are checked when the connection is made.
+	guard *urlguard.Guard
+	proxy *urlguard.Proxy
+
+	mu sync.Mutex
+	// activeDirs holds the working directories of downloads whose files have
+	// not been removed yet.
+	activeDirs map[string]bool
 }
 
 type TrackInfo struct {
+	ID             string
+	Extractor      string
 	Title          string
 	Artist         string
 	ThumbnailURL   string
@@ -41,6 +57,8 @@ type TrackInfo struct {
 	HasImage       bool
 	IsAudioOnly    bool
 	DirectImageURL string
+	Duration       float64
+	Formats        []Format
 }
 
 type LinkInfo struct {
@@ -51,363 +69,254 @@ type LinkInfo struct {
 	OriginalURL string
 }
 
-type ytdlpJSONEntry struct {
-	ID           string `json:"id"`
-	Title        string `json:"title"`
-	Artist       string `json:"artist"`
-	Creator      string `json:"creator"`
-	Uploader     string `json:"uploader"`
-	Thumbnail    string `json:"thumbnail"`
-	DisplayURL   string `json:"display_url"`
-	URL          string `json:"url"`
-	Ext          string `json:"ext"`
-	Vcodec       string `json:"vcodec"`
-	Acodec       string `json:"acodec"`
-	ExtractorKey string `json:"extractor_key"`
-	Filename     string `json:"_filename"`
-	WebpageURL   string `json:"webpage_url"`
-	Thumbnails   []struct {
-		URL    string `json:"url"`
-		Width  int    `json:"width"`
-		Height int    `json:"height"`
-	} `json:"thumbnails"`
+// New creates a Downloader that fetches direct media links itself and
+// everything else with yt-dlp.
+func New(cfg *config.Config) (*Downloader, error) {
+	guard := urlguard.New(urlguard.Options{
+		AllowDomains: cfg.URLAllowDomains,
+		DenyDomains:  cfg.URLDenyDomains,
+		AllowPrivate: cfg.AllowPrivateURLs,
+	})
+	proxy, err := guard.StartProxy()
+	if err != nil {
+		return nil, err
+	}
+	ytdlp := NewYTDLP(cfg.YTDLPPath, cfg.YouTubeCookiesPath, Options{
+		InfoTimeout:     cfg.InfoTimeout,
+		SearchTimeout:   cfg.SearchTimeout,
+		DownloadTimeout: cfg.DownloadTimeout,
+		RetryAttempts:   cfg.RetryAttempts,
+		RetryBaseDelay:  cfg.RetryBaseDelay,
+		RetryMaxDelay:   cfg.RetryMaxDelay,
+		Proxy:           proxy.URL(),
+	})
+	direct := NewHTTP(HTTPOptions{
+		InfoTimeout:     cfg.InfoTimeout,
+		DownloadTimeout: cfg.DownloadTimeout,
+		MaxFileSize:     cfg.HTTPMaxFileSize,
+		MaxRedirects:    cfg.HTTPMaxRedirects,
+		ResumeAttempts:  cfg.RetryAttempts,
+		Guard:           guard,
+	})
+	d, err := NewWithBackends(cfg.DownloadDir, guard, direct, ytdlp)
+	if err != nil {
+		proxy.Close()
+		return nil, err
+	}
+	d.proxy = proxy
+	return d, nil
 }
 
-type ytdlpPlaylistJSON struct {
-	Type       string           `json:"_type"`
-	Title      string           `json:"title"`
-	Uploader   string           `json:"uploader"`
-	WebpageURL string           `json:"webpage_url"`
-	Entries    []ytdlpJSONEntry `json:"entries"`
+// Close stops the URL guard proxy. Running yt-dlp calls lose their
+// connections.
+func (d *Downloader) Close() {
+	if d.proxy != nil {
+		d.proxy.Close()
+	}
 }
 
-func New(cfg *config.Config) (*Downloader, error) {
-	if _, err := os.Stat(cfg.DownloadDir); os.IsNotExist(err) {
-		log.Printf("Download directory '%s' does not exist. Creating it...\n", cfg.DownloadDir)
-		if err := os.MkdirAll(cfg.DownloadDir, 0755); err != nil {
-			return nil, fmt.Errorf("failed to create download directory '%s': %w", cfg.DownloadDir, err)
+// NewWithBackends creates a Downloader that tries the backends in the given
+// order. A nil guard lets every URL through.
+func NewWithBackends(downloadDir string, guard *urlguard.Guard, backends ...Backend) (*Downloader, error) {
+	if _, err := os.Stat(downloadDir); os.IsNotExist(err) {
+		log.Printf("Download directory '%s' does not exist. Creating it...\n", downloadDir)
+		if err := os.MkdirAll(downloadDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create download directory '%s': %w", downloadDir, err)
 		}
-		log.Printf("Download directory '%s' created successfully.\n", cfg.DownloadDir)
+		log.Printf("Download directory '%s' created successfully.\n", downloadDir)
 	} else if err != nil {
-		return nil, fmt.Errorf("error checking download directory '%s': %w", cfg.DownloadDir, err)
+		return nil, fmt.Errorf("error checking download directory '%s': %w", downloadDir, err)
 	}
 	return &Downloader{
-		ytDLPPath:          cfg.YTDLPPath,
-		downloadDir:        cfg.DownloadDir,
-		youTubeCookiesPath: cfg.YouTubeCookiesPath,
+		backends:    backends,
+		downloadDir: downloadDir,
+		guard:       guard,
+		activeDirs:  make(map[string]bool),
 	}, nil
 }
 
-func (d *Downloader) GetLinkInfo(urlStr string, username string) (*LinkInfo, error) {
-	log.Printf("[%s] Fetching link info for URL: %s\n", username, urlStr)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
-	defer cancel()
-
-	baseArgs := []string{"-J"}
-	if d.youTubeCookiesPath != "" && strings.Contains(urlStr, "youtu") {
-		baseArgs = append(baseArgs, "--cookies", d.youTubeCookiesPath)
-	}
-
-	var finalArgs []string
-	if strings.Contains(urlStr, "soundcloud.com") && (strings.Contains(urlStr, "/sets/") || strings.Contains(urlStr, "/playlists/")) {
-		finalArgs = append(baseArgs, "--flat-playlist", urlStr)
-	} else {
-		finalArgs = append(baseArgs, "--no-playlist", urlStr)
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, timeout)
+}
 
-	cmd := exec.CommandContext(ctx, d.ytDLPPath, finalArgs...)
-
-	var jsonData bytes.Buffer
-	var stderrBuf bytes.Buffer
-	cmd.Stdout = &jsonData
-	cmd.Stderr = &stderrBuf
-
-	err := cmd.Run()
-	if stderrBuf.Len() > 0 {
-		log.Printf("[%s] yt-dlp (info) STDERR for %s:\n%s\n", username, urlStr, stderrBuf.String())
+// CheckURL returns the normalized form of a user supplied link, or an
+// urlguard error if the bot must not fetch it.
+func (d *Downloader) CheckURL(ctx context.Context, urlStr string) (string, error) {
+	if d.guard == nil {
+		return strings.TrimSpace(urlStr), nil
 	}
+	u, err := d.guard.Check(ctx, urlStr)
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return nil, fmt.Errorf("yt-dlp command timed out for getting info from %s", urlStr)
-		}
-		if _, ok := err.(*exec.ExitError); !ok {
-			return nil, fmt.Errorf("[%s] failed to run yt-dlp for %s: %w", username, urlStr, err)
-		}
-	}
-
-	if jsonData.Len() == 0 {
-		return nil, fmt.Errorf("[%s] yt-dlp returned no JSON data for %s", username, urlStr)
+		return "", err
 	}
-
-	var output ytdlpPlaylistJSON
-	if err := json.Unmarshal(jsonData.Bytes(), &output); err == nil && output.Type == "playlist" {
-		linkInfo := &LinkInfo{
-			Type:        "album",
-			Title:       output.Title,
-			Uploader:    output.Uploader,
-			OriginalURL: output.WebpageURL,
-		}
-		for _, entryData := range output.Entries {
-			track := parseTrackInfoFromData(entryData)
-			linkInfo.Tracks = append(linkInfo.Tracks, track)
-		}
-		log.Printf("[%s] Album/Playlist info fetched: Title: '%s', Track Count: %d\n", username, linkInfo.Title, len(linkInfo.Tracks))
-		return linkInfo, nil
-	}
-
-	var singleEntry ytdlpJSONEntry
-	if err := json.Unmarshal(jsonData.Bytes(), &singleEntry); err != nil {
-		return nil, fmt.Errorf("[%s] failed to unmarshal yt-dlp JSON for %s: %w", username, urlStr, err)
-	}
-
-	track := parseTrackInfoFromData(singleEntry)
-	linkInfo := &LinkInfo{
-		Type:        "track",
-		Title:       track.Title,
-		Uploader:    track.Artist,
-		OriginalURL: track.OriginalURL,
-		Tracks:      []*TrackInfo{track},
-	}
-	return linkInfo, nil
+	return u.String(), nil
 }
 
-func parseTrackInfoFromData(data ytdlpJSONEntry) *TrackInfo {
-	info := &TrackInfo{
-		Title:        data.Title,
-		Artist:       data.Artist,
-		ThumbnailURL: data.Thumbnail,
-		Extension:    data.Ext,
-		Filename:     data.Filename,
-		OriginalURL:  data.WebpageURL,
-		URL:          data.URL,
+func (d *Downloader) GetLinkInfo(ctx context.Context, urlStr string, username string) (*LinkInfo, error) {
+	log.Printf("[%s] Fetching link info for URL: %s\n", username, urlStr)
+	if _, err := d.CheckURL(ctx, urlStr); err != nil {
+		log.Printf("[%s] Refusing to fetch %s: %v\n", username, urlStr, err)
+		return nil, err
 	}
-
-	if info.Artist == "" {
-		if data.Creator != "" {
-			info.Artist = data.Creator
-		} else {
-			info.Artist = data.Uploader
+	for _, backend := range d.backends {
+		if !backend.Handles(urlStr) {
+			continue
 		}
-	}
-	if info.Artist == "" {
-		info.Artist = "Unknown Artist"
-	}
-	if info.Title == "" {
-		if data.ID != "" {
-			info.Title = data.ID
-		} else {
-			info.Title = "Unknown Title"
+		info, err := backend.Probe(ctx, urlStr, username)
+		if errors.Is(err, ErrNotSupported) {
+			continue
 		}
+		return info, err
 	}
-
-	if data.Vcodec != "none" && data.Vcodec != "" {
-		info.HasVideo = true
-	}
-
-	if data.ExtractorKey == "Instagram" && !info.HasVideo {
-		info.HasImage = true
-		if data.DisplayURL != "" {
-			info.DirectImageURL = data.DisplayURL
-		} else if data.URL != "" && (strings.HasSuffix(data.URL, ".jpg") || strings.HasSuffix(data.URL, ".jpeg")) {
-			info.DirectImageURL = data.URL
-		} else if len(data.Thumbnails) > 0 {
-			var bestThumbnailURL string
-			var maxWidth int = 0
-			for _, t := range data.Thumbnails {
-				if t.Width > maxWidth {
-					maxWidth = t.Width
-					bestThumbnailURL = t.URL
-				}
-			}
-			info.DirectImageURL = bestThumbnailURL
-		}
-	}
-
-	if !info.HasVideo && !info.HasImage && data.Acodec != "none" && data.Acodec != "" {
-		info.IsAudioOnly = true
-	}
-	return info
+	return nil, fmt.Errorf("no backend can fetch %s: %w", urlStr, ErrUnsupportedURL)
 }
 
-func (d *Downloader) FindYouTubeURL(query string, username string) (string, error) {
-	log.Printf("[%s] Searching on YouTube for: %s", username, query)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	args := []string{}
-	if d.youTubeCookiesPath != "" {
-		args = append(args, "--cookies", d.youTubeCookiesPath)
-	}
-	args = append(args, "--get-url", fmt.Sprintf("ytsearch1:\"%s\"", query))
-
-	cmd := exec.CommandContext(ctx, d.ytDLPPath, args...)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("yt-dlp Youtube timed out for query: %s", query)
+func (d *Downloader) Search(ctx context.Context, site SearchSite, query string, limit int, username string) ([]SearchResult, error) {
+	log.Printf("[%s] Searching on %s for: %s", username, site, query)
+	for _, backend := range d.backends {
+		results, err := backend.Search(ctx, site, query, limit, username)
+		if errors.Is(err, ErrNotSupported) {
+			continue
 		}
-		log.Printf("[%s] yt-dlp Youtube failed. STDERR: %s", username, stderr.String())
-		return "", fmt.Errorf("could not find a youtube video for query '%s': %w", query, err)
-	}
-
-	youtubeURL := strings.TrimSpace(stdout.String())
-	if youtubeURL == "" {
-		return "", fmt.Errorf("yt-dlp Youtube returned an empty URL for query '%s'", query)
+		return results, err
 	}
-
-	log.Printf("[%s] Youtube found URL: %s", username, youtubeURL)
-	return youtubeURL, nil
+	return nil, fmt.Errorf("no backend can search %s: %w", site, ErrNotSupported)
 }
 
-func (d *Downloader) FindSoundCloudURL(query string, username string) (string, error) {
-	log.Printf("[%s] Searching on SoundCloud for: %s", username, query)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, d.ytDLPPath, "-J", "--no-playlist", fmt.Sprintf("scsearch1:\"%s\"", query))
-
-	var jsonData, stderr bytes.Buffer
-	cmd.Stdout = &jsonData
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("yt-dlp SoundCloud search timed out for query: %s", query)
-		}
-		log.Printf("[%s] yt-dlp SoundCloud search failed. STDERR: %s", username, stderr.String())
-		return "", fmt.Errorf("could not find a soundcloud track for query '%s': %w", query, err)
-	}
-
-	var searchResult struct {
-		Entries []struct {
-			WebpageURL string `json:"webpage_url"`
-		} `json:"entries"`
-	}
-
-	if err := json.Unmarshal(jsonData.Bytes(), &searchResult); err != nil {
-		return "", fmt.Errorf("could not parse soundcloud search result: %w", err)
+// FindURL returns the URL of the best match for query on site.
+func (d *Downloader) FindURL(ctx context.Context, site SearchSite, query string, username string) (string, error) {
+	results, err := d.Search(ctx, site, query, 1, username)
+	if err != nil {
+		return "", err
 	}
-
-	if len(searchResult.Entries) == 0 || searchResult.Entries[0].WebpageURL == "" {
-		return "", fmt.Errorf("yt-dlp SoundCloud search returned no results for query '%s'", query)
+	if len(results) == 0 {
+		return "", fmt.Errorf("%s search returned no results for query '%s'", site, query)
 	}
-
-	soundcloudURL := strings.TrimSpace(searchResult.Entries[0].WebpageURL)
-	log.Printf("[%s] SoundCloud search found URL: %s", username, soundcloudURL)
-	return soundcloudURL, nil
+	log.Printf("[%s] %s search found URL: %s", username, site, results[0].URL)
+	return results[0].URL, nil
 }
 
-func (d *Downloader) DownloadMedia(urlStr string, username string, prefType DownloadType, info *TrackInfo) (string, string, error) {
-	log.Printf("[%s] Starting download for URL: %s (Title: %s, Preferred Type: %v)\n", username, urlStr, info.Title, prefType)
+func (d *Downloader) DownloadMedia(ctx context.Context, urlStr string, username string, spec MediaSpec, info *TrackInfo, onProgress ProgressFunc) (string, string, error) {
+	log.Printf("[%s] Starting download for URL: %s (Title: %s, Preferred Type: %v, Spec: %s)\n", username, urlStr, info.Title, spec.Type, spec.Key())
 	start := time.Now()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-
-	outputFilename := fmt.Sprintf("%s - %s", info.Artist, info.Title)
-	outputTemplateBase := filepath.Join(d.downloadDir, outputFilename)
-
-	downloadURL := urlStr
-	if prefType != ImageBest && info.URL != "" {
-		downloadURL = info.URL
-	}
-
-	baseArgs := []string{"-v", "--no-playlist"}
-	if d.youTubeCookiesPath != "" && strings.Contains(downloadURL, "youtu") {
-		baseArgs = append(baseArgs, "--cookies", d.youTubeCookiesPath)
-	}
-
-	var cmdArgs []string
-	switch prefType {
-	case AudioOnly:
-		cmdArgs = append(baseArgs, "-f", "bestaudio/best", "--extract-audio", "--audio-format", "mp3", "--restrict-filenames", "--embed-thumbnail", "-o", outputTemplateBase+".%(ext)s", downloadURL)
-	case VideoBest:
-		cmdArgs = append(baseArgs, "-f", "bestvideo[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best", "--merge-output-format", "mp4", "--restrict-filenames", "--embed-thumbnail", "-o", outputTemplateBase+".%(ext)s", downloadURL)
-	case ImageBest:
-		if info.DirectImageURL != "" {
-			downloadURL = info.DirectImageURL
-		}
-		cmdArgs = append(baseArgs, "--restrict-filenames", "-o", outputTemplateBase+".%(ext)s", downloadURL)
-	default:
+	if spec.Type != AudioOnly && spec.Type != VideoBest && spec.Type != ImageBest {
 		return "", "", fmt.Errorf("[%s] unknown download type requested", username)
 	}
 
-	cmd := exec.CommandContext(ctx, d.ytDLPPath, cmdArgs...)
-
-	var stdoutBuf, stderrBuf bytes.Buffer
-	cmd.Stdout = &stdoutBuf
-	cmd.Stderr = &stderrBuf
-
-	log.Printf("[%s] Executing yt-dlp download command: %s\n", username, strings.Join(cmd.Args, " "))
-	err := cmd.Run()
-
-	if stdoutBuf.Len() > 0 {
-		log.Printf("[%s] yt-dlp (download) STDOUT:\n%s\n", username, stdoutBuf.String())
-	}
-	if stderrBuf.Len() > 0 {
-		log.Printf("[%s] yt-dlp (download) STDERR:\n%s\n", username, stderrBuf.String())
-	}
-
+	// Each download gets its own directory so concurrent downloads of the same
+	// title cannot pick up or delete each other's files.
+	workDir, err := os.MkdirTemp(d.downloadDir, jobDirPrefix)
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", "", fmt.Errorf("yt-dlp download timed out for %s", urlStr)
+		return "", "", fmt.Errorf("[%s] failed to create working directory: %w", username, err)
+	}
+	d.setActive(workDir, true)
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			d.setActive(workDir, false)
+			os.RemoveAll(workDir)
+		}
+	}()
+
+	req := DownloadRequest{
+		URL:        urlStr,
+		Username:   username,
+		Spec:       spec,
+		Info:       info,
+		Dir:        workDir,
+		Name:       storedFilename(info),
+		OnProgress: onProgress,
+	}
+	mediaURL := req.MediaURL()
+	for _, target := range []string{urlStr, mediaURL} {
+		if _, err := d.CheckURL(ctx, target); err != nil {
+			log.Printf("[%s] Refusing to download %s: %v\n", username, target, err)
+			return "", "", err
 		}
-		return "", "", fmt.Errorf("[%s] yt-dlp download execution failed: %w. STDERR: %s", username, err, stderrBuf.String())
 	}
 
-	actualFilename, findErr := findDownloadedFile(d.downloadDir, outputFilename, username)
-	if findErr != nil {
-		return "", "", fmt.Errorf("[%s] yt-dlp ran but downloaded file could not be reliably found (basename: %s): %w", username, outputFilename, findErr)
+	var actualFilename, backendName string
+	err = fmt.Errorf("no backend can download %s: %w", mediaURL, ErrUnsupportedURL)
+	for _, backend := range d.backends {
+		if !backend.Handles(mediaURL) {
+			continue
+		}
+		path, downloadErr := backend.Download(ctx, req)
+		if !errors.Is(downloadErr, ErrNotSupported) {
+			actualFilename, backendName, err = path, backend.Name(), downloadErr
+			break
+		}
 	}
+	if err != nil {
+		return "", "", err
+	}
+	succeeded = true
 
 	detectedExt := strings.TrimPrefix(filepath.Ext(actualFilename), ".")
 	elapsed := time.Since(start)
-	log.Printf("[%s] Download and processing for %s finished in %s. File: %s, Actual Ext: %s\n", username, urlStr, elapsed, actualFilename, detectedExt)
+	log.Printf("[%s] Download and processing for %s finished with %s in %s. File: %s, Actual Ext: %s\n", username, urlStr, backendName, elapsed, actualFilename, detectedExt)
 	return actualFilename, detectedExt, nil
 }
 
-func findDownloadedFile(dir, baseName, username string) (string, error) {
-	log.Printf("[%s] findDownloadedFile: Scanning directory '%s' for files starting with '%s'\n", username, dir, baseName)
-	entries, err := os.ReadDir(dir)
+// CleanDownloadDir removes every file and working directory left in the
+// download directory. Working directories of downloads that are still
+// running or waiting to be sent are kept.
+func (d *Downloader) CleanDownloadDir() (int, error) {
+	entries, err := os.ReadDir(d.downloadDir)
 	if err != nil {
-		return "", fmt.Errorf("failed to read directory %s: %w", dir, err)
+		return 0, fmt.Errorf("failed to read directory %s: %w", d.downloadDir, err)
 	}
-
-	var latestFile string
-	var latestModTime time.Time
-	var fileMatched bool = false
-	var foundFiles []string
-
+	removed := 0
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasPrefix(entry.Name(), baseName) {
-			filePath := filepath.Join(dir, entry.Name())
-			info, statErr := os.Stat(filePath)
-			if statErr != nil {
-				log.Printf("[%s] findDownloadedFile: Stat failed for %s: %v. Skipping.\n", username, filePath, statErr)
-				continue
-			}
-			if !fileMatched || info.ModTime().After(latestModTime) {
-				latestModTime = info.ModTime()
-				latestFile = filePath
-				fileMatched = true
-			}
-			foundFiles = append(foundFiles, filePath)
+		isWorkDir := entry.IsDir() && strings.HasPrefix(entry.Name(), jobDirPrefix)
+		if !entry.Type().IsRegular() && !isWorkDir {
+			continue
+		}
+		if d.InUse(entry.Name()) {
+			continue
+		}
+		filePath := filepath.Join(d.downloadDir, entry.Name())
+		if err := os.RemoveAll(filePath); err != nil {
+			log.Printf("Could not remove leftover file %s: %v\n", filePath, err)
+			continue
 		}
+		removed++
 	}
+	return removed, nil
+}
 
-	if !fileMatched {
-		return "", fmt.Errorf("no file found starting with basename '%s' in directory '%s'", baseName, dir)
+// RemoveDownload deletes a file returned by DownloadMedia together with its
+// working directory and anything else created in it.
+func (d *Downloader) RemoveDownload(path string) {
+	dir := filepath.Dir(path)
+	if filepath.Dir(dir) != filepath.Clean(d.downloadDir) || !strings.HasPrefix(filepath.Base(dir), jobDirPrefix) {
+		os.Remove(path)
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Could not remove working directory %s: %v\n", dir, err)
 	}
+	d.setActive(dir, false)
+}
 
-	if len(foundFiles) > 1 {
-		log.Printf("[%s] Warning: Multiple files found starting with basename '%s': %v. Selected latest: %s\n", username, baseName, foundFiles, latestFile)
+func (d *Downloader) setActive(workDir string, active bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if active {
+		d.activeDirs[filepath.Base(workDir)] = true
+	} else {
+		delete(d.activeDirs, filepath.Base(workDir))
 	}
+}
 
-	log.Printf("[%s] findDownloadedFile: File selected: %s\n", username, latestFile)
-	return latestFile, nil
+// InUse reports whether the named entry of the download directory belongs to
+// a download that is still running or waiting to be sent.
+func (d *Downloader) InUse(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.activeDirs[name]
 }
@@ -0,0 +1,38 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanDownloadDirKeepsActiveDownloads(t *testing.T) {
+	dir := t.TempDir()
+	d := &Downloader{downloadDir: dir, activeDirs: make(map[string]bool)}
+	for _, name := range []string{"job-running", "job-leftover"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "song.mp3"), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stray.part"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d.setActive(filepath.Join(dir, "job-running"), true)
+
+	removed, err := d.CleanDownloadDir()
+	if err != nil {
+		t.Fatalf("CleanDownloadDir() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("CleanDownloadDir() removed %d entries, want 2", removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "job-running", "song.mp3")); err != nil {
+		t.Errorf("file of the running download was removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "job-leftover")); !os.IsNotExist(err) {
+		t.Errorf("leftover working directory was kept: %v", err)
+	}
+}
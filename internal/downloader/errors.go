@@ -0,0 +1,125 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/urlguard"
+)
+
+// Failure kinds recognized in yt-dlp output. Use errors.Is to test for them.
+var (
+	ErrUnsupportedURL = errors.New("unsupported URL")
+	ErrUnavailable    = errors.New("content is unavailable")
+	ErrPrivateContent = errors.New("content is private")
+	ErrGeoBlocked     = errors.New("content is blocked in this region")
+	ErrLoginRequired  = errors.New("login required")
+	ErrRateLimited    = errors.New("rate limited by the site")
+	ErrTooLarge       = errors.New("file is too large")
+	ErrTimeout        = errors.New("timed out")
+	ErrLiveStream     = errors.New("live streams are not supported")
+	ErrDRM            = errors.New("content is DRM protected")
+
+	ErrNetwork           = errors.New("network error")
+	ErrFormatUnavailable = errors.New("requested format is not available")
+	ErrCookies           = errors.New("cookies were rejected")
+	// ErrBotCheck is YouTube asking to sign in to prove the client is not a
+	// bot. Waiting does not help; only cookies of a signed in account do.
+	ErrBotCheck = errors.New("site asked to confirm this is not a bot")
+)
+
+// Error describes a failed backend call. Its message never includes the raw
+// output, which is kept in Stderr for logging only.
+type Error struct {
+	Backend string
+	Op      string
+	URL     string
+	// Kind is one of the Err values above, or nil when the failure could not
+	// be classified.
+	Kind   error
+	Stderr string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %s failed for %s", e.Backend, e.Op, e.URL)
+	if e.Kind != nil {
+		msg += ": " + e.Kind.Error()
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// stderrPatterns are checked in order, so the more specific phrases of a kind
+// come before the generic ones of another.
+var stderrPatterns = []struct {
+	kind    error
+	phrases []string
+}{
+	// The guard proxy refused a connection, e.g. after a redirect to an
+	// internal address.
+	{urlguard.ErrBlockedAddress, []string{"blocked by urlguard"}},
+	{ErrDRM, []string{"drm protected", "this video is drm", "drm-protected", "uses drm"}},
+	{ErrLiveStream, []string{"is live", "live event will begin", "premieres in", "is a livestream", "live stream recording is not available"}},
+	// Comes before ErrLoginRequired, as the message also suggests --cookies.
+	{ErrBotCheck, []string{"not a bot"}},
+	{ErrRateLimited, []string{"http error 429", "too many requests", "rate-limit", "rate limit"}},
+	{ErrCookies, []string{"cookies are no longer valid", "invalid cookies", "failed to load cookies", "cookies file", "netscape format"}},
+	{ErrGeoBlocked, []string{"available in your country", "geo restricted", "geo-restricted", "blocked it in your country", "not available from your location", "available in your region"}},
+	{ErrPrivateContent, []string{"private video", "video is private", "this track is private", "playlist is private", "account is private"}},
+	{ErrLoginRequired, []string{"sign in to confirm your age", "login required", "requires authentication", "use --cookies", "members-only", "join this channel", "log in to", "login to"}},
+	{ErrTooLarge, []string{"larger than max-filesize", "file is larger than"}},
+	{ErrTimeout, []string{"timed out", "timeout"}},
+	{ErrNetwork, []string{"connection reset", "connection refused", "connection aborted", "remote end closed", "temporary failure in name resolution", "name or service not known", "network is unreachable", "http error 500", "http error 502", "http error 503", "http error 504", "incompleteread"}},
+	{ErrFormatUnavailable, []string{"requested format is not available", "no video formats found", "format not available"}},
+	{ErrUnsupportedURL, []string{"unsupported url", "no suitable extractor", "is not a valid url"}},
+	{ErrUnavailable, []string{"video unavailable", "has been removed", "http error 404", "does not exist", "no longer available", "content is not available"}},
+}
+
+// classifyStderr maps the ERROR lines of yt-dlp output to a failure kind.
+// It returns nil when nothing matches.
+func classifyStderr(stderr string) error {
+	var errorLines []string
+	for _, line := range strings.Split(stderr, "\n") {
+		if strings.Contains(line, "ERROR:") {
+			errorLines = append(errorLines, strings.ToLower(line))
+		}
+	}
+	// Without an ERROR line, fall back to the whole output.
+	text := strings.Join(errorLines, "\n")
+	if text == "" {
+		text = strings.ToLower(stderr)
+	}
+	for _, pattern := range stderrPatterns {
+		for _, phrase := range pattern.phrases {
+			if strings.Contains(text, phrase) {
+				return pattern.kind
+			}
+		}
+	}
+	return nil
+}
+
+func newError(op, url, stderr string, err error) *Error {
+	return &Error{Backend: "yt-dlp", Op: op, URL: url, Kind: classifyStderr(stderr), Stderr: stderr, Err: err}
+}
+
+// Retryable reports whether the failure is likely temporary, so trying again
+// later may succeed.
+func Retryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrTimeout) || errors.Is(err, ErrNetwork)
+}
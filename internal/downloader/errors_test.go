@@ -0,0 +1,41 @@
+package downloader
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   error
+	}{
+		{"bot check", "ERROR: [youtube] dQw4w9WgXcQ: Sign in to confirm you’re not a bot. Use --cookies-from-browser or --cookies for the authentication.", ErrBotCheck},
+		{"bot check with ascii apostrophe", "ERROR: [youtube] abc: Sign in to confirm you're not a bot. This helps protect our community.", ErrBotCheck},
+		{"age gate", "ERROR: [youtube] abc: Sign in to confirm your age. This video may be inappropriate for some users. Use --cookies", ErrLoginRequired},
+		{"rate limit", "ERROR: unable to download video data: HTTP Error 429: Too Many Requests", ErrRateLimited},
+		{"unavailable", "ERROR: [youtube] abc: Video unavailable", ErrUnavailable},
+		{"unknown", "ERROR: something new went wrong", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyStderr(tt.stderr); got != tt.want {
+				t.Errorf("classifyStderr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBotCheckIsNotRetryable(t *testing.T) {
+	err := newError("download", "https://youtu.be/abc", "ERROR: [youtube] abc: Sign in to confirm you’re not a bot.", errors.New("exit status 1"))
+	if !errors.Is(err, ErrBotCheck) {
+		t.Fatalf("error %v is not ErrBotCheck", err)
+	}
+	if errors.Is(err, ErrRateLimited) {
+		t.Error("bot check is classified as rate limiting")
+	}
+	if Retryable(err) {
+		t.Error("Retryable() = true for a bot check")
+	}
+}
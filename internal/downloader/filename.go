@@ -0,0 +1,108 @@
+package downloader
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// Leaves room under the usual 255 byte limit for the extension and the
+	// suffixes added when a file is re-encoded or split.
+	maxStoredNameBytes  = 150
+	maxDisplayNameBytes = 200
+	fallbackFilename    = "download"
+)
+
+// Windows refuses these names regardless of extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// isJoiner reports whether r is a zero width (non-)joiner, which Persian text
+// needs and which must survive the removal of other format characters.
+func isJoiner(r rune) bool {
+	return r == '\u200c' || r == '\u200d'
+}
+
+// cleanName replaces separators, control characters and directional
+// overrides, collapses whitespace and trims the result to maxBytes without
+// splitting a character. reserved lists further characters to replace.
+func cleanName(name string, reserved string, maxBytes int) string {
+	var sb strings.Builder
+	lastSpace := true
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError:
+			continue
+		case r == '/' || r == '\\' || strings.ContainsRune(reserved, r):
+			r = '_'
+		case unicode.IsSpace(r):
+			if lastSpace {
+				continue
+			}
+			r = ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r) && !isJoiner(r):
+			continue
+		}
+		lastSpace = r == ' '
+		sb.WriteRune(r)
+	}
+
+	cleaned := strings.Trim(sb.String(), " .")
+	if len(cleaned) > maxBytes {
+		cut := maxBytes
+		for cut > 0 && !utf8.RuneStart(cleaned[cut]) {
+			cut--
+		}
+		cleaned = strings.TrimRight(cleaned[:cut], " .")
+	}
+	return cleaned
+}
+
+// SanitizeFilename turns an arbitrary title into a name that is safe to store
+// on any common filesystem. Letters of every script are kept, so Persian and
+// Arabic titles stay readable; the result never contains a path separator,
+// never starts with a dot and is at most maxBytes long.
+func SanitizeFilename(name string, maxBytes int) string {
+	cleaned := cleanName(name, `<>:"|?*%`, maxBytes)
+	if cleaned == "" {
+		return fallbackFilename
+	}
+	if reservedNames[strings.ToUpper(strings.SplitN(cleaned, ".", 2)[0])] {
+		cleaned = "_" + cleaned
+	}
+	return cleaned
+}
+
+func trackBaseName(info *TrackInfo) string {
+	switch {
+	case info.Artist != "" && info.Title != "":
+		return info.Artist + " - " + info.Title
+	case info.Title != "":
+		return info.Title
+	}
+	return info.Artist
+}
+
+// storedFilename is the name a download is saved under, without extension.
+func storedFilename(info *TrackInfo) string {
+	return SanitizeFilename(trackBaseName(info), maxStoredNameBytes)
+}
+
+// DisplayFilename is the name shown to the user for a file with the given
+// extension. It keeps punctuation the stored name drops and only removes what
+// Telegram clients would show as a path or garbage.
+func DisplayFilename(info *TrackInfo, ext string) string {
+	base := cleanName(trackBaseName(info), "", maxDisplayNameBytes)
+	if base == "" {
+		base = fallbackFilename
+	}
+	ext = strings.TrimPrefix(ext, ".")
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "Artist - Title", "Artist - Title"},
+		{"parent directory", "../../etc/passwd", "_.._etc_passwd"},
+		{"only dots", "..", fallbackFilename},
+		{"slashes", "AC/DC \\ Live", "AC_DC _ Live"},
+		{"absolute path", "/tmp/x", "_tmp_x"},
+		{"NUL", "a\x00b", "ab"},
+		{"control characters", "a\x07b\x1bc\x7fd", "abcd"},
+		{"newlines and tabs", "a\n\tb\r\nc", "a b c"},
+		{"reserved punctuation", `a<b>c:d"e|f?g*h%i`, "a_b_c_d_e_f_g_h_i"},
+		{"windows device", "CON", "_CON"},
+		{"windows device with extension", "nul.txt", "_nul.txt"},
+		{"windows device lowercase", "com1", "_com1"},
+		{"not a device", "CONSOLE", "CONSOLE"},
+		{"leading dot", ".hidden", "hidden"},
+		{"trailing dots and spaces", "name. . ", "name"},
+		{"collapsed spaces", "a   b", "a b"},
+		{"empty", "", fallbackFilename},
+		{"only spaces", "   ", fallbackFilename},
+		{"persian", "شادمهر عقیلی - دلتنگ", "شادمهر عقیلی - دلتنگ"},
+		{"persian with zero width non-joiner", "می\u200cخواهم", "می\u200cخواهم"},
+		{"arabic", "أم كلثوم - إنت عمري", "أم كلثوم - إنت عمري"},
+		{"right to left override", "invoice\u202egpj.exe", "invoicegpj.exe"},
+		{"bidi isolates and marks", "\u2066a\u2069\u200fb\u202bc\u202c", "abc"},
+		{"invalid utf-8", "a\xffb", "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeFilename(tt.in, maxStoredNameBytes); got != tt.want {
+				t.Errorf("SanitizeFilename(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilenameTruncation(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		maxBytes int
+		want     string
+	}{
+		{"ascii", strings.Repeat("a", 200), 150, strings.Repeat("a", 150)},
+		// Each of these letters is two bytes, so 151 bytes end mid-rune.
+		{"persian", strings.Repeat("س", 100), 151, strings.Repeat("س", 75)},
+		// Three byte runes.
+		{"cjk", strings.Repeat("日", 10), 10, strings.Repeat("日", 3)},
+		// Four byte runes.
+		{"emoji", strings.Repeat("🎵", 10), 9, strings.Repeat("🎵", 2)},
+		{"trailing space after cut", "abcd efgh", 5, "abcd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SanitizeFilename(tt.in, tt.maxBytes)
+			if got != tt.want {
+				t.Errorf("SanitizeFilename(%q, %d) = %q, want %q", tt.in, tt.maxBytes, got, tt.want)
+			}
+			if len(got) > tt.maxBytes || !utf8.ValidString(got) {
+				t.Errorf("SanitizeFilename(%q, %d) = %q: %d bytes, valid UTF-8 %t", tt.in, tt.maxBytes, got, len(got), utf8.ValidString(got))
+			}
+		})
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		reserved string
+		maxBytes int
+		want     string
+	}{
+		{"keeps punctuation without reserved", `What? "Live" <2024>`, "", 100, `What? "Live" <2024>`},
+		{"replaces reserved", `What? "Live"`, `?"`, 100, "What_ _Live_"},
+		{"separators are always replaced", "a/b\\c", "", 100, "a_b_c"},
+		{"drops format characters", "a\u202eb\u200bc\ufeffd", "", 100, "abcd"},
+		{"keeps joiners", "a\u200cb\u200dc", "", 100, "a\u200cb\u200dc"},
+		{"does not split runes", "ab" + strings.Repeat("ع", 5), "", 5, "abع"},
+		{"zero length", "abc", "", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanName(tt.in, tt.reserved, tt.maxBytes); got != tt.want {
+				t.Errorf("cleanName(%q, %q, %d) = %q, want %q", tt.in, tt.reserved, tt.maxBytes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		info TrackInfo
+		ext  string
+		want string
+	}{
+		{"artist and title", TrackInfo{Artist: "Artist", Title: "Title"}, "mp3", "Artist - Title.mp3"},
+		{"extension with dot", TrackInfo{Title: "Title"}, ".m4a", "Title.m4a"},
+		{"no extension", TrackInfo{Title: "Title"}, "", "Title"},
+		{"only artist", TrackInfo{Artist: "Artist"}, "mp3", "Artist.mp3"},
+		{"nothing", TrackInfo{}, "mp4", fallbackFilename + ".mp4"},
+		{"keeps punctuation", TrackInfo{Artist: "A", Title: `Why? "Live" *`}, "mp3", `A - Why? "Live" *.mp3`},
+		{"path traversal", TrackInfo{Title: "../../secret"}, "mp3", "_.._secret.mp3"},
+		{"control characters", TrackInfo{Title: "a\x00b\nc"}, "mp3", "ab c.mp3"},
+		{"persian", TrackInfo{Artist: "همایون شجریان", Title: "سرو چمان"}, "mp3", "همایون شجریان - سرو چمان.mp3"},
+		{"right to left override", TrackInfo{Title: "song\u202e3pm.exe"}, "mp3", "song3pm.exe.mp3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DisplayFilename(&tt.info, tt.ext); got != tt.want {
+				t.Errorf("DisplayFilename(%+v, %q) = %q, want %q", tt.info, tt.ext, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayFilenameLength(t *testing.T) {
+	info := &TrackInfo{Title: strings.Repeat("ش", 300)}
+	got := DisplayFilename(info, "mp3")
+	base := strings.TrimSuffix(got, ".mp3")
+	if len(base) > maxDisplayNameBytes || !utf8.ValidString(got) {
+		t.Errorf("DisplayFilename gave a %d byte base name, valid UTF-8 %t", len(base), utf8.ValidString(got))
+	}
+}
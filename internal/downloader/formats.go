@@ -0,0 +1,203 @@
+package downloader
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Format struct {
+	ID             string
+	Ext            string
+	Width          int
+	Height         int
+	FPS            float64
+	VideoCodec     string
+	AudioCodec     string
+	Filesize       int64
+	FilesizeApprox bool
+	Bitrate        float64
+}
+
+// Resolution is one entry of the video quality picker. Size is an estimate
+// for the merged video and audio streams and is zero when unknown.
+type Resolution struct {
+	Height   int
+	FPS      float64
+	FormatID string
+	HasAudio bool
+	Size     int64
+}
+
+type ytdlpFormat struct {
+	FormatID       string  `json:"format_id"`
+	Ext            string  `json:"ext"`
+	Width          float64 `json:"width"`
+	Height         float64 `json:"height"`
+	FPS            float64 `json:"fps"`
+	Vcodec         string  `json:"vcodec"`
+	Acodec         string  `json:"acodec"`
+	Filesize       float64 `json:"filesize"`
+	FilesizeApprox float64 `json:"filesize_approx"`
+	TBR            float64 `json:"tbr"`
+}
+
+func parseFormats(raw []ytdlpFormat) []Format {
+	formats := make([]Format, 0, len(raw))
+	for _, f := range raw {
+		format := Format{
+			ID:         f.FormatID,
+			Ext:        f.Ext,
+			Width:      int(f.Width),
+			Height:     int(f.Height),
+			FPS:        f.FPS,
+			VideoCodec: f.Vcodec,
+			AudioCodec: f.Acodec,
+			Filesize:   int64(f.Filesize),
+			Bitrate:    f.TBR,
+		}
+		if format.Filesize == 0 && f.FilesizeApprox > 0 {
+			format.Filesize = int64(f.FilesizeApprox)
+			format.FilesizeApprox = true
+		}
+		formats = append(formats, format)
+	}
+	return formats
+}
+
+func (f Format) HasVideo() bool {
+	return f.VideoCodec != "" && f.VideoCodec != "none" && f.Height > 0
+}
+
+func (f Format) HasAudio() bool {
+	return f.AudioCodec != "" && f.AudioCodec != "none"
+}
+
+// EstimatedSize falls back to bitrate times duration when yt-dlp does not
+// report a file size.
+func (f Format) EstimatedSize(duration float64) int64 {
+	if f.Filesize > 0 {
+		return f.Filesize
+	}
+	if f.Bitrate > 0 && duration > 0 {
+		return int64(f.Bitrate * 1000 / 8 * duration)
+	}
+	return 0
+}
+
+func betterFormat(candidate, current Format, duration float64) bool {
+	if (candidate.Ext == "mp4") != (current.Ext == "mp4") {
+		return candidate.Ext == "mp4"
+	}
+	if candidate.FPS != current.FPS {
+		return candidate.FPS > current.FPS
+	}
+	return candidate.EstimatedSize(duration) > current.EstimatedSize(duration)
+}
+
+// betterAudioFormat prefers m4a, then the higher bitrate, then the larger
+// file and finally the lower format ID, so the pick does not depend on the
+// order yt-dlp lists the formats in.
+func betterAudioFormat(candidate, current Format, duration float64) bool {
+	if (candidate.Ext == "m4a") != (current.Ext == "m4a") {
+		return candidate.Ext == "m4a"
+	}
+	if candidate.Bitrate != current.Bitrate {
+		return candidate.Bitrate > current.Bitrate
+	}
+	if size, currentSize := candidate.EstimatedSize(duration), current.EstimatedSize(duration); size != currentSize {
+		return size > currentSize
+	}
+	return candidate.ID < current.ID
+}
+
+func (t *TrackInfo) bestAudioFormat() (Format, bool) {
+	var best Format
+	found := false
+	for _, f := range t.Formats {
+		if f.HasVideo() || !f.HasAudio() {
+			continue
+		}
+		if !found || betterAudioFormat(f, best, t.Duration) {
+			best = f
+			found = true
+		}
+	}
+	return best, found
+}
+
+// Resolutions lists the distinct video heights on offer, lowest first.
+func (t *TrackInfo) Resolutions() []Resolution {
+	bestByHeight := make(map[int]Format)
+	for _, f := range t.Formats {
+		if !f.HasVideo() {
+			continue
+		}
+		if current, ok := bestByHeight[f.Height]; !ok || betterFormat(f, current, t.Duration) {
+			bestByHeight[f.Height] = f
+		}
+	}
+	audio, hasAudio := t.bestAudioFormat()
+
+	resolutions := make([]Resolution, 0, len(bestByHeight))
+	for height, f := range bestByHeight {
+		res := Resolution{
+			Height:   height,
+			FPS:      f.FPS,
+			FormatID: f.ID,
+			HasAudio: f.HasAudio(),
+			Size:     f.EstimatedSize(t.Duration),
+		}
+		if !res.HasAudio && hasAudio && res.Size > 0 {
+			res.Size += audio.EstimatedSize(t.Duration)
+		}
+		resolutions = append(resolutions, res)
+	}
+	sort.Slice(resolutions, func(i, j int) bool {
+		return resolutions[i].Height < resolutions[j].Height
+	})
+	return resolutions
+}
+
+// FormatSelector picks the exact format behind the resolution and falls back
+// to the best format of at most that height.
+func (r Resolution) FormatSelector() string {
+	fallback := videoFormatSelector(r.Height, false)
+	if r.FormatID == "" {
+		return fallback
+	}
+	if r.HasAudio {
+		return fmt.Sprintf("%s/%s", r.FormatID, fallback)
+	}
+	return fmt.Sprintf("%s+bestaudio[ext=m4a]/%s+bestaudio/%s", r.FormatID, r.FormatID, fallback)
+}
+
+// EstimateSize guesses the size of the file the spec will produce from the
+// format metadata. It returns zero when there is nothing to go on.
+func (t *TrackInfo) EstimateSize(spec MediaSpec) int64 {
+	switch spec.Type {
+	case VideoBest:
+		var chosen *Resolution
+		for _, res := range t.Resolutions() {
+			if spec.MaxHeight > 0 && res.Height > spec.MaxHeight {
+				break
+			}
+			chosen = &res
+		}
+		if chosen != nil {
+			return chosen.Size
+		}
+	case AudioOnly:
+		if spec.AudioFormat == AudioFormatOriginal {
+			if audio, ok := t.bestAudioFormat(); ok {
+				return audio.EstimatedSize(t.Duration)
+			}
+			return 0
+		}
+		if kbps, err := strconv.Atoi(strings.TrimSuffix(spec.AudioQuality, "K")); err == nil && strings.HasSuffix(spec.AudioQuality, "K") && t.Duration > 0 {
+			return int64(float64(kbps) * 1000 / 8 * t.Duration)
+		}
+	}
+	return 0
+}
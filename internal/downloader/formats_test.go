@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"reflect"
+	"testing"
+)
+
+// permutations lists every order of formats.
+func permutations(formats []Format) [][]Format {
+	if len(formats) <= 1 {
+		return [][]Format{formats}
+	}
+	var all [][]Format
+	for i := range formats {
+		rest := append(append([]Format(nil), formats[:i]...), formats[i+1:]...)
+		for _, p := range permutations(rest) {
+			all = append(all, append([]Format{formats[i]}, p...))
+		}
+	}
+	return all
+}
+
+func TestBestAudioFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		formats []Format
+		want    string
+	}{
+		{
+			name: "m4a before a higher bitrate",
+			formats: []Format{
+				{ID: "251", Ext: "webm", AudioCodec: "opus", Bitrate: 160},
+				{ID: "140", Ext: "m4a", AudioCodec: "mp4a.40.2", Bitrate: 129},
+			},
+			want: "140",
+		},
+		{
+			name: "higher bitrate",
+			formats: []Format{
+				{ID: "139", Ext: "m4a", AudioCodec: "mp4a.40.5", Bitrate: 48, Filesize: 9_000_000},
+				{ID: "140", Ext: "m4a", AudioCodec: "mp4a.40.2", Bitrate: 129, Filesize: 3_000_000},
+			},
+			want: "140",
+		},
+		{
+			name: "same bitrate, larger file",
+			formats: []Format{
+				{ID: "a", Ext: "webm", AudioCodec: "opus", Bitrate: 128, Filesize: 3_000_000},
+				{ID: "b", Ext: "webm", AudioCodec: "opus", Bitrate: 128, Filesize: 3_500_000},
+			},
+			want: "b",
+		},
+		{
+			name: "full tie",
+			formats: []Format{
+				{ID: "y", Ext: "mp3", AudioCodec: "mp3", Bitrate: 128},
+				{ID: "x", Ext: "mp3", AudioCodec: "mp3", Bitrate: 128},
+			},
+			want: "x",
+		},
+		{
+			name: "video formats are skipped",
+			formats: []Format{
+				{ID: "18", Ext: "mp4", VideoCodec: "avc1", AudioCodec: "mp4a.40.2", Height: 360, Bitrate: 500},
+				{ID: "137", Ext: "mp4", VideoCodec: "avc1", AudioCodec: "none", Height: 1080, Bitrate: 4000},
+				{ID: "251", Ext: "webm", AudioCodec: "opus", Bitrate: 160},
+			},
+			want: "251",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, formats := range permutations(tt.formats) {
+				info := &TrackInfo{Duration: 200, Formats: formats}
+				best, ok := info.bestAudioFormat()
+				if !ok || best.ID != tt.want {
+					t.Errorf("picked %q (found %t) from %+v, want %q", best.ID, ok, formats, tt.want)
+				}
+			}
+		})
+	}
+
+	info := &TrackInfo{Formats: []Format{{ID: "137", Ext: "mp4", VideoCodec: "avc1", AudioCodec: "none", Height: 1080}}}
+	if best, ok := info.bestAudioFormat(); ok {
+		t.Errorf("picked %q from formats without audio", best.ID)
+	}
+}
+
+// sampleInfo has a muxed 360p format, video-only 720p formats in two
+// containers and two audio formats. The duration is 100 seconds.
+func sampleInfo() *TrackInfo {
+	return &TrackInfo{
+		Duration: 100,
+		Formats: []Format{
+			{ID: "247", Ext: "webm", VideoCodec: "vp9", AudioCodec: "none", Height: 720, FPS: 30, Filesize: 9_000_000},
+			{ID: "18", Ext: "mp4", VideoCodec: "avc1", AudioCodec: "mp4a.40.2", Height: 360, FPS: 30, Filesize: 4_000_000},
+			{ID: "136", Ext: "mp4", VideoCodec: "avc1", AudioCodec: "none", Height: 720, FPS: 30, Bitrate: 800},
+			{ID: "251", Ext: "webm", AudioCodec: "opus", Bitrate: 160, Filesize: 2_000_000},
+			{ID: "140", Ext: "m4a", AudioCodec: "mp4a.40.2", Bitrate: 128},
+		},
+	}
+}
+
+func TestResolutions(t *testing.T) {
+	got := sampleInfo().Resolutions()
+	want := []Resolution{
+		{Height: 360, FPS: 30, FormatID: "18", HasAudio: true, Size: 4_000_000},
+		// mp4 wins over the larger webm. Its size comes from the bitrate,
+		// plus the m4a audio it is merged with.
+		{Height: 720, FPS: 30, FormatID: "136", Size: 10_000_000 + 1_600_000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolutions() = %+v, want %+v", got, want)
+	}
+
+	if got := (&TrackInfo{Formats: []Format{{ID: "140", Ext: "m4a", AudioCodec: "mp4a.40.2"}}}).Resolutions(); len(got) != 0 {
+		t.Errorf("Resolutions() of an audio-only track = %+v, want none", got)
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	tests := []struct {
+		name string
+		info *TrackInfo
+		spec MediaSpec
+		want int64
+	}{
+		{"best video", sampleInfo(), MediaSpec{Type: VideoBest}, 11_600_000},
+		{"video up to 480p", sampleInfo(), MediaSpec{Type: VideoBest, MaxHeight: 480}, 4_000_000},
+		{"video below every height", sampleInfo(), MediaSpec{Type: VideoBest, MaxHeight: 240}, 0},
+		{"original audio", sampleInfo(), MediaSpec{Type: AudioOnly, AudioFormat: AudioFormatOriginal}, 1_600_000},
+		{"converted audio", sampleInfo(), MediaSpec{Type: AudioOnly, AudioFormat: "mp3", AudioQuality: "192K"}, 2_400_000},
+		{"converted audio by quality level", sampleInfo(), MediaSpec{Type: AudioOnly, AudioFormat: "mp3", AudioQuality: "0"}, 0},
+		{"converted audio without duration", &TrackInfo{}, MediaSpec{Type: AudioOnly, AudioFormat: "mp3", AudioQuality: "192K"}, 0},
+		{"original audio without formats", &TrackInfo{Duration: 100}, MediaSpec{Type: AudioOnly, AudioFormat: AudioFormatOriginal}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.EstimateSize(tt.spec); got != tt.want {
+				t.Errorf("EstimateSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
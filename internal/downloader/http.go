@@ -0,0 +1,426 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/urlguard"
+)
+
+const (
+	httpExtractor = "HTTP"
+	// sniffLength is how much of the body http.DetectContentType looks at.
+	sniffLength = 512
+)
+
+type mediaKind int
+
+const (
+	kindNone mediaKind = iota
+	kindAudio
+	kindVideo
+	kindImage
+)
+
+// directMediaKinds maps the extensions of files the HTTP backend serves
+// without any processing.
+var directMediaKinds = map[string]mediaKind{
+	"mp3": kindAudio, "m4a": kindAudio, "aac": kindAudio, "ogg": kindAudio, "opus": kindAudio, "flac": kindAudio, "wav": kindAudio,
+	"mp4": kindVideo, "webm": kindVideo, "mkv": kindVideo, "mov": kindVideo,
+	"jpg": kindImage, "jpeg": kindImage, "png": kindImage, "webp": kindImage, "gif": kindImage,
+}
+
+var (
+	errTooManyRedirects = errors.New("too many redirects")
+	errNotMedia         = errors.New("server did not return a media file")
+)
+
+type HTTPOptions struct {
+	InfoTimeout     time.Duration
+	DownloadTimeout time.Duration
+	// MaxFileSize caps the size of a single file. Zero means no limit.
+	MaxFileSize  int64
+	MaxRedirects int
+	// ResumeAttempts is the total number of requests made for one file,
+	// including the ones resuming an interrupted transfer.
+	ResumeAttempts int
+	// Guard, when set, checks every redirect and every address connected to.
+	Guard *urlguard.Guard
+}
+
+// HTTP is the backend for direct links to media files, such as plain .mp3 or
+// .mp4 URLs and the image URLs of Instagram posts. It saves the file as is,
+// so anything that needs converting is left to yt-dlp.
+type HTTP struct {
+	client *http.Client
+	opts   HTTPOptions
+}
+
+func NewHTTP(opts HTTPOptions) *HTTP {
+	if opts.ResumeAttempts < 1 {
+		opts.ResumeAttempts = 1
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > opts.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects: %w", opts.MaxRedirects, errTooManyRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			if opts.Guard != nil {
+				if err := opts.Guard.CheckRedirect(req.URL); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	if opts.Guard != nil {
+		client.Transport = opts.Guard.Transport()
+	}
+	return &HTTP{client: client, opts: opts}
+}
+
+func (h *HTTP) Name() string {
+	return "http"
+}
+
+// directMedia returns the parsed URL and the extension of a direct media link.
+func directMedia(urlStr string) (*url.URL, string, mediaKind) {
+	u, err := url.Parse(urlStr)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", kindNone
+	}
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), "."))
+	return u, ext, directMediaKinds[ext]
+}
+
+func (h *HTTP) Handles(urlStr string) bool {
+	_, _, kind := directMedia(urlStr)
+	return kind != kindNone
+}
+
+// contentKind maps a MIME type to a media kind. known is false for types
+// such as application/octet-stream that say nothing about the content.
+func contentKind(contentType string) (kind mediaKind, known bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return kindNone, false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "audio/"), mediaType == "application/ogg":
+		return kindAudio, true
+	case strings.HasPrefix(mediaType, "video/"):
+		return kindVideo, true
+	case strings.HasPrefix(mediaType, "image/"):
+		return kindImage, true
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/json", mediaType == "application/xml", mediaType == "application/xhtml+xml":
+		return kindNone, true
+	}
+	return kindNone, false
+}
+
+// matchesKind reports whether content of the given MIME type can be the
+// expected kind. Audio and video share containers such as mp4 and webm, so
+// they are not told apart.
+func matchesKind(contentType string, expected mediaKind) bool {
+	kind, known := contentKind(contentType)
+	if !known {
+		return true
+	}
+	return kind != kindNone && (kind == kindImage) == (expected == kindImage)
+}
+
+func (h *HTTP) newRequest(ctx context.Context, method, urlStr string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Compressed transfers would break Range offsets and checksums.
+	req.Header.Set("Accept-Encoding", "identity")
+	return req, nil
+}
+
+func (h *HTTP) Probe(ctx context.Context, urlStr string, username string) (*LinkInfo, error) {
+	u, ext, kind := directMedia(urlStr)
+	if kind == kindNone {
+		return nil, ErrNotSupported
+	}
+
+	ctx, cancel := withTimeout(ctx, h.opts.InfoTimeout)
+	defer cancel()
+	req, err := h.newRequest(ctx, http.MethodHead, urlStr)
+	if err != nil {
+		return nil, &Error{Backend: h.Name(), Op: "info", URL: urlStr, Kind: ErrUnsupportedURL, Err: err}
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, h.requestError(ctx, "info", urlStr, err)
+	}
+	resp.Body.Close()
+
+	name, _ := url.PathUnescape(path.Base(u.Path))
+	var size int64
+	// Some servers refuse HEAD but serve the file anyway, so only a missing
+	// file is final here.
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, statusError(h.Name(), "info", urlStr, resp.StatusCode)
+	case resp.StatusCode == http.StatusOK:
+		if !matchesKind(resp.Header.Get("Content-Type"), kind) {
+			log.Printf("[%s] %s looks like a media link but is served as %s. Leaving it to the next backend.\n", username, urlStr, resp.Header.Get("Content-Type"))
+			return nil, ErrNotSupported
+		}
+		size = resp.ContentLength
+		if h.opts.MaxFileSize > 0 && size > h.opts.MaxFileSize {
+			return nil, &Error{Backend: h.Name(), Op: "info", URL: urlStr, Kind: ErrTooLarge, Err: fmt.Errorf("file has %d bytes", size)}
+		}
+		if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			name = path.Base(params["filename"])
+		}
+	}
+
+	track := &TrackInfo{
+		ID:          name,
+		Extractor:   httpExtractor,
+		Title:       strings.TrimSuffix(name, path.Ext(name)),
+		Artist:      "Unknown Artist",
+		Extension:   ext,
+		Filename:    name,
+		OriginalURL: urlStr,
+		URL:         urlStr,
+		HasVideo:    kind == kindVideo,
+		HasImage:    kind == kindImage,
+		IsAudioOnly: kind == kindAudio,
+	}
+	if track.Title == "" {
+		track.Title = "Unknown Title"
+	}
+	switch kind {
+	case kindImage:
+		track.DirectImageURL = urlStr
+	case kindAudio:
+		// Lets the bot check the size before downloading.
+		if size > 0 {
+			track.Formats = []Format{{ID: "direct", Ext: ext, AudioCodec: ext, Filesize: size}}
+		}
+	}
+	log.Printf("[%s] Direct %s link detected: %s (%d bytes)\n", username, ext, urlStr, size)
+	return &LinkInfo{
+		Type:        "track",
+		Title:       track.Title,
+		Uploader:    track.Artist,
+		OriginalURL: urlStr,
+		Tracks:      []*TrackInfo{track},
+	}, nil
+}
+
+func (h *HTTP) Search(ctx context.Context, site SearchSite, query string, limit int, username string) ([]SearchResult, error) {
+	return nil, ErrNotSupported
+}
+
+// serves reports whether the file can be sent without converting it. Tracks
+// with a choice of formats are left to yt-dlp, which picks the best one.
+func (h *HTTP) serves(spec MediaSpec, info *TrackInfo, ext string, kind mediaKind) bool {
+	switch spec.Type {
+	case AudioOnly:
+		return kind == kindAudio && len(info.Formats) <= 1 && (spec.AudioFormat == AudioFormatOriginal || spec.AudioFormat == ext)
+	case VideoBest:
+		return kind == kindVideo && len(info.Formats) <= 1
+	case ImageBest:
+		return kind == kindImage
+	}
+	return false
+}
+
+func (h *HTTP) Download(ctx context.Context, req DownloadRequest) (string, error) {
+	mediaURL := req.MediaURL()
+	_, ext, kind := directMedia(mediaURL)
+	if kind == kindNone || !h.serves(req.Spec, req.Info, ext, kind) {
+		return "", ErrNotSupported
+	}
+
+	ctx, cancel := withTimeout(ctx, h.opts.DownloadTimeout)
+	defer cancel()
+
+	filePath := filepath.Join(req.Dir, req.Name+"."+ext)
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", fmt.Errorf("[%s] failed to create %s: %w", req.Username, filePath, err)
+	}
+	log.Printf("[%s] Downloading %s directly to %s\n", req.Username, mediaURL, filePath)
+
+	t := &transfer{file: file, kind: kind, start: time.Now(), onProgress: req.OnProgress}
+	for attempt := 1; ; attempt++ {
+		err = h.fetch(ctx, mediaURL, t)
+		if err == nil || ctx.Err() != nil || !Retryable(err) || attempt >= h.opts.ResumeAttempts {
+			break
+		}
+		if t.written > 0 && t.validator != "" {
+			log.Printf("[%s] Direct download of %s stopped at %d bytes: %v. Resuming (attempt %d of %d).\n", req.Username, mediaURL, t.written, err, attempt+1, h.opts.ResumeAttempts)
+		} else {
+			log.Printf("[%s] Direct download of %s failed: %v. Starting over (attempt %d of %d).\n", req.Username, mediaURL, err, attempt+1, h.opts.ResumeAttempts)
+		}
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("[%s] failed to write %s: %w", req.Username, filePath, closeErr)
+	}
+	if errors.Is(err, errNotMedia) {
+		// An HTML page behind a media-looking URL may still be something
+		// yt-dlp can extract from.
+		os.Remove(filePath)
+		log.Printf("[%s] %s\n", req.Username, err)
+		return "", ErrNotSupported
+	}
+	if err != nil {
+		return "", err
+	}
+	if t.digest != nil {
+		log.Printf("[%s] Verified %s checksum of %s.\n", req.Username, t.digest.algorithm, filePath)
+	}
+	return filePath, nil
+}
+
+// fetch requests the part of the file that is still missing and appends it.
+func (h *HTTP) fetch(ctx context.Context, mediaURL string, t *transfer) error {
+	httpReq, err := h.newRequest(ctx, http.MethodGet, mediaURL)
+	if err != nil {
+		return &Error{Backend: h.Name(), Op: "download", URL: mediaURL, Kind: ErrUnsupportedURL, Err: err}
+	}
+	resuming := t.written > 0 && t.validator != ""
+	if resuming {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", t.written))
+		// The server sends the whole file instead if it changed meanwhile.
+		httpReq.Header.Set("If-Range", t.validator)
+	}
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return h.requestError(ctx, "download", mediaURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && resuming:
+		start, _, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != t.written {
+			if err := t.reset(); err != nil {
+				return err
+			}
+			return &Error{Backend: h.Name(), Op: "download", URL: mediaURL, Kind: ErrNetwork, Err: fmt.Errorf("server resumed at an unexpected offset: %q", resp.Header.Get("Content-Range"))}
+		}
+	case resp.StatusCode == http.StatusOK:
+		if err := t.reset(); err != nil {
+			return err
+		}
+		t.total = resp.ContentLength
+		t.validator = rangeValidator(resp.Header)
+		t.digest = expectedDigest(resp.Header)
+		if t.digest != nil {
+			t.hash = t.digest.newHash()
+		}
+	default:
+		return statusError(h.Name(), "download", mediaURL, resp.StatusCode)
+	}
+
+	if h.opts.MaxFileSize > 0 && t.total > h.opts.MaxFileSize {
+		return &Error{Backend: h.Name(), Op: "download", URL: mediaURL, Kind: ErrTooLarge, Err: fmt.Errorf("file has %d bytes", t.total)}
+	}
+
+	body := bufio.NewReaderSize(resp.Body, sniffLength)
+	if t.written == 0 {
+		head, _ := body.Peek(sniffLength)
+		if sniffed := http.DetectContentType(head); !matchesKind(sniffed, t.kind) {
+			return fmt.Errorf("%s is served as %s: %w", mediaURL, sniffed, errNotMedia)
+		}
+	}
+
+	var reader io.Reader = body
+	if h.opts.MaxFileSize > 0 {
+		reader = io.LimitReader(body, h.opts.MaxFileSize-t.written+1)
+	}
+	_, err = io.Copy(t, reader)
+	if h.opts.MaxFileSize > 0 && t.written > h.opts.MaxFileSize {
+		return &Error{Backend: h.Name(), Op: "download", URL: mediaURL, Kind: ErrTooLarge, Err: fmt.Errorf("file exceeds %d bytes", h.opts.MaxFileSize)}
+	}
+	if err != nil {
+		var writeErr *writeError
+		if errors.As(err, &writeErr) {
+			return writeErr.err
+		}
+		return h.requestError(ctx, "download", mediaURL, err)
+	}
+	if t.total > 0 && t.written != t.total {
+		return &Error{Backend: h.Name(), Op: "download", URL: mediaURL, Kind: ErrNetwork, Err: fmt.Errorf("transfer ended after %d of %d bytes", t.written, t.total)}
+	}
+	if err := t.verify(); err != nil {
+		// Start from scratch on the next attempt rather than keep bad data.
+		if resetErr := t.reset(); resetErr != nil {
+			return resetErr
+		}
+		t.validator = ""
+		return &Error{Backend: h.Name(), Op: "download", URL: mediaURL, Kind: ErrNetwork, Err: err}
+	}
+	return nil
+}
+
+func (h *HTTP) requestError(ctx context.Context, op, urlStr string, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return &Error{Backend: h.Name(), Op: op, URL: urlStr, Kind: ErrTimeout, Err: err}
+	case ctx.Err() != nil:
+		return fmt.Errorf("http %s cancelled for %s: %w", op, urlStr, context.Canceled)
+	case errors.Is(err, errTooManyRedirects), errors.Is(err, urlguard.ErrBlockedAddress), errors.Is(err, urlguard.ErrDomainDenied), errors.Is(err, urlguard.ErrScheme):
+		return &Error{Backend: h.Name(), Op: op, URL: urlStr, Err: err}
+	}
+	return &Error{Backend: h.Name(), Op: op, URL: urlStr, Kind: ErrNetwork, Err: err}
+}
+
+func statusError(backend, op, urlStr string, status int) error {
+	var kind error
+	switch {
+	case status == http.StatusNotFound || status == http.StatusGone:
+		kind = ErrUnavailable
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		kind = ErrLoginRequired
+	case status == http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case status >= 500:
+		kind = ErrNetwork
+	}
+	return &Error{Backend: backend, Op: op, URL: urlStr, Kind: kind, Err: fmt.Errorf("unexpected status %d %s", status, http.StatusText(status))}
+}
+
+// rangeValidator returns the header value that makes a Range request safe to
+// resume with, or "" if the server gave none. Weak ETags do not qualify.
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// parseContentRange parses a "bytes start-end/total" header. total is -1
+// when the server does not know it.
+func parseContentRange(value string) (start, total int64, ok bool) {
+	var end int64
+	if _, err := fmt.Sscanf(value, "bytes %d-%d/%d", &start, &end, &total); err == nil {
+		return start, total, true
+	}
+	if _, err := fmt.Sscanf(value, "bytes %d-%d/*", &start, &end); err == nil {
+		return start, -1, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,306 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// testAudio sniffs as audio/mpeg.
+var testAudio = append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), bytes.Repeat([]byte("zebio audio "), 200)...)
+
+// recordedRequest keeps the headers of a request the test server answered.
+type recordedRequest struct {
+	rangeHeader string
+	ifRange     string
+}
+
+type testServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []recordedRequest
+}
+
+// newTestServer serves handle and records every request. handle gets the
+// number of the request, starting at 1.
+func newTestServer(t *testing.T, handle func(n int, w http.ResponseWriter, r *http.Request)) *testServer {
+	t.Helper()
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, recordedRequest{rangeHeader: r.Header.Get("Range"), ifRange: r.Header.Get("If-Range")})
+		n := len(s.requests)
+		s.mu.Unlock()
+		handle(n, w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) recorded() []recordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]recordedRequest(nil), s.requests...)
+}
+
+// serveFull sends the whole body with an ETag.
+func serveFull(w http.ResponseWriter, body []byte, etag string) {
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
+
+// serveDropped sends the headers for the whole body, then only half of it
+// before dropping the connection.
+func serveDropped(w http.ResponseWriter, body []byte, etag string) {
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body[:len(body)/2])
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+// servePartial answers a Range request starting at start.
+func servePartial(w http.ResponseWriter, body []byte, start int, etag string) {
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(body)-1, len(body)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)-start))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(body[start:])
+}
+
+func downloadDirect(t *testing.T, h *HTTP, url string) (string, error) {
+	t.Helper()
+	return h.Download(context.Background(), DownloadRequest{
+		URL:      url,
+		Username: "test",
+		Spec:     MediaSpec{Type: AudioOnly, AudioFormat: AudioFormatOriginal},
+		Info:     &TrackInfo{URL: url},
+		Dir:      t.TempDir(),
+		Name:     "file",
+	})
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("file has %d bytes, want %d bytes of the expected content", len(got), len(want))
+	}
+}
+
+func TestHTTPResumesDroppedConnection(t *testing.T) {
+	server := newTestServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n == 1 {
+			serveDropped(w, testAudio, `"v1"`)
+			return
+		}
+		servePartial(w, testAudio, len(testAudio)/2, `"v1"`)
+	})
+	h := NewHTTP(HTTPOptions{ResumeAttempts: 3})
+
+	path, err := downloadDirect(t, h, server.URL+"/song.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, path, testAudio)
+	requests := server.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("made %d requests, want 2", len(requests))
+	}
+	if want := fmt.Sprintf("bytes=%d-", len(testAudio)/2); requests[1].rangeHeader != want || requests[1].ifRange != `"v1"` {
+		t.Errorf("resumed with Range %q and If-Range %q, want %q and %q", requests[1].rangeHeader, requests[1].ifRange, want, `"v1"`)
+	}
+}
+
+func TestHTTPRestartsWhenFileChanged(t *testing.T) {
+	changed := append([]byte("ID3\x04\x00"), bytes.Repeat([]byte("new version "), 150)...)
+	server := newTestServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n == 1 {
+			serveDropped(w, testAudio, `"v1"`)
+			return
+		}
+		// If-Range no longer matches, so the server sends the new file.
+		serveFull(w, changed, `"v2"`)
+	})
+	h := NewHTTP(HTTPOptions{ResumeAttempts: 3})
+
+	path, err := downloadDirect(t, h, server.URL+"/song.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, path, changed)
+}
+
+func TestHTTPRestartsAfterUnexpectedOffset(t *testing.T) {
+	server := newTestServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 1:
+			serveDropped(w, testAudio, `"v1"`)
+		case 2:
+			servePartial(w, testAudio, 10, `"v1"`)
+		default:
+			serveFull(w, testAudio, `"v1"`)
+		}
+	})
+	h := NewHTTP(HTTPOptions{ResumeAttempts: 3})
+
+	path, err := downloadDirect(t, h, server.URL+"/song.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, path, testAudio)
+	if requests := server.recorded(); len(requests) != 3 || requests[2].rangeHeader != "" {
+		t.Errorf("got requests %+v, want a third request for the whole file", requests)
+	}
+}
+
+func TestHTTPWithoutValidatorStartsOver(t *testing.T) {
+	server := newTestServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(testAudio)))
+			w.Write(testAudio[:100])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(testAudio)
+	})
+	h := NewHTTP(HTTPOptions{ResumeAttempts: 2})
+
+	path, err := downloadDirect(t, h, server.URL+"/song.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, path, testAudio)
+	if requests := server.recorded(); requests[1].rangeHeader != "" {
+		t.Errorf("resumed with Range %q although the server sent no validator", requests[1].rangeHeader)
+	}
+}
+
+func TestHTTPChecksums(t *testing.T) {
+	sha := sha256.Sum256(testAudio)
+	sum := md5.Sum(testAudio)
+	wrong := sha256.Sum256([]byte("something else"))
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		wantErr bool
+	}{
+		{"repr-digest", "Repr-Digest", "sha-256=:" + base64.StdEncoding.EncodeToString(sha[:]) + ":", false},
+		{"digest", "Digest", "SHA-256=" + base64.StdEncoding.EncodeToString(sha[:]), false},
+		{"content-md5", "Content-MD5", base64.StdEncoding.EncodeToString(sum[:]), false},
+		{"mismatch", "Repr-Digest", "sha-256=:" + base64.StdEncoding.EncodeToString(wrong[:]) + ":", true},
+		{"unknown algorithm", "Repr-Digest", "sha-1=:AAAA:", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(tt.header, tt.value)
+				serveFull(w, testAudio, `"v1"`)
+			})
+			h := NewHTTP(HTTPOptions{ResumeAttempts: 2})
+
+			path, err := downloadDirect(t, h, server.URL+"/song.mp3")
+			if tt.wantErr {
+				if !errors.Is(err, ErrNetwork) {
+					t.Fatalf("got error %v, want %v", err, ErrNetwork)
+				}
+				if requests := server.recorded(); len(requests) != 2 || requests[1].rangeHeader != "" {
+					t.Errorf("got requests %+v, want the file fetched again from the start", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFile(t, path, testAudio)
+		})
+	}
+}
+
+func TestHTTPSizeLimit(t *testing.T) {
+	for _, withLength := range []bool{true, false} {
+		t.Run(fmt.Sprintf("content length %t", withLength), func(t *testing.T) {
+			server := newTestServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+				if withLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(testAudio)))
+				}
+				w.Write(testAudio[:sniffLength])
+				// Flushing early makes the response chunked when no length
+				// was set.
+				w.(http.Flusher).Flush()
+				w.Write(testAudio[sniffLength:])
+			})
+			h := NewHTTP(HTTPOptions{MaxFileSize: int64(len(testAudio) - 1), ResumeAttempts: 3})
+
+			if _, err := downloadDirect(t, h, server.URL+"/song.mp3"); !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("got error %v, want %v", err, ErrTooLarge)
+			}
+			if requests := server.recorded(); len(requests) != 1 {
+				t.Errorf("made %d requests, want no retry for a file that is too large", len(requests))
+			}
+		})
+	}
+}
+
+func TestHTTPTooManyRedirects(t *testing.T) {
+	var server *testServer
+	server = newTestServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, fmt.Sprintf("%s/hop%d.mp3", server.URL, n), http.StatusFound)
+	})
+	h := NewHTTP(HTTPOptions{MaxRedirects: 2, ResumeAttempts: 3})
+
+	_, err := downloadDirect(t, h, server.URL+"/song.mp3")
+	if !errors.Is(err, errTooManyRedirects) {
+		t.Fatalf("got error %v, want %v", err, errTooManyRedirects)
+	}
+	if requests := server.recorded(); len(requests) != 3 {
+		t.Errorf("made %d requests, want 3", len(requests))
+	}
+}
+
+func TestHTTPLeavesHTMLToNextBackend(t *testing.T) {
+	server := newTestServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<!DOCTYPE html><html><head><title>Player</title></head><body>song</body></html>"))
+	})
+	h := NewHTTP(HTTPOptions{ResumeAttempts: 1})
+
+	if _, err := h.Probe(context.Background(), server.URL+"/song.mp3", "test"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Probe: got error %v, want %v", err, ErrNotSupported)
+	}
+
+	dir := t.TempDir()
+	_, err := h.Download(context.Background(), DownloadRequest{
+		URL:      server.URL + "/song.mp3",
+		Username: "test",
+		Spec:     MediaSpec{Type: AudioOnly, AudioFormat: AudioFormatOriginal},
+		Info:     &TrackInfo{URL: server.URL + "/song.mp3"},
+		Dir:      dir,
+		Name:     "file",
+	})
+	if !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("Download: got error %v, want %v", err, ErrNotSupported)
+	}
+	if _, statErr := os.Stat(filepath.Join(dir, "file.mp3")); !os.IsNotExist(statErr) {
+		t.Errorf("the HTML page was left at %s", filepath.Join(dir, "file.mp3"))
+	}
+}
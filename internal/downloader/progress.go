@@ -0,0 +1,133 @@
+package downloader
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ProgressPhase string
+
+const (
+	PhaseDownloading    ProgressPhase = "downloading"
+	PhasePostProcessing ProgressPhase = "postprocessing"
+)
+
+type Progress struct {
+	Phase           ProgressPhase
+	Percent         float64
+	DownloadedBytes int64
+	TotalBytes      int64
+	Speed           float64
+	ETA             time.Duration
+	Postprocessor   string
+}
+
+// ProgressFunc receives progress updates while yt-dlp is running. It may be
+// called from more than one goroutine.
+type ProgressFunc func(Progress)
+
+const progressMarker = "zebio-progress"
+
+func progressArgs() []string {
+	return []string{
+		"--newline",
+		"--progress",
+		"--progress-template", "download:" + progressMarker + " download %(progress.downloaded_bytes)s %(progress.total_bytes)s %(progress.total_bytes_estimate)s %(progress.speed)s %(progress.eta)s",
+		"--progress-template", "postprocess:" + progressMarker + " postprocess %(progress.postprocessor)s %(progress.status)s",
+	}
+}
+
+func parseProgressLine(line string) (Progress, bool) {
+	idx := strings.Index(line, progressMarker+" ")
+	if idx < 0 {
+		return Progress{}, false
+	}
+	fields := strings.Fields(line[idx+len(progressMarker):])
+	if len(fields) == 0 {
+		return Progress{}, false
+	}
+
+	switch fields[0] {
+	case "download":
+		if len(fields) < 6 {
+			return Progress{}, false
+		}
+		p := Progress{
+			Phase:           PhaseDownloading,
+			DownloadedBytes: int64(parseProgressNumber(fields[1])),
+			TotalBytes:      int64(parseProgressNumber(fields[2])),
+			Speed:           parseProgressNumber(fields[4]),
+			ETA:             time.Duration(parseProgressNumber(fields[5])) * time.Second,
+		}
+		if p.TotalBytes == 0 {
+			p.TotalBytes = int64(parseProgressNumber(fields[3]))
+		}
+		if p.TotalBytes > 0 {
+			p.Percent = float64(p.DownloadedBytes) / float64(p.TotalBytes) * 100
+			if p.Percent > 100 {
+				p.Percent = 100
+			}
+		}
+		return p, true
+	case "postprocess":
+		p := Progress{Phase: PhasePostProcessing, Percent: 100}
+		if len(fields) > 1 && fields[1] != "NA" {
+			p.Postprocessor = fields[1]
+		}
+		return p, true
+	}
+	return Progress{}, false
+}
+
+func parseProgressNumber(value string) float64 {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0
+	}
+	return number
+}
+
+// progressWriter splits yt-dlp output into lines, hands progress lines to the
+// callback and keeps everything else for logging.
+type progressWriter struct {
+	onProgress ProgressFunc
+	output     bytes.Buffer
+	partial    []byte
+}
+
+func newProgressWriter(onProgress ProgressFunc) *progressWriter {
+	return &progressWriter{onProgress: onProgress}
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		idx := bytes.IndexByte(w.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		w.handleLine(w.partial[:idx+1])
+		w.partial = w.partial[idx+1:]
+	}
+	return len(p), nil
+}
+
+func (w *progressWriter) handleLine(line []byte) {
+	if progress, ok := parseProgressLine(strings.TrimRight(string(line), "\r\n")); ok {
+		if w.onProgress != nil {
+			w.onProgress(progress)
+		}
+		return
+	}
+	w.output.Write(line)
+}
+
+func (w *progressWriter) Len() int {
+	return w.output.Len() + len(w.partial)
+}
+
+func (w *progressWriter) String() string {
+	return w.output.String() + string(w.partial)
+}
@@ -0,0 +1,74 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want Progress
+		ok   bool
+	}{
+		{
+			name: "download with total",
+			line: "zebio-progress download 2500 10000 NA 1024.5 7",
+			want: Progress{Phase: PhaseDownloading, Percent: 25, DownloadedBytes: 2500, TotalBytes: 10000, Speed: 1024.5, ETA: 7 * time.Second},
+			ok:   true,
+		},
+		{
+			name: "download with estimate only",
+			line: "zebio-progress download 500 NA 1000 NA NA",
+			want: Progress{Phase: PhaseDownloading, Percent: 50, DownloadedBytes: 500, TotalBytes: 1000},
+			ok:   true,
+		},
+		{
+			name: "download without any total",
+			line: "zebio-progress download 500 NA NA NA NA",
+			want: Progress{Phase: PhaseDownloading, DownloadedBytes: 500},
+			ok:   true,
+		},
+		{
+			name: "percent capped",
+			line: "zebio-progress download 1200 1000 NA 0 0",
+			want: Progress{Phase: PhaseDownloading, Percent: 100, DownloadedBytes: 1200, TotalBytes: 1000},
+			ok:   true,
+		},
+		{
+			name: "prefixed by yt-dlp",
+			line: "[download] zebio-progress download 10 100 NA 1 1",
+			want: Progress{Phase: PhaseDownloading, Percent: 10, DownloadedBytes: 10, TotalBytes: 100, Speed: 1, ETA: time.Second},
+			ok:   true,
+		},
+		{
+			name: "postprocess",
+			line: "zebio-progress postprocess FFmpegExtractAudio started",
+			want: Progress{Phase: PhasePostProcessing, Percent: 100, Postprocessor: "FFmpegExtractAudio"},
+			ok:   true,
+		},
+		{
+			name: "postprocess without name",
+			line: "zebio-progress postprocess NA finished",
+			want: Progress{Phase: PhasePostProcessing, Percent: 100},
+			ok:   true,
+		},
+		{name: "short download line", line: "zebio-progress download 1 2 3", ok: false},
+		{name: "unknown kind", line: "zebio-progress upload 1 2 3 4 5", ok: false},
+		{name: "marker only", line: "zebio-progress ", ok: false},
+		{name: "other output", line: "[youtube] abc: Downloading webpage", ok: false},
+		{name: "negative numbers", line: "zebio-progress download -5 100 NA -1 -1", want: Progress{Phase: PhaseDownloading, TotalBytes: 100}, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseProgressLine(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("parseProgressLine(%q) ok = %t, want %t", tt.line, ok, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("parseProgressLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
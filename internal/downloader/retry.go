@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// attempt carries the options that change between tries of a yt-dlp call.
+type attempt struct {
+	number      int
+	cookies     bool
+	looseFormat bool
+}
+
+func (d *YTDLP) cookiesFor(urlStr string) bool {
+	return d.youTubeCookiesPath != "" && strings.Contains(urlStr, "youtu")
+}
+
+// backoff doubles the delay with every attempt up to the maximum and picks a
+// random point in its upper half so parallel jobs do not retry in lockstep.
+func (d *YTDLP) backoff(failedAttempts int) time.Duration {
+	delay := d.opts.RetryBaseDelay
+	for i := 1; i < failedAttempts && delay < d.opts.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.opts.RetryMaxDelay {
+		delay = d.opts.RetryMaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retry runs fn until it succeeds, the error is not worth another try or the
+// attempts are used up. Each try gets its own timeout. Transient failures are
+// retried after a backoff, format failures with a looser format selector and
+// cookie failures with the cookies toggled.
+func (d *YTDLP) retry(ctx context.Context, timeout time.Duration, op, target, username string, cookies bool, fn func(ctx context.Context, a attempt) error) error {
+	a := attempt{number: 1, cookies: cookies}
+	for {
+		attemptCtx, cancel := withTimeout(ctx, timeout)
+		err := fn(attemptCtx, a)
+		cancel()
+		if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) || a.number >= d.opts.RetryAttempts {
+			return err
+		}
+
+		next := attempt{number: a.number + 1, cookies: a.cookies, looseFormat: a.looseFormat}
+		var delay time.Duration
+		switch {
+		case errors.Is(err, ErrFormatUnavailable) && !a.looseFormat:
+			next.looseFormat = true
+		case errors.Is(err, ErrCookies) && a.cookies:
+			next.cookies = false
+		case (errors.Is(err, ErrLoginRequired) || errors.Is(err, ErrBotCheck)) && !a.cookies && d.youTubeCookiesPath != "":
+			next.cookies = true
+		case Retryable(err):
+			delay = d.backoff(a.number)
+		default:
+			return err
+		}
+
+		log.Printf("[%s] yt-dlp %s for %s failed on attempt %d of %d: %v. Retrying in %s (cookies: %t, loose format: %t).", username, op, target, a.number, d.opts.RetryAttempts, err, delay.Round(time.Millisecond), next.cookies, next.looseFormat)
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+		}
+		a = next
+	}
+}
@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+)
+
+const AudioFormatOriginal = "original"
+
+var AudioFormats = []string{"mp3", "m4a", "opus", "flac", "wav", "ogg", AudioFormatOriginal}
+
+// MediaSpec describes what a download should produce.
+type MediaSpec struct {
+	Type DownloadType
+	// AudioFormat is one of AudioFormats. AudioFormatOriginal keeps the
+	// source stream without re-encoding.
+	AudioFormat string
+	// AudioQuality is passed to yt-dlp as is: a bitrate such as "192K" or a
+	// VBR level from "0" (best) to "10". Empty keeps the encoder default.
+	AudioQuality string
+	MaxHeight    int
+	// FormatSelector overrides the video format chosen from MaxHeight.
+	FormatSelector string
+	EmbedThumbnail bool
+}
+
+func (s MediaSpec) IsLossless() bool {
+	return s.AudioFormat == "flac" || s.AudioFormat == "wav"
+}
+
+// Key is a short stable description of the spec, used to tell apart files
+// produced from the same source with different options.
+func (s MediaSpec) Key() string {
+	var key string
+	switch s.Type {
+	case AudioOnly:
+		key = s.AudioFormat
+		if s.AudioQuality != "" && s.AudioFormat != AudioFormatOriginal && !s.IsLossless() {
+			key += "-" + strings.ToLower(s.AudioQuality)
+		}
+	case VideoBest:
+		key = fmt.Sprintf("%dp", s.MaxHeight)
+	default:
+		return ""
+	}
+	if !s.EmbedThumbnail {
+		key += "-nothumb"
+	}
+	return key
+}
+
+func ytdlpAudioFormat(format string) string {
+	switch format {
+	case "", "mp3":
+		return "mp3"
+	case "ogg":
+		return "vorbis"
+	case AudioFormatOriginal:
+		return "best"
+	}
+	return format
+}
+
+// audioArgs leaves the format choice to yt-dlp when loose is set, for sites
+// whose formats do not match the usual selector.
+func audioArgs(spec MediaSpec, loose bool) []string {
+	var args []string
+	if !loose {
+		args = append(args, "-f", "bestaudio/best")
+	}
+	args = append(args, "--extract-audio", "--audio-format", ytdlpAudioFormat(spec.AudioFormat))
+	if spec.AudioQuality != "" && spec.AudioFormat != AudioFormatOriginal && !spec.IsLossless() {
+		args = append(args, "--audio-quality", spec.AudioQuality)
+	}
+	return args
+}
+
+func canEmbedThumbnail(spec MediaSpec) bool {
+	if spec.Type == ImageBest {
+		return false
+	}
+	return !(spec.Type == AudioOnly && spec.AudioFormat == "wav")
+}
+
+// videoFormatSelector prefers mp4 streams. The loose variant accepts any
+// container and codec, including formats that carry both streams.
+func videoFormatSelector(maxHeight int, loose bool) string {
+	if loose {
+		if maxHeight <= 0 {
+			return "bv*+ba/b"
+		}
+		h := fmt.Sprintf("[height<=%d]", maxHeight)
+		return "bv*" + h + "+ba/b" + h + "/bv*+ba/b"
+	}
+	if maxHeight <= 0 {
+		return "bestvideo[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best"
+	}
+	h := fmt.Sprintf("[height<=%d]", maxHeight)
+	return "bestvideo" + h + "[ext=mp4]+bestaudio[ext=m4a]/best" + h + "[ext=mp4]/best" + h + "/best"
+}
@@ -0,0 +1,159 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// digestAlgorithms lists the checksums servers advertise, strongest first.
+var digestAlgorithms = []struct {
+	name    string
+	newHash func() hash.Hash
+}{
+	{"sha-512", sha512.New},
+	{"sha-256", sha256.New},
+	{"md5", md5.New},
+}
+
+type digest struct {
+	algorithm string
+	sum       []byte
+}
+
+func (d *digest) newHash() hash.Hash {
+	for _, alg := range digestAlgorithms {
+		if alg.name == d.algorithm {
+			return alg.newHash()
+		}
+	}
+	return nil
+}
+
+// expectedDigest reads the checksum of the whole file from the Repr-Digest
+// (RFC 9530), Digest (RFC 3230) or Content-MD5 headers.
+func expectedDigest(header http.Header) *digest {
+	sums := make(map[string][]byte)
+	for _, field := range []string{"Repr-Digest", "Digest"} {
+		for _, value := range header.Values(field) {
+			for _, entry := range strings.Split(value, ",") {
+				name, encoded, ok := strings.Cut(strings.TrimSpace(entry), "=")
+				if !ok {
+					continue
+				}
+				// Repr-Digest wraps the value in colons.
+				encoded = strings.Trim(encoded, ":")
+				if sum, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+					sums[strings.ToLower(name)] = sum
+				}
+			}
+		}
+	}
+	if value := header.Get("Content-MD5"); value != "" {
+		if sum, err := base64.StdEncoding.DecodeString(value); err == nil {
+			sums["md5"] = sum
+		}
+	}
+	for _, alg := range digestAlgorithms {
+		if sum, ok := sums[alg.name]; ok && len(sum) == alg.newHash().Size() {
+			return &digest{algorithm: alg.name, sum: sum}
+		}
+	}
+	return nil
+}
+
+// writeError marks a failure to write the local file, as opposed to a
+// failure to read the response.
+type writeError struct {
+	err error
+}
+
+func (e *writeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *writeError) Unwrap() error {
+	return e.err
+}
+
+// transfer is the state of one direct download that survives the requests
+// needed to complete it.
+type transfer struct {
+	file       *os.File
+	written    int64
+	total      int64
+	validator  string
+	digest     *digest
+	hash       hash.Hash
+	kind       mediaKind
+	start      time.Time
+	onProgress ProgressFunc
+}
+
+func (t *transfer) Write(p []byte) (int, error) {
+	n, err := t.file.Write(p)
+	if err != nil {
+		return n, &writeError{err: err}
+	}
+	if t.hash != nil {
+		t.hash.Write(p[:n])
+	}
+	t.written += int64(n)
+	if t.onProgress != nil {
+		t.onProgress(t.progress())
+	}
+	return n, nil
+}
+
+// progress reports the transfer in the same form as yt-dlp progress lines.
+func (t *transfer) progress() Progress {
+	p := Progress{Phase: PhaseDownloading, DownloadedBytes: t.written}
+	if elapsed := time.Since(t.start).Seconds(); elapsed > 0 {
+		p.Speed = float64(t.written) / elapsed
+	}
+	if t.total > 0 {
+		p.TotalBytes = t.total
+		p.Percent = float64(t.written) * 100 / float64(t.total)
+		if p.Speed > 0 {
+			p.ETA = time.Duration(float64(t.total-t.written) / p.Speed * float64(time.Second))
+		}
+	}
+	return p
+}
+
+// reset discards what was written so the file can be fetched again from the
+// start.
+func (t *transfer) reset() error {
+	if t.written > 0 {
+		if err := t.file.Truncate(0); err != nil {
+			return &writeError{err: err}
+		}
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return &writeError{err: err}
+		}
+	}
+	t.written = 0
+	if t.hash != nil {
+		t.hash.Reset()
+	}
+	return nil
+}
+
+func (t *transfer) verify() error {
+	if t.digest == nil || t.hash == nil {
+		return nil
+	}
+	if sum := t.hash.Sum(nil); !bytes.Equal(sum, t.digest.sum) {
+		return fmt.Errorf("%s checksum mismatch: got %x, want %x", t.digest.algorithm, sum, t.digest.sum)
+	}
+	return nil
+}
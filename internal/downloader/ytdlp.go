@@ -0,0 +1,427 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// filepathMarker tags the line yt-dlp prints with the final file path.
+const filepathMarker = "[zebio-file]"
+
+type Options struct {
+	InfoTimeout     time.Duration
+	SearchTimeout   time.Duration
+	DownloadTimeout time.Duration
+	// RetryAttempts is the total number of tries for a yt-dlp call,
+	// including the first one.
+	RetryAttempts  int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// Proxy is the URL of the urlguard proxy every yt-dlp connection goes
+	// through. yt-dlp is not run without it.
+	Proxy string
+}
+
+var errNoProxy = errors.New("yt-dlp is not run without the URL guard proxy")
+
+// YTDLP is the backend that runs yt-dlp. It handles every site yt-dlp has an
+// extractor for and is the fallback for URLs no other backend takes.
+type YTDLP struct {
+	ytDLPPath          string
+	youTubeCookiesPath string
+	opts               Options
+}
+
+func NewYTDLP(ytDLPPath, youTubeCookiesPath string, opts Options) *YTDLP {
+	return &YTDLP{ytDLPPath: ytDLPPath, youTubeCookiesPath: youTubeCookiesPath, opts: opts}
+}
+
+// command builds a yt-dlp call that connects through the guard proxy.
+// yt-dlp resolves hosts and follows redirects itself, so checking the URLs it
+// is given is not enough to keep it away from internal addresses.
+func (d *YTDLP) command(ctx context.Context, args ...string) (*exec.Cmd, error) {
+	if d.opts.Proxy == "" {
+		return nil, errNoProxy
+	}
+	return exec.CommandContext(ctx, d.ytDLPPath, append([]string{"--proxy", d.opts.Proxy}, args...)...), nil
+}
+
+func (d *YTDLP) Name() string {
+	return "yt-dlp"
+}
+
+func (d *YTDLP) Handles(urlStr string) bool {
+	return true
+}
+
+type ytdlpJSONEntry struct {
+	ID           string        `json:"id"`
+	Title        string        `json:"title"`
+	Artist       string        `json:"artist"`
+	Creator      string        `json:"creator"`
+	Uploader     string        `json:"uploader"`
+	Thumbnail    string        `json:"thumbnail"`
+	DisplayURL   string        `json:"display_url"`
+	URL          string        `json:"url"`
+	Ext          string        `json:"ext"`
+	Vcodec       string        `json:"vcodec"`
+	Acodec       string        `json:"acodec"`
+	ExtractorKey string        `json:"extractor_key"`
+	Filename     string        `json:"_filename"`
+	WebpageURL   string        `json:"webpage_url"`
+	Duration     float64       `json:"duration"`
+	Formats      []ytdlpFormat `json:"formats"`
+	Thumbnails   []struct {
+		URL    string `json:"url"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	} `json:"thumbnails"`
+}
+
+type ytdlpPlaylistJSON struct {
+	Type       string           `json:"_type"`
+	Title      string           `json:"title"`
+	Uploader   string           `json:"uploader"`
+	WebpageURL string           `json:"webpage_url"`
+	Entries    []ytdlpJSONEntry `json:"entries"`
+}
+
+func contextError(ctx context.Context, action string, target string) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return &Error{Backend: "yt-dlp", Op: action, URL: target, Kind: ErrTimeout, Err: context.DeadlineExceeded}
+	case context.Canceled:
+		return fmt.Errorf("yt-dlp %s cancelled for %s: %w", action, target, context.Canceled)
+	}
+	return nil
+}
+
+func (d *YTDLP) Probe(ctx context.Context, urlStr string, username string) (*LinkInfo, error) {
+
+	var jsonData bytes.Buffer
+	err := d.retry(ctx, d.opts.InfoTimeout, "info", urlStr, username, d.cookiesFor(urlStr), func(ctx context.Context, a attempt) error {
+		args := []string{"-J"}
+		if a.cookies {
+			args = append(args, "--cookies", d.youTubeCookiesPath)
+		}
+		if strings.Contains(urlStr, "soundcloud.com") && (strings.Contains(urlStr, "/sets/") || strings.Contains(urlStr, "/playlists/")) {
+			args = append(args, "--flat-playlist", urlStr)
+		} else {
+			args = append(args, "--no-playlist", urlStr)
+		}
+
+		cmd, err := d.command(ctx, args...)
+		if err != nil {
+			return err
+		}
+
+		jsonData.Reset()
+		var stderrBuf bytes.Buffer
+		cmd.Stdout = &jsonData
+		cmd.Stderr = &stderrBuf
+
+		err = cmd.Run()
+		if stderrBuf.Len() > 0 {
+			log.Printf("[%s] yt-dlp (info) STDERR for %s:\n%s\n", username, urlStr, stderrBuf.String())
+		}
+		if err != nil {
+			if ctxErr := contextError(ctx, "info", urlStr); ctxErr != nil {
+				return ctxErr
+			}
+			if _, ok := err.(*exec.ExitError); !ok {
+				return fmt.Errorf("[%s] failed to run yt-dlp for %s: %w", username, urlStr, err)
+			}
+		}
+
+		if jsonData.Len() == 0 {
+			if err == nil {
+				err = errors.New("no JSON output")
+			}
+			return newError("info", urlStr, stderrBuf.String(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var output ytdlpPlaylistJSON
+	if err := json.Unmarshal(jsonData.Bytes(), &output); err == nil && output.Type == "playlist" {
+		linkInfo := &LinkInfo{
+			Type:        "album",
+			Title:       output.Title,
+			Uploader:    output.Uploader,
+			OriginalURL: output.WebpageURL,
+		}
+		for _, entryData := range output.Entries {
+			track := parseTrackInfoFromData(entryData)
+			linkInfo.Tracks = append(linkInfo.Tracks, track)
+		}
+		log.Printf("[%s] Album/Playlist info fetched: Title: '%s', Track Count: %d\n", username, linkInfo.Title, len(linkInfo.Tracks))
+		return linkInfo, nil
+	}
+
+	var singleEntry ytdlpJSONEntry
+	if err := json.Unmarshal(jsonData.Bytes(), &singleEntry); err != nil {
+		return nil, fmt.Errorf("[%s] failed to unmarshal yt-dlp JSON for %s: %w", username, urlStr, err)
+	}
+
+	track := parseTrackInfoFromData(singleEntry)
+	linkInfo := &LinkInfo{
+		Type:        "track",
+		Title:       track.Title,
+		Uploader:    track.Artist,
+		OriginalURL: track.OriginalURL,
+		Tracks:      []*TrackInfo{track},
+	}
+	return linkInfo, nil
+}
+
+func parseTrackInfoFromData(data ytdlpJSONEntry) *TrackInfo {
+	info := &TrackInfo{
+		ID:           data.ID,
+		Extractor:    data.ExtractorKey,
+		Title:        data.Title,
+		Artist:       data.Artist,
+		ThumbnailURL: data.Thumbnail,
+		Extension:    data.Ext,
+		Filename:     data.Filename,
+		OriginalURL:  data.WebpageURL,
+		URL:          data.URL,
+		Duration:     data.Duration,
+		Formats:      parseFormats(data.Formats),
+	}
+
+	if info.Artist == "" {
+		if data.Creator != "" {
+			info.Artist = data.Creator
+		} else {
+			info.Artist = data.Uploader
+		}
+	}
+	if info.Artist == "" {
+		info.Artist = "Unknown Artist"
+	}
+	if info.Title == "" {
+		if data.ID != "" {
+			info.Title = data.ID
+		} else {
+			info.Title = "Unknown Title"
+		}
+	}
+
+	if data.Vcodec != "none" && data.Vcodec != "" {
+		info.HasVideo = true
+	}
+
+	if data.ExtractorKey == "Instagram" && !info.HasVideo {
+		info.HasImage = true
+		if data.DisplayURL != "" {
+			info.DirectImageURL = data.DisplayURL
+		} else if data.URL != "" && (strings.HasSuffix(data.URL, ".jpg") || strings.HasSuffix(data.URL, ".jpeg")) {
+			info.DirectImageURL = data.URL
+		} else if len(data.Thumbnails) > 0 {
+			var bestThumbnailURL string
+			var maxWidth int = 0
+			for _, t := range data.Thumbnails {
+				if t.Width > maxWidth {
+					maxWidth = t.Width
+					bestThumbnailURL = t.URL
+				}
+			}
+			info.DirectImageURL = bestThumbnailURL
+		}
+	}
+
+	if !info.HasVideo && !info.HasImage && data.Acodec != "none" && data.Acodec != "" {
+		info.IsAudioOnly = true
+	}
+	return info
+}
+
+// searchPrefixes are the yt-dlp search keys of the sites it can search.
+var searchPrefixes = map[SearchSite]string{
+	SearchYouTube:    "ytsearch",
+	SearchSoundCloud: "scsearch",
+}
+
+type ytdlpSearchJSON struct {
+	Entries []struct {
+		ID         string  `json:"id"`
+		IEKey      string  `json:"ie_key"`
+		Title      string  `json:"title"`
+		URL        string  `json:"url"`
+		WebpageURL string  `json:"webpage_url"`
+		Channel    string  `json:"channel"`
+		Uploader   string  `json:"uploader"`
+		Duration   float64 `json:"duration"`
+		ViewCount  float64 `json:"view_count"`
+	} `json:"entries"`
+}
+
+func (d *YTDLP) Search(ctx context.Context, site SearchSite, query string, limit int, username string) ([]SearchResult, error) {
+	prefix, ok := searchPrefixes[site]
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	op := string(site) + " search"
+
+	var jsonData bytes.Buffer
+	useCookies := site == SearchYouTube && d.youTubeCookiesPath != ""
+	err := d.retry(ctx, d.opts.SearchTimeout, op, query, username, useCookies, func(ctx context.Context, a attempt) error {
+		// A flat listing is enough for the result list and saves extracting
+		// every entry.
+		args := []string{"-J", "--flat-playlist"}
+		if a.cookies {
+			args = append(args, "--cookies", d.youTubeCookiesPath)
+		}
+		args = append(args, fmt.Sprintf("%s%d:%s", prefix, limit, query))
+
+		cmd, err := d.command(ctx, args...)
+		if err != nil {
+			return err
+		}
+
+		var stderr bytes.Buffer
+		jsonData.Reset()
+		cmd.Stdout = &jsonData
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			if ctxErr := contextError(ctx, op, query); ctxErr != nil {
+				return ctxErr
+			}
+			log.Printf("[%s] yt-dlp %s failed. STDERR: %s", username, op, stderr.String())
+			return newError(op, query, stderr.String(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var output ytdlpSearchJSON
+	if err := json.Unmarshal(jsonData.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("could not parse %s result: %w", op, err)
+	}
+	var results []SearchResult
+	for _, entry := range output.Entries {
+		result := SearchResult{
+			Site:      site,
+			Extractor: entry.IEKey,
+			ID:        entry.ID,
+			URL:       strings.TrimSpace(entry.WebpageURL),
+			Title:     entry.Title,
+			Channel:   entry.Channel,
+			Duration:  entry.Duration,
+			Views:     int64(entry.ViewCount),
+		}
+		if result.URL == "" {
+			result.URL = strings.TrimSpace(entry.URL)
+		}
+		if result.URL == "" {
+			continue
+		}
+		if result.Channel == "" {
+			result.Channel = entry.Uploader
+		}
+		if result.Title == "" {
+			result.Title = entry.ID
+		}
+		results = append(results, result)
+	}
+	log.Printf("[%s] %s for '%s' returned %d results.", username, op, query, len(results))
+	return results, nil
+}
+
+func (d *YTDLP) Download(ctx context.Context, req DownloadRequest) (string, error) {
+	spec, username := req.Spec, req.Username
+	urlStr, downloadURL := req.URL, req.MediaURL()
+	// req.Name is sanitized already and keeps non-Latin titles, so yt-dlp must
+	// not rewrite it; the final path is read from its output instead.
+	outputTemplate := filepath.Join(req.Dir, req.Name) + ".%(ext)s"
+
+	var actualFilename string
+	err := d.retry(ctx, d.opts.DownloadTimeout, "download", urlStr, username, d.cookiesFor(downloadURL), func(ctx context.Context, a attempt) error {
+		cmdArgs := append([]string{"-v", "--no-playlist", "--print", "after_move:" + filepathMarker + " %(filepath)s"}, progressArgs()...)
+		if a.cookies {
+			cmdArgs = append(cmdArgs, "--cookies", d.youTubeCookiesPath)
+		}
+		if spec.EmbedThumbnail && canEmbedThumbnail(spec) {
+			cmdArgs = append(cmdArgs, "--embed-thumbnail")
+		}
+		switch spec.Type {
+		case AudioOnly:
+			cmdArgs = append(cmdArgs, audioArgs(spec, a.looseFormat)...)
+		case VideoBest:
+			formatSelector := spec.FormatSelector
+			if formatSelector == "" || a.looseFormat {
+				formatSelector = videoFormatSelector(spec.MaxHeight, a.looseFormat)
+			}
+			cmdArgs = append(cmdArgs, "-f", formatSelector, "--merge-output-format", "mp4")
+		}
+		cmdArgs = append(cmdArgs, "-o", outputTemplate, downloadURL)
+
+		cmd, err := d.command(ctx, cmdArgs...)
+		if err != nil {
+			return err
+		}
+
+		stdoutBuf := newProgressWriter(req.OnProgress)
+		stderrBuf := newProgressWriter(req.OnProgress)
+		cmd.Stdout = stdoutBuf
+		cmd.Stderr = stderrBuf
+
+		log.Printf("[%s] Executing yt-dlp download command: %s\n", username, strings.Join(cmd.Args, " "))
+		err = cmd.Run()
+
+		if stdoutBuf.Len() > 0 {
+			log.Printf("[%s] yt-dlp (download) STDOUT:\n%s\n", username, stdoutBuf.String())
+		}
+		if stderrBuf.Len() > 0 {
+			log.Printf("[%s] yt-dlp (download) STDERR:\n%s\n", username, stderrBuf.String())
+		}
+
+		if err != nil {
+			if ctxErr := contextError(ctx, "download", urlStr); ctxErr != nil {
+				return ctxErr
+			}
+			return newError("download", urlStr, stderrBuf.String(), err)
+		}
+
+		actualFilename = printedFilepath(stdoutBuf.String())
+		if actualFilename == "" {
+			return fmt.Errorf("[%s] yt-dlp ran but did not report the downloaded file (basename: %s)", username, req.Name)
+		}
+		if _, statErr := os.Stat(actualFilename); statErr != nil {
+			return fmt.Errorf("[%s] yt-dlp reported file '%s' but it is missing: %w", username, actualFilename, statErr)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return actualFilename, nil
+}
+
+func printedFilepath(output string) string {
+	var path string
+	for _, line := range strings.Split(output, "\n") {
+		if after, ok := strings.CutPrefix(strings.TrimSpace(line), filepathMarker+" "); ok {
+			path = after
+		}
+	}
+	return path
+}
@@ -0,0 +1,94 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestYTDLPRefusesToRunWithoutProxy(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	script := writeScript(t, "touch "+marker+"\n")
+	d := NewYTDLP(script, "", Options{})
+
+	if _, err := d.Probe(context.Background(), "https://example.com/video", "test"); !errors.Is(err, errNoProxy) {
+		t.Errorf("Probe: got error %v, want errNoProxy", err)
+	}
+	if _, err := d.Search(context.Background(), SearchYouTube, "query", 1, "test"); !errors.Is(err, errNoProxy) {
+		t.Errorf("Search: got error %v, want errNoProxy", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("yt-dlp was started without a proxy")
+	}
+}
+
+func TestYTDLPPassesProxy(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	script := writeScript(t, `printf '%s\n' "$@" > `+argsFile+`
+echo '{"id": "abc", "title": "Title", "uploader": "Uploader"}'
+`)
+	d := NewYTDLP(script, "", Options{Proxy: "http://127.0.0.1:8888"})
+
+	if _, err := d.Probe(context.Background(), "https://example.com/video", "test"); err != nil {
+		t.Fatal(err)
+	}
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(args), "--proxy\nhttp://127.0.0.1:8888\n") {
+		t.Errorf("yt-dlp was run with %q, want the proxy first", args)
+	}
+}
+
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "yt-dlp")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestYTDLPDownloadKeepsUnicodeName(t *testing.T) {
+	argsFile := filepath.Join(t.TempDir(), "args")
+	// Creates the file the -o template names and reports it like yt-dlp does.
+	script := writeScript(t, `printf '%s\n' "$@" > `+argsFile+`
+out=""
+prev=""
+for arg in "$@"; do
+	if [ "$prev" = "-o" ]; then out="$arg"; fi
+	prev="$arg"
+done
+file=$(printf '%s' "$out" | sed 's/%(ext)s/mp3/')
+: > "$file"
+echo "`+filepathMarker+` $file"
+`)
+	d := NewYTDLP(script, "", Options{Proxy: "http://127.0.0.1:8888"})
+	info := &TrackInfo{Artist: "همایون شجریان", Title: "سرو چمان"}
+	req := DownloadRequest{
+		URL:  "https://example.com/track",
+		Spec: MediaSpec{Type: AudioOnly, AudioFormat: "mp3"},
+		Info: info,
+		Dir:  t.TempDir(),
+		Name: storedFilename(info),
+	}
+
+	path, err := d.Download(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "همایون شجریان - سرو چمان.mp3"; filepath.Base(path) != want {
+		t.Errorf("got file %q, want %q", filepath.Base(path), want)
+	}
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(args), "--restrict-filenames") {
+		t.Error("yt-dlp was asked to restrict filenames")
+	}
+}
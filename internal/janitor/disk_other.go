@@ -0,0 +1,7 @@
+//go:build !(linux || darwin || freebsd)
+
+package janitor
+
+func DiskSpace(path string) (int64, int64, error) {
+	return 0, 0, ErrUnsupported
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+package janitor
+
+import "syscall"
+
+// DiskSpace returns the bytes available to unprivileged users and the total
+// size of the filesystem holding path.
+func DiskSpace(path string) (int64, int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	blockSize := int64(stat.Bsize)
+	return int64(stat.Bavail) * blockSize, int64(stat.Blocks) * blockSize, nil
+}
@@ -0,0 +1,188 @@
+package janitor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnsupported is returned by DiskSpace on platforms without statfs.
+var ErrUnsupported = errors.New("janitor: disk space is not available on this platform")
+
+type Usage struct {
+	Entries   int
+	Size      int64
+	Free      int64
+	Total     int64
+	DiskKnown bool
+}
+
+type entry struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// Janitor keeps the download directory from growing without bound. Entries
+// older than the TTL are removed, and when the directory is above its size
+// limit the oldest entries go first. Entries reported by inUse are never
+// touched.
+type Janitor struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+	minFree int64
+	inUse   func(name string) bool
+
+	mu sync.Mutex
+}
+
+func New(dir string, ttl time.Duration, maxSize, minFree int64, inUse func(name string) bool) *Janitor {
+	return &Janitor{dir: dir, ttl: ttl, maxSize: maxSize, minFree: minFree, inUse: inUse}
+}
+
+func (j *Janitor) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, _, err := j.Sweep(); err != nil {
+			log.Printf("Error cleaning download directory: %v", err)
+		}
+	}
+}
+
+// scan lists the top level entries of the directory. The size and time of a
+// subdirectory are the total size and the newest modification time of its
+// contents.
+func (j *Janitor) scan() ([]entry, error) {
+	dirEntries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", j.dir, err)
+	}
+	entries := make([]entry, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		e := entry{name: dirEntry.Name()}
+		walkErr := filepath.WalkDir(filepath.Join(j.dir, e.name), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if info.ModTime().After(e.modTime) {
+				e.modTime = info.ModTime()
+			}
+			if info.Mode().IsRegular() {
+				e.size += info.Size()
+			}
+			return nil
+		})
+		if walkErr != nil {
+			log.Printf("Could not inspect %s: %v", e.name, walkErr)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Sweep removes expired entries and then the oldest ones until the directory
+// fits its size limit. It returns the number of entries and bytes removed.
+func (j *Janitor) Sweep() (int, int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.scan()
+	if err != nil {
+		return 0, 0, err
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].modTime.Before(entries[b].modTime)
+	})
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	removed := 0
+	var freed int64
+	now := time.Now()
+	for _, e := range entries {
+		expired := now.Sub(e.modTime) > j.ttl
+		overQuota := j.maxSize > 0 && total > j.maxSize
+		if (!expired && !overQuota) || j.inUse(e.name) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(j.dir, e.name)); err != nil {
+			log.Printf("Could not remove %s from the download directory: %v", e.name, err)
+			continue
+		}
+		removed++
+		freed += e.size
+		total -= e.size
+	}
+	if removed > 0 {
+		log.Printf("Janitor removed %d entries (%d bytes) from %s. %d bytes remain.", removed, freed, j.dir, total)
+	}
+	if j.maxSize > 0 && total > j.maxSize {
+		log.Printf("Warning: Download directory is still %d bytes, above the %d byte limit, because the rest is in use.", total, j.maxSize)
+	}
+	return removed, freed, nil
+}
+
+func (j *Janitor) Usage() (Usage, error) {
+	entries, err := j.scan()
+	if err != nil {
+		return Usage{}, err
+	}
+	usage := Usage{Entries: len(entries)}
+	for _, e := range entries {
+		usage.Size += e.size
+	}
+	free, total, err := DiskSpace(j.dir)
+	if err == nil {
+		usage.Free, usage.Total, usage.DiskKnown = free, total, true
+	} else if !errors.Is(err, ErrUnsupported) {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// HasFreeSpace reports whether the disk has room for new downloads. When it
+// does not, a sweep is run first in case that frees enough.
+func (j *Janitor) HasFreeSpace() bool {
+	if j.minFree <= 0 {
+		return true
+	}
+	free, _, err := DiskSpace(j.dir)
+	if err != nil {
+		if !errors.Is(err, ErrUnsupported) {
+			log.Printf("Could not check free disk space of %s: %v", j.dir, err)
+		}
+		return true
+	}
+	if free >= j.minFree {
+		return true
+	}
+	log.Printf("Free disk space %d bytes is below the %d byte minimum. Running janitor.", free, j.minFree)
+	if _, _, err := j.Sweep(); err != nil {
+		log.Printf("Error cleaning download directory: %v", err)
+	}
+	free, _, err = DiskSpace(j.dir)
+	return err != nil || free >= j.minFree
+}
+
+func (j *Janitor) MinFree() int64 {
+	return j.minFree
+}
+
+func (j *Janitor) MaxSize() int64 {
+	return j.maxSize
+}
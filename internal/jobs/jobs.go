@@ -0,0 +1,412 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+)
+
+type State string
+
+const (
+	StateQueued      State = "queued"
+	StateFetching    State = "fetching"
+	StateDownloading State = "downloading"
+	StateUploading   State = "uploading"
+	StateDone        State = "done"
+	StateFailed      State = "failed"
+	StateCancelled   State = "cancelled"
+	// StateInterrupted marks a job stopped by a shutdown. It is resumed on
+	// the next start when it has resume data.
+	StateInterrupted State = "interrupted"
+)
+
+func (s State) IsFinal() bool {
+	return s == StateDone || s == StateFailed || s == StateCancelled || s == StateInterrupted
+}
+
+type Kind string
+
+const (
+	KindSingle       Kind = "single"
+	KindAlbum        Kind = "album"
+	KindSpotifyAlbum Kind = "spotify_album"
+)
+
+var (
+	ErrNotFound        = errors.New("job not found")
+	ErrNotOwner        = errors.New("job belongs to another user")
+	ErrAlreadyFinished = errors.New("job has already finished")
+	// ErrShutdown is the cancellation cause of jobs interrupted by Interrupt.
+	ErrShutdown = errors.New("interrupted by shutdown")
+)
+
+type Job struct {
+	ID        string
+	UserID    int64
+	ChatID    int64
+	Kind      Kind
+	Title     string
+	URL       string
+	State     State
+	Error     string
+	Resume    json.RawMessage
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	cancel context.CancelCauseFunc
+}
+
+type Manager struct {
+	mu          sync.Mutex
+	jobs        map[string]*Job
+	retention   time.Duration
+	store       store.JobStore
+	resumable   []string
+	interrupted bool
+}
+
+// NewManager loads the job history from the store. Jobs that were still
+// running when the previous process stopped are marked as failed, while jobs
+// interrupted by a shutdown are kept for Resumable.
+func NewManager(ctx context.Context, st store.JobStore, retention time.Duration) (*Manager, error) {
+	m := &Manager{
+		jobs:      make(map[string]*Job),
+		retention: retention,
+		store:     st,
+	}
+	records, err := st.ListJobs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jobs: %w", err)
+	}
+	now := time.Now()
+	for _, record := range records {
+		job := jobFromRecord(record)
+		if job.State == StateInterrupted && len(job.Resume) > 0 {
+			m.resumable = append(m.resumable, job.ID)
+		} else if !job.State.IsFinal() || job.State == StateInterrupted {
+			job.State = StateFailed
+			job.Error = "interrupted by restart"
+			job.UpdatedAt = now
+			m.persistLocked(job)
+		}
+		m.jobs[job.ID] = job
+	}
+	m.pruneLocked(now)
+	return m, nil
+}
+
+func jobFromRecord(record store.JobRecord) *Job {
+	return &Job{
+		ID:        record.ID,
+		UserID:    record.UserID,
+		ChatID:    record.ChatID,
+		Kind:      Kind(record.Kind),
+		Title:     record.Title,
+		URL:       record.URL,
+		State:     State(record.State),
+		Error:     record.Error,
+		Resume:    record.Resume,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+		cancel:    func(error) {},
+	}
+}
+
+func (j *Job) record() store.JobRecord {
+	return store.JobRecord{
+		ID:        j.ID,
+		UserID:    j.UserID,
+		ChatID:    j.ChatID,
+		Kind:      string(j.Kind),
+		Title:     j.Title,
+		URL:       j.URL,
+		State:     string(j.State),
+		Error:     j.Error,
+		Resume:    j.Resume,
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+	}
+}
+
+func (m *Manager) persistLocked(job *Job) {
+	if err := m.store.SaveJob(context.Background(), job.record()); err != nil {
+		log.Printf("Error persisting job %s: %v", job.ID, err)
+	}
+}
+
+// Create registers a new job. After Interrupt the job is created already
+// interrupted, so it is picked up by the next start instead.
+func (m *Manager) Create(parent context.Context, userID, chatID int64, kind Kind, title, url string) (*Job, context.Context) {
+	ctx, cancel := context.WithCancelCause(parent)
+	now := time.Now()
+	job := &Job{
+		ID:        newID(),
+		UserID:    userID,
+		ChatID:    chatID,
+		Kind:      kind,
+		Title:     title,
+		URL:       url,
+		State:     StateQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+		cancel:    cancel,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.interrupted {
+		job.State = StateInterrupted
+		cancel(ErrShutdown)
+	}
+	m.pruneLocked(now)
+	m.jobs[job.ID] = job
+	m.persistLocked(job)
+	snapshot := *job
+	return &snapshot, ctx
+}
+
+// Assign fills in what a job created for a queued update turned out to be.
+// It returns false when the job is no longer known.
+func (m *Manager) Assign(id string, kind Kind, title, url string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	job.Kind = kind
+	job.Title = title
+	job.URL = url
+	job.UpdatedAt = time.Now()
+	m.persistLocked(job)
+	snapshot := *job
+	return &snapshot, true
+}
+
+// Discard removes a job that is still queued, for updates that turned out not
+// to start a download. Jobs that were cancelled or have run are kept.
+func (m *Manager) Discard(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || job.State != StateQueued {
+		return
+	}
+	delete(m.jobs, id)
+	if err := m.store.DeleteJob(context.Background(), id); err != nil {
+		log.Printf("Error deleting job %s from store: %v", id, err)
+	}
+	job.cancel(nil)
+}
+
+// SetResume stores the data needed to restart the job after a shutdown.
+func (m *Manager) SetResume(id string, data json.RawMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job, ok := m.jobs[id]; ok {
+		job.Resume = data
+		m.persistLocked(job)
+	}
+}
+
+func (m *Manager) SetState(id string, state State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || job.State.IsFinal() {
+		return
+	}
+	job.State = state
+	job.UpdatedAt = time.Now()
+	m.persistLocked(job)
+}
+
+func (m *Manager) SetTitle(id string, title string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job, ok := m.jobs[id]; ok {
+		job.Title = title
+		job.UpdatedAt = time.Now()
+		m.persistLocked(job)
+	}
+}
+
+// Finish moves the job into its final state. A job that ended with a
+// cancelled context is recorded as cancelled. An interrupted job that still
+// completed is recorded as done so it is not resumed.
+func (m *Manager) Finish(id string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || (job.State.IsFinal() && !(job.State == StateInterrupted && err == nil)) {
+		return
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.State = StateCancelled
+	case err != nil:
+		job.State = StateFailed
+		job.Error = err.Error()
+	default:
+		job.State = StateDone
+	}
+	if job.State.IsFinal() {
+		job.Resume = nil
+	}
+	job.UpdatedAt = time.Now()
+	m.persistLocked(job)
+	job.cancel(nil)
+}
+
+func (m *Manager) Cancel(id string, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if job.UserID != userID {
+		return ErrNotOwner
+	}
+	if job.State.IsFinal() {
+		return ErrAlreadyFinished
+	}
+	job.State = StateCancelled
+	job.UpdatedAt = time.Now()
+	m.persistLocked(job)
+	job.cancel(nil)
+	return nil
+}
+
+// Interrupt cancels every running job with ErrShutdown and returns them.
+// Jobs that are uploading are left alone because an upload cannot be
+// cancelled and resuming it would send the file twice.
+func (m *Manager) Interrupt() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.interrupted = true
+	var interrupted []Job
+	now := time.Now()
+	for _, job := range m.jobs {
+		if job.State.IsFinal() || job.State == StateUploading {
+			continue
+		}
+		job.State = StateInterrupted
+		job.UpdatedAt = now
+		m.persistLocked(job)
+		job.cancel(ErrShutdown)
+		interrupted = append(interrupted, *job)
+	}
+	return interrupted
+}
+
+// MarkInterrupted records a job that stopped for a shutdown before it got to
+// run, so the next start resumes it. Interrupt already does this for jobs it
+// finds running; this covers jobs that were only waiting.
+func (m *Manager) MarkInterrupted(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || (job.State.IsFinal() && job.State != StateInterrupted) {
+		return
+	}
+	job.State = StateInterrupted
+	job.UpdatedAt = time.Now()
+	m.persistLocked(job)
+	job.cancel(ErrShutdown)
+}
+
+// Interrupted reports whether ctx belongs to a job stopped by Interrupt.
+func Interrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrShutdown)
+}
+
+// Resumable returns the jobs interrupted by the previous shutdown.
+func (m *Manager) Resumable() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []Job
+	for _, id := range m.resumable {
+		if job, ok := m.jobs[id]; ok && job.State == StateInterrupted {
+			result = append(result, *job)
+		}
+	}
+	m.resumable = nil
+	return result
+}
+
+// Resume puts an interrupted job back into the queued state and returns a
+// fresh context for it.
+func (m *Manager) Resume(parent context.Context, id string) (*Job, context.Context, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	if job.State != StateInterrupted {
+		return nil, nil, ErrAlreadyFinished
+	}
+	ctx, cancel := context.WithCancelCause(parent)
+	job.State = StateQueued
+	job.UpdatedAt = time.Now()
+	job.cancel = cancel
+	m.persistLocked(job)
+	snapshot := *job
+	return &snapshot, ctx, nil
+}
+
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+func (m *Manager) ListByUser(userID int64) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked(time.Now())
+	var result []Job
+	for _, job := range m.jobs {
+		if job.UserID == userID {
+			result = append(result, *job)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+func (m *Manager) pruneLocked(now time.Time) {
+	for id, job := range m.jobs {
+		if job.State.IsFinal() && job.State != StateInterrupted && now.Sub(job.UpdatedAt) > m.retention {
+			delete(m.jobs, id)
+			if err := m.store.DeleteJob(context.Background(), id); err != nil {
+				log.Printf("Error deleting job %s from store: %v", id, err)
+			}
+		}
+	}
+}
+
+func newID() string {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format("150405")))[:8]
+	}
+	return hex.EncodeToString(buf)
+}
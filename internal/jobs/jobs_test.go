@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mohammad-Alipour/Zebio/internal/store"
+)
+
+func newTestManager(t *testing.T, st store.JobStore) *Manager {
+	t.Helper()
+	m, err := NewManager(context.Background(), st, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	return m
+}
+
+func TestMarkInterruptedIsResumedOnNextStart(t *testing.T) {
+	st := store.NewMemory()
+	m := newTestManager(t, st)
+	job, ctx := m.Create(context.Background(), 1, 1, KindSingle, "title", "https://example.com/a")
+	m.SetResume(job.ID, json.RawMessage(`{"url":"https://example.com/a"}`))
+
+	m.MarkInterrupted(job.ID)
+	if got, _ := m.Get(job.ID); got.State != StateInterrupted {
+		t.Fatalf("state = %s, want %s", got.State, StateInterrupted)
+	}
+	if !Interrupted(ctx) {
+		t.Error("context of the job was not interrupted")
+	}
+
+	next := newTestManager(t, st)
+	resumable := next.Resumable()
+	if len(resumable) != 1 || resumable[0].ID != job.ID {
+		t.Fatalf("Resumable() = %v, want job %s", resumable, job.ID)
+	}
+}
+
+func TestMarkInterruptedKeepsFinishedJobs(t *testing.T) {
+	m := newTestManager(t, store.NewMemory())
+	job, _ := m.Create(context.Background(), 1, 1, KindSingle, "title", "https://example.com/a")
+	if err := m.Cancel(job.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	m.MarkInterrupted(job.ID)
+	if got, _ := m.Get(job.ID); got.State != StateCancelled {
+		t.Errorf("state = %s, want %s", got.State, StateCancelled)
+	}
+}
+
+func TestAssignFillsInQueuedJob(t *testing.T) {
+	st := store.NewMemory()
+	m := newTestManager(t, st)
+	queued, _ := m.Create(context.Background(), 1, 1, KindSingle, "", "some text")
+
+	job, ok := m.Assign(queued.ID, KindAlbum, "Album", "https://example.com/album")
+	if !ok {
+		t.Fatal("Assign() = false for a known job")
+	}
+	if job.ID != queued.ID || job.Kind != KindAlbum || job.Title != "Album" || job.URL != "https://example.com/album" {
+		t.Errorf("Assign() = %+v", job)
+	}
+	record, err := st.GetJob(context.Background(), queued.ID)
+	if err != nil || record.Title != "Album" {
+		t.Errorf("stored job = %+v, %v, want the assigned title", record, err)
+	}
+	if _, ok := m.Assign("missing", KindSingle, "", ""); ok {
+		t.Error("Assign() = true for an unknown job")
+	}
+}
+
+func TestDiscardRemovesOnlyQueuedJobs(t *testing.T) {
+	st := store.NewMemory()
+	m := newTestManager(t, st)
+	queued, ctx := m.Create(context.Background(), 1, 1, KindSingle, "", "text")
+	cancelled, _ := m.Create(context.Background(), 1, 1, KindSingle, "", "text")
+	if err := m.Cancel(cancelled.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Discard(queued.ID)
+	m.Discard(cancelled.ID)
+	if _, ok := m.Get(queued.ID); ok {
+		t.Error("queued job was kept")
+	}
+	if _, err := st.GetJob(context.Background(), queued.ID); err == nil {
+		t.Error("queued job was kept in the store")
+	}
+	if ctx.Err() == nil {
+		t.Error("context of the discarded job was not released")
+	}
+	if got, ok := m.Get(cancelled.ID); !ok || got.State != StateCancelled {
+		t.Errorf("cancelled job = %+v, %t, want it kept", got, ok)
+	}
+}
+
+func TestFinishAfterCancelKeepsCancelled(t *testing.T) {
+	m := newTestManager(t, store.NewMemory())
+	job, _ := m.Create(context.Background(), 1, 1, KindSingle, "", "text")
+	if err := m.Cancel(job.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	m.Finish(job.ID, errors.New("download failed"))
+	if got, _ := m.Get(job.ID); got.State != StateCancelled || got.Error != "" {
+		t.Errorf("job = %+v, want it cancelled without an error", got)
+	}
+}
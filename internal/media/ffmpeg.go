@@ -0,0 +1,154 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrCannotFit = errors.New("media: file cannot fit the requested size")
+
+const audioBitrateKbps = 128
+
+type Processor struct {
+	ffmpegPath  string
+	ffprobePath string
+}
+
+func New(ffmpegPath, ffprobePath string) *Processor {
+	return &Processor{ffmpegPath: ffmpegPath, ffprobePath: ffprobePath}
+}
+
+func (p *Processor) run(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	log.Printf("Executing %s\n", strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("%s failed: %w. STDERR: %s", filepath.Base(name), err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// Duration returns the length of the media file in seconds.
+func (p *Processor) Duration(ctx context.Context, path string) (float64, error) {
+	out, err := p.run(ctx, p.ffprobePath, "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path)
+	if err != nil {
+		return 0, err
+	}
+	duration, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse duration of '%s': %w", path, err)
+	}
+	return duration, nil
+}
+
+func (p *Processor) duration(ctx context.Context, path string, known float64) (float64, error) {
+	if known > 0 {
+		return known, nil
+	}
+	return p.Duration(ctx, path)
+}
+
+// FitToSize re-encodes a video with a bitrate chosen so the result stays
+// under targetBytes.
+func (p *Processor) FitToSize(ctx context.Context, input string, targetBytes int64, knownDuration float64) (string, error) {
+	duration, err := p.duration(ctx, input, knownDuration)
+	if err != nil {
+		return "", err
+	}
+	if duration <= 0 {
+		return "", fmt.Errorf("unknown duration for '%s'", input)
+	}
+	// Leave headroom for container overhead and encoder overshoot.
+	totalKbps := int(float64(targetBytes) * 8 * 0.92 / duration / 1000)
+	videoKbps := totalKbps - audioBitrateKbps
+	if videoKbps < 100 {
+		return "", fmt.Errorf("%w: %d kbps left for video", ErrCannotFit, videoKbps)
+	}
+
+	output := strings.TrimSuffix(input, filepath.Ext(input)) + ".fit.mp4"
+	_, err = p.run(ctx, p.ffmpegPath, "-y", "-i", input,
+		"-c:v", "libx264", "-preset", "veryfast",
+		"-b:v", fmt.Sprintf("%dk", videoKbps), "-maxrate", fmt.Sprintf("%dk", videoKbps), "-bufsize", fmt.Sprintf("%dk", videoKbps*2),
+		"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", audioBitrateKbps),
+		"-movflags", "+faststart", output)
+	if err != nil {
+		os.Remove(output)
+		return "", err
+	}
+	if info, statErr := os.Stat(output); statErr != nil || info.Size() > targetBytes {
+		os.Remove(output)
+		return "", fmt.Errorf("%w: re-encoded file is still too large", ErrCannotFit)
+	}
+	return output, nil
+}
+
+// Split cuts the file into numbered parts of at most partBytes each without
+// re-encoding. The parts are written to a new directory next to the input.
+func (p *Processor) Split(ctx context.Context, input string, partBytes int64, knownDuration float64) ([]string, error) {
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := p.duration(ctx, input, knownDuration)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("unknown duration for '%s'", input)
+	}
+	// Cuts land on keyframes, so aim well below the limit.
+	segmentSeconds := int(duration * float64(partBytes) * 0.85 / float64(info.Size()))
+	if segmentSeconds < 1 {
+		return nil, fmt.Errorf("%w: parts would be shorter than a second", ErrCannotFit)
+	}
+
+	// The parts get a directory of their own, so listing it finds exactly
+	// what ffmpeg wrote, whatever the name of the input.
+	partDir, err := os.MkdirTemp(filepath.Dir(input), "parts-")
+	if err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(input)
+	_, err = p.run(ctx, p.ffmpegPath, "-y", "-i", input, "-map", "0", "-c", "copy",
+		"-f", "segment", "-segment_time", strconv.Itoa(segmentSeconds), "-reset_timestamps", "1",
+		filepath.Join(partDir, "part%03d"+ext))
+	if err != nil {
+		os.RemoveAll(partDir)
+		return nil, err
+	}
+	entries, err := os.ReadDir(partDir)
+	if err != nil {
+		os.RemoveAll(partDir)
+		return nil, err
+	}
+	var parts []string
+	for _, entry := range entries {
+		parts = append(parts, filepath.Join(partDir, entry.Name()))
+	}
+	sort.Strings(parts)
+	if len(parts) == 0 {
+		os.RemoveAll(partDir)
+		return nil, fmt.Errorf("ffmpeg wrote no parts for '%s'", filepath.Base(input))
+	}
+	for _, part := range parts {
+		if partInfo, statErr := os.Stat(part); statErr != nil || partInfo.Size() > partBytes {
+			os.RemoveAll(partDir)
+			return nil, fmt.Errorf("%w: part '%s' is still too large", ErrCannotFit, filepath.Base(part))
+		}
+	}
+	return parts, nil
+}
@@ -0,0 +1,89 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeFFmpeg writes a script that stands in for ffmpeg. It gets the output
+// pattern as its last argument.
+func fakeFFmpeg(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\nfor last; do :; done\n" + body + "\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeInput(t *testing.T, dir string, name string, size int) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSplitListsOnlyItsOwnParts(t *testing.T) {
+	dir := t.TempDir()
+	// The title contains the glob characters and the ".part" of the old
+	// naming, and a leftover file looks like a part of it.
+	input := writeInput(t, dir, "[live] a.part*b.mp3", 1000)
+	writeInput(t, dir, "[live] a.part*b.part000.mp3", 10)
+	ffmpeg := fakeFFmpeg(t, `for i in 000 001 002; do head -c 300 /dev/zero > "$(echo "$last" | sed "s/%03d/$i/")"; done`)
+	p := New(ffmpeg, "")
+
+	parts, err := p.Split(context.Background(), input, 500, 30)
+	if err != nil {
+		t.Fatalf("Split() error = %v", err)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("Split() = %v, want 3 parts", parts)
+	}
+	partDir := filepath.Dir(parts[0])
+	if filepath.Dir(partDir) != dir || partDir == dir {
+		t.Errorf("parts were written to %s, want a new directory in %s", partDir, dir)
+	}
+	for i, part := range parts {
+		if want := "part00" + string(rune('0'+i)) + ".mp3"; filepath.Base(part) != want {
+			t.Errorf("part %d = %s, want %s", i, filepath.Base(part), want)
+		}
+	}
+}
+
+func TestSplitFailsWithoutParts(t *testing.T) {
+	dir := t.TempDir()
+	input := writeInput(t, dir, "song.mp3", 1000)
+	p := New(fakeFFmpeg(t, "exit 0"), "")
+
+	parts, err := p.Split(context.Background(), input, 500, 30)
+	if err == nil || !strings.Contains(err.Error(), "no parts") {
+		t.Fatalf("Split() = %v, %v, want an error about missing parts", parts, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Split() left %d entries in the directory, want only the input", len(entries))
+	}
+}
+
+func TestSplitRejectsPartsAboveLimit(t *testing.T) {
+	dir := t.TempDir()
+	input := writeInput(t, dir, "song.mp3", 1000)
+	ffmpeg := fakeFFmpeg(t, `head -c 900 /dev/zero > "$(echo "$last" | sed "s/%03d/000/")"`)
+	p := New(ffmpeg, "")
+
+	_, err := p.Split(context.Background(), input, 500, 30)
+	if !errors.Is(err, ErrCannotFit) {
+		t.Fatalf("Split() error = %v, want ErrCannotFit", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Split() left %d entries in the directory, want only the input", len(entries))
+	}
+}
@@ -0,0 +1,309 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketMeta     = []byte("meta")
+	bucketUsers    = []byte("users")
+	bucketSettings = []byte("settings")
+	bucketJobs     = []byte("jobs")
+	bucketCache    = []byte("cache")
+	bucketAudit    = []byte("audit")
+	bucketSessions = []byte("sessions")
+
+	keySchemaVersion = []byte("schema_version")
+)
+
+// boltMigrations are applied in order; the schema version stored in the meta
+// bucket is the number of migrations that have already run.
+var boltMigrations = []func(tx *bolt.Tx) error{
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketUsers, bucketSettings, bucketJobs, bucketCache, bucketAudit} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketSessions)
+		return err
+	},
+}
+
+type Bolt struct {
+	db *bolt.DB
+}
+
+func OpenBolt(path string) (*Bolt, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create store directory '%s': %w", dir, err)
+		}
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt store '%s': %w", path, err)
+	}
+	return &Bolt{db: db}, nil
+}
+
+func (s *Bolt) Migrate(ctx context.Context) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		version := 0
+		if raw := meta.Get(keySchemaVersion); raw != nil {
+			version, err = strconv.Atoi(string(raw))
+			if err != nil {
+				return fmt.Errorf("invalid schema version '%s': %w", raw, err)
+			}
+		}
+		if version > len(boltMigrations) {
+			return fmt.Errorf("store schema version %d is newer than supported version %d", version, len(boltMigrations))
+		}
+		for i := version; i < len(boltMigrations); i++ {
+			log.Printf("Applying store migration %d...\n", i+1)
+			if err := boltMigrations[i](tx); err != nil {
+				return fmt.Errorf("store migration %d failed: %w", i+1, err)
+			}
+		}
+		return meta.Put(keySchemaVersion, []byte(strconv.Itoa(len(boltMigrations))))
+	})
+}
+
+func (s *Bolt) Close() error {
+	return s.db.Close()
+}
+
+func int64Key(id int64) []byte {
+	return []byte(strconv.FormatInt(id, 10))
+}
+
+func putJSON(tx *bolt.Tx, bucket []byte, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucket).Put(key, data)
+}
+
+func getJSON(tx *bolt.Tx, bucket []byte, key []byte, value interface{}) error {
+	data := tx.Bucket(bucket).Get(key)
+	if data == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(data, value)
+}
+
+func (s *Bolt) UpsertUser(ctx context.Context, user User) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var existing User
+		if err := getJSON(tx, bucketUsers, int64Key(user.ID), &existing); err == nil && !existing.FirstSeen.IsZero() {
+			user.FirstSeen = existing.FirstSeen
+		}
+		return putJSON(tx, bucketUsers, int64Key(user.ID), user)
+	})
+}
+
+func (s *Bolt) GetUser(ctx context.Context, userID int64) (User, error) {
+	var user User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx, bucketUsers, int64Key(userID), &user)
+	})
+	return user, err
+}
+
+func (s *Bolt) GetSettings(ctx context.Context, userID int64) (Settings, error) {
+	var settings Settings
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx, bucketSettings, int64Key(userID), &settings)
+	})
+	return settings, err
+}
+
+func (s *Bolt) SaveSettings(ctx context.Context, settings Settings) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx, bucketSettings, int64Key(settings.UserID), settings)
+	})
+}
+
+func (s *Bolt) SaveJob(ctx context.Context, job JobRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx, bucketJobs, []byte(job.ID), job)
+	})
+}
+
+func (s *Bolt) GetJob(ctx context.Context, jobID string) (JobRecord, error) {
+	var job JobRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx, bucketJobs, []byte(jobID), &job)
+	})
+	return job, err
+}
+
+func (s *Bolt) ListJobs(ctx context.Context) ([]JobRecord, error) {
+	var jobs []JobRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketJobs).ForEach(func(k, v []byte) error {
+			var job JobRecord
+			if err := json.Unmarshal(v, &job); err != nil {
+				return fmt.Errorf("failed to decode job '%s': %w", k, err)
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, err
+}
+
+func (s *Bolt) DeleteJob(ctx context.Context, jobID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketJobs).Delete([]byte(jobID))
+	})
+}
+
+func (s *Bolt) PutCacheEntry(ctx context.Context, entry CacheEntry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx, bucketCache, []byte(entry.Key), entry)
+	})
+}
+
+func (s *Bolt) DeleteCacheEntry(ctx context.Context, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketCache).Delete([]byte(key))
+	})
+}
+
+func (s *Bolt) ListCacheEntries(ctx context.Context) ([]CacheEntry, error) {
+	var entries []CacheEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketCache).ForEach(func(k, v []byte) error {
+			var entry CacheEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("failed to decode cache entry '%s': %w", k, err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+func (s *Bolt) AppendAudit(ctx context.Context, event AuditEvent) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketAudit)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		event.ID = id
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, id)
+		return putJSON(tx, bucketAudit, key, event)
+	})
+}
+
+func (s *Bolt) ListAudit(ctx context.Context, limit int) ([]AuditEvent, error) {
+	var events []AuditEvent
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(bucketAudit).Cursor()
+		for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+			if limit > 0 && len(events) >= limit {
+				break
+			}
+			var event AuditEvent
+			if err := json.Unmarshal(v, &event); err != nil {
+				return fmt.Errorf("failed to decode audit event: %w", err)
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	return events, err
+}
+
+// DeleteAuditBefore removes the events older than before. Events are keyed
+// in the order they were recorded, so it stops at the first newer one.
+func (s *Bolt) DeleteAuditBefore(ctx context.Context, before time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(bucketAudit).Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.First() {
+			var event AuditEvent
+			if err := json.Unmarshal(v, &event); err == nil && !event.Time.Before(before) {
+				return nil
+			}
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+func (s *Bolt) SaveSession(ctx context.Context, session Session) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx, bucketSessions, []byte(session.Token), session)
+	})
+}
+
+func (s *Bolt) GetSession(ctx context.Context, token string) (Session, error) {
+	var session Session
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx, bucketSessions, []byte(token), &session)
+	})
+	return session, err
+}
+
+func (s *Bolt) DeleteSession(ctx context.Context, token string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSessions).Delete([]byte(token))
+	})
+}
+
+func (s *Bolt) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketSessions)
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var session Session
+			if err := json.Unmarshal(v, &session); err != nil || now.After(session.ExpiresAt) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Memory struct {
+	mu       sync.RWMutex
+	users    map[int64]User
+	settings map[int64]Settings
+	jobs     map[string]JobRecord
+	cache    map[string]CacheEntry
+	audit    []AuditEvent
+	auditSeq uint64
+	sessions map[string]Session
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:    make(map[int64]User),
+		settings: make(map[int64]Settings),
+		jobs:     make(map[string]JobRecord),
+		cache:    make(map[string]CacheEntry),
+		sessions: make(map[string]Session),
+	}
+}
+
+func (m *Memory) Migrate(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) UpsertUser(ctx context.Context, user User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.users[user.ID]; ok && !existing.FirstSeen.IsZero() {
+		user.FirstSeen = existing.FirstSeen
+	}
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, userID int64) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[userID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *Memory) GetSettings(ctx context.Context, userID int64) (Settings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	settings, ok := m.settings[userID]
+	if !ok {
+		return Settings{}, ErrNotFound
+	}
+	return settings, nil
+}
+
+func (m *Memory) SaveSettings(ctx context.Context, settings Settings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.settings[settings.UserID] = settings
+	return nil
+}
+
+func (m *Memory) SaveJob(ctx context.Context, job JobRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.ID] = job
+	return nil
+}
+
+func (m *Memory) GetJob(ctx context.Context, jobID string) (JobRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	job, ok := m.jobs[jobID]
+	if !ok {
+		return JobRecord{}, ErrNotFound
+	}
+	return job, nil
+}
+
+func (m *Memory) ListJobs(ctx context.Context) ([]JobRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	jobs := make([]JobRecord, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+func (m *Memory) DeleteJob(ctx context.Context, jobID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, jobID)
+	return nil
+}
+
+func (m *Memory) PutCacheEntry(ctx context.Context, entry CacheEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cache[entry.Key] = entry
+	return nil
+}
+
+func (m *Memory) DeleteCacheEntry(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.cache, key)
+	return nil
+}
+
+func (m *Memory) ListCacheEntries(ctx context.Context) ([]CacheEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make([]CacheEntry, 0, len(m.cache))
+	for _, entry := range m.cache {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (m *Memory) AppendAudit(ctx context.Context, event AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.auditSeq++
+	event.ID = m.auditSeq
+	m.audit = append(m.audit, event)
+	return nil
+}
+
+func (m *Memory) ListAudit(ctx context.Context, limit int) ([]AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	start := 0
+	if limit > 0 && len(m.audit) > limit {
+		start = len(m.audit) - limit
+	}
+	events := make([]AuditEvent, 0, len(m.audit)-start)
+	for i := len(m.audit) - 1; i >= start; i-- {
+		events = append(events, m.audit[i])
+	}
+	return events, nil
+}
+
+func (m *Memory) DeleteAuditBefore(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for removed < len(m.audit) && m.audit[removed].Time.Before(before) {
+		removed++
+	}
+	m.audit = append([]AuditEvent(nil), m.audit[removed:]...)
+	return removed, nil
+}
+
+func (m *Memory) SaveSession(ctx context.Context, session Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session.Token] = session
+	return nil
+}
+
+func (m *Memory) GetSession(ctx context.Context, token string) (Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[token]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (m *Memory) DeleteSession(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, token)
+	return nil
+}
+
+func (m *Memory) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for token, session := range m.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(m.sessions, token)
+			removed++
+		}
+	}
+	return removed, nil
+}
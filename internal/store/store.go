@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNotFound = errors.New("store: record not found")
+
+type User struct {
+	ID        int64     `json:"id"`
+	UserName  string    `json:"user_name"`
+	FirstName string    `json:"first_name"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type Settings struct {
+	UserID         int64     `json:"user_id"`
+	Language       string    `json:"language"`
+	DefaultType    string    `json:"default_type"`
+	AudioFormat    string    `json:"audio_format"`
+	AudioQuality   string    `json:"audio_quality"`
+	MaxResolution  int       `json:"max_resolution"`
+	EmbedThumbnail bool      `json:"embed_thumbnail"`
+	Caption        bool      `json:"caption"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type JobRecord struct {
+	ID     string `json:"id"`
+	UserID int64  `json:"user_id"`
+	ChatID int64  `json:"chat_id"`
+	Kind   string `json:"kind"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	State  string `json:"state"`
+	Error  string `json:"error"`
+	// Resume holds what the bot needs to restart an interrupted job.
+	Resume    json.RawMessage `json:"resume,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type CacheEntry struct {
+	Key         string    `json:"key"`
+	Source      string    `json:"source"`
+	OriginalURL string    `json:"original_url"`
+	FileID      string    `json:"file_id"`
+	MediaKind   string    `json:"media_kind"`
+	Title       string    `json:"title"`
+	Artist      string    `json:"artist"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsed    time.Time `json:"last_used"`
+	Hits        int       `json:"hits"`
+}
+
+type AuditEvent struct {
+	ID     uint64    `json:"id"`
+	Time   time.Time `json:"time"`
+	UserID int64     `json:"user_id"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail"`
+}
+
+type Session struct {
+	Token     string          `json:"token"`
+	Kind      string          `json:"kind"`
+	UserID    int64           `json:"user_id"`
+	ChatID    int64           `json:"chat_id"`
+	MessageID int             `json:"message_id"`
+	URL       string          `json:"url"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+type UserStore interface {
+	UpsertUser(ctx context.Context, user User) error
+	GetUser(ctx context.Context, userID int64) (User, error)
+}
+
+type SettingsStore interface {
+	GetSettings(ctx context.Context, userID int64) (Settings, error)
+	SaveSettings(ctx context.Context, settings Settings) error
+}
+
+type JobStore interface {
+	SaveJob(ctx context.Context, job JobRecord) error
+	GetJob(ctx context.Context, jobID string) (JobRecord, error)
+	ListJobs(ctx context.Context) ([]JobRecord, error)
+	DeleteJob(ctx context.Context, jobID string) error
+}
+
+type CacheStore interface {
+	PutCacheEntry(ctx context.Context, entry CacheEntry) error
+	DeleteCacheEntry(ctx context.Context, key string) error
+	ListCacheEntries(ctx context.Context) ([]CacheEntry, error)
+}
+
+type AuditStore interface {
+	AppendAudit(ctx context.Context, event AuditEvent) error
+	ListAudit(ctx context.Context, limit int) ([]AuditEvent, error)
+	DeleteAuditBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+type SessionStore interface {
+	SaveSession(ctx context.Context, session Session) error
+	GetSession(ctx context.Context, token string) (Session, error)
+	DeleteSession(ctx context.Context, token string) error
+	DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error)
+}
+
+type Store interface {
+	UserStore
+	SettingsStore
+	JobStore
+	CacheStore
+	AuditStore
+	SessionStore
+
+	Migrate(ctx context.Context) error
+	Close() error
+}
+
+func Open(driver, path string) (Store, error) {
+	switch driver {
+	case "bolt":
+		return OpenBolt(path)
+	case "memory":
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("unknown store driver '%s'", driver)
+}
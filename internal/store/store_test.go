@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	bolt, err := OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt() error = %v", err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+	if err := bolt.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return map[string]Store{"bolt": bolt, "memory": NewMemory()}
+}
+
+func TestDeleteAuditBefore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	for name, st := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, time.Hour, 0} {
+				if err := st.AppendAudit(ctx, AuditEvent{Time: now.Add(-age), UserID: 1, Action: "link"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			removed, err := st.DeleteAuditBefore(ctx, now.Add(-24*time.Hour))
+			if err != nil {
+				t.Fatalf("DeleteAuditBefore() error = %v", err)
+			}
+			if removed != 2 {
+				t.Errorf("DeleteAuditBefore() removed %d events, want 2", removed)
+			}
+			events, err := st.ListAudit(ctx, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 2 {
+				t.Fatalf("ListAudit() returned %d events, want 2", len(events))
+			}
+
+			if err := st.AppendAudit(ctx, AuditEvent{Time: now, UserID: 1, Action: "link"}); err != nil {
+				t.Fatal(err)
+			}
+			events, _ = st.ListAudit(ctx, 1)
+			if len(events) != 1 || events[0].ID != 5 {
+				t.Errorf("newest event = %+v, want ID 5", events)
+			}
+		})
+	}
+}
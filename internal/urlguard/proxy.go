@@ -0,0 +1,162 @@
+package urlguard
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// blockedStatus is the status line of refused requests. Clients print the
+// reason phrase, so the failure can be told apart from a 403 of the site.
+const blockedStatus = "403 Blocked by urlguard"
+
+// hopHeaders only apply to a single connection and are not forwarded.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Proxy is a local HTTP proxy whose connections go through the guard.
+// Programs that fetch URLs themselves, like yt-dlp, resolve hosts and follow
+// redirects on their own; pointed at the proxy, every connection they open is
+// checked when it is made.
+type Proxy struct {
+	guard     *Guard
+	listener  net.Listener
+	server    *http.Server
+	transport *http.Transport
+}
+
+// StartProxy serves the proxy on a random loopback port.
+func (g *Guard) StartProxy() (*Proxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start URL guard proxy: %w", err)
+	}
+	p := &Proxy{guard: g, listener: listener, transport: g.Transport()}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		if err := p.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("URL guard proxy stopped: %v", err)
+		}
+	}()
+	return p, nil
+}
+
+// URL is the value for the proxy settings of clients.
+func (p *Proxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+func (p *Proxy) Close() error {
+	p.transport.CloseIdleConnections()
+	return p.server.Close()
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if r.URL.Scheme != "http" || r.URL.Host == "" {
+		http.Error(w, "only absolute http URLs can be proxied", http.StatusBadRequest)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	removeHopHeaders(out.Header)
+	// The transport does not follow redirects, so the client asks for the
+	// next location itself and it is checked again.
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		refuse(w, err)
+		return
+	}
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel serves CONNECT, which clients use for https.
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := p.guard.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		refuse(w, err)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunnelling is not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	defer client.Close()
+	defer upstream.Close()
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// The reader may hold bytes the client sent right after CONNECT.
+		io.Copy(upstream, buffered)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, upstream)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+	}
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// refuse answers a request the proxy could not or would not forward.
+func refuse(w http.ResponseWriter, err error) {
+	if !errors.Is(err, ErrBlockedAddress) && !errors.Is(err, ErrDomainDenied) {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	conn, buffered, hijackErr := hijacker.Hijack()
+	if hijackErr != nil {
+		return
+	}
+	defer conn.Close()
+	body := err.Error() + "\n"
+	fmt.Fprintf(buffered, "HTTP/1.1 %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", blockedStatus, len(body), body)
+	buffered.Flush()
+}
@@ -0,0 +1,218 @@
+package urlguard
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type fakeResolver map[string][]netip.Addr
+
+func (r fakeResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	if addrs, ok := r[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+var testPublicAddr = netip.MustParseAddr("127.0.0.1")
+
+// testGuard treats 127.0.0.1 as a public address so test servers can stand in
+// for the internet. The rest of 127.0.0.0/8 stays blocked.
+func testGuard(resolver Resolver) *Guard {
+	g := New(Options{Resolver: resolver})
+	g.blocked = func(ip netip.Addr) bool {
+		return ip.Unmap() != testPublicAddr && Blocked(ip)
+	}
+	return g
+}
+
+// internalServer listens on 127.0.0.2, an address the test guard blocks, and
+// records whether it was reached.
+func internalServer(t *testing.T, tlsServer bool) (*httptest.Server, *atomic.Bool) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.2: %v", err)
+	}
+	reached := new(atomic.Bool)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached.Store(true)
+		io.WriteString(w, "internal")
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	if tlsServer {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	t.Cleanup(server.Close)
+	return server, reached
+}
+
+func startProxy(t *testing.T, g *Guard) *http.Client {
+	t.Helper()
+	p, err := g.StartProxy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	proxyURL, err := url.Parse(p.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+}
+
+func TestProxyForwardsPublicRequests(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "plain")
+	}))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	}))
+	defer secure.Close()
+	client := startProxy(t, testGuard(fakeResolver{"public.test": {testPublicAddr}}))
+
+	for _, tc := range []struct {
+		server *httptest.Server
+		scheme string
+		want   string
+	}{
+		{plain, "http", "plain"},
+		{secure, "https", "secure"},
+	} {
+		_, port, _ := net.SplitHostPort(tc.server.Listener.Addr().String())
+		resp, err := client.Get(fmt.Sprintf("%s://public.test:%s/", tc.scheme, port))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.scheme, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tc.want {
+			t.Errorf("%s: got body %q, want %q", tc.scheme, body, tc.want)
+		}
+	}
+}
+
+func TestProxyRefusesRedirectToPrivateAddress(t *testing.T) {
+	internal, reached := internalServer(t, false)
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/latest/meta-data/", http.StatusFound)
+	}))
+	defer public.Close()
+	client := startProxy(t, testGuard(fakeResolver{}))
+
+	resp, err := client.Get(public.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Status != blockedStatus {
+		t.Errorf("got status %q, want %q", resp.Status, blockedStatus)
+	}
+	if reached.Load() {
+		t.Error("the redirect reached the internal server")
+	}
+}
+
+func TestProxyRefusesHostResolvingToPrivateAddress(t *testing.T) {
+	plainInternal, plainReached := internalServer(t, false)
+	secureInternal, secureReached := internalServer(t, true)
+	client := startProxy(t, testGuard(fakeResolver{"internal.test": {netip.MustParseAddr("127.0.0.2")}}))
+
+	_, plainPort, _ := net.SplitHostPort(plainInternal.Listener.Addr().String())
+	resp, err := client.Get("http://internal.test:" + plainPort + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Status != blockedStatus {
+		t.Errorf("http: got status %q, want %q", resp.Status, blockedStatus)
+	}
+
+	_, securePort, _ := net.SplitHostPort(secureInternal.Listener.Addr().String())
+	_, err = client.Get("https://internal.test:" + securePort + "/")
+	if err == nil || !strings.Contains(err.Error(), "Blocked by urlguard") {
+		t.Errorf("https: got error %v, want the CONNECT to be refused", err)
+	}
+
+	if plainReached.Load() || secureReached.Load() {
+		t.Error("a request reached the internal server")
+	}
+}
+
+func TestCheckRejectsHostResolvingToPrivateAddress(t *testing.T) {
+	g := New(Options{Resolver: fakeResolver{
+		"metadata.test": {netip.MustParseAddr("169.254.169.254")},
+		"mixed.test":    {netip.MustParseAddr("93.184.216.34"), netip.MustParseAddr("10.0.0.5")},
+		"public.test":   {netip.MustParseAddr("93.184.216.34")},
+	}})
+	for host, blocked := range map[string]bool{"metadata.test": true, "mixed.test": true, "public.test": false} {
+		_, err := g.Check(context.Background(), "https://"+host+"/")
+		if got := err != nil; got != blocked {
+			t.Errorf("%s: got error %v, want blocked %t", host, err, blocked)
+		}
+	}
+}
+
+func TestProxyIgnoresDomainLists(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "media")
+	}))
+	defer cdn.Close()
+	g := testGuard(fakeResolver{"cdn.test": {testPublicAddr}})
+	g.opts.AllowDomains = []string{"youtube.com"}
+	g.opts.DenyDomains = []string{"cdn.test"}
+	client := startProxy(t, g)
+
+	_, port, _ := net.SplitHostPort(cdn.Listener.Addr().String())
+	resp, err := client.Get("http://cdn.test:" + port + "/video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "media" {
+		t.Errorf("got status %q and body %q, want the CDN response", resp.Status, body)
+	}
+
+	if _, err := g.Normalize("https://cdn.test/video"); !errors.Is(err, ErrDomainDenied) {
+		t.Errorf("Normalize() error = %v, want %v", err, ErrDomainDenied)
+	}
+	if _, err := g.Normalize("https://music.youtube.com/watch?v=1"); err != nil {
+		t.Errorf("Normalize() error = %v for an allowed subdomain", err)
+	}
+}
+
+func TestBlockedEmbeddedIPv4(t *testing.T) {
+	for addr, blocked := range map[string]bool{
+		"64:ff9b::7f00:1":      true,
+		"64:ff9b::a00:5":       true,
+		"64:ff9b::5db8:d822":   false,
+		"2002:7f00:1::":        true,
+		"2002:c0a8:101::1":     true,
+		"2002:5db8:d822::1":    false,
+		"2606:4700:4700::1111": false,
+		"::ffff:192.168.1.1":   true,
+	} {
+		if got := Blocked(netip.MustParseAddr(addr)); got != blocked {
+			t.Errorf("Blocked(%s) = %t, want %t", addr, got, blocked)
+		}
+	}
+}
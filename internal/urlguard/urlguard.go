@@ -0,0 +1,305 @@
+// Package urlguard checks user supplied links before the bot fetches them, so
+// nobody can make it reach internal services or local files.
+package urlguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidURL     = errors.New("urlguard: invalid URL")
+	ErrScheme         = errors.New("urlguard: only http and https URLs are allowed")
+	ErrDomainDenied   = errors.New("urlguard: domain is not allowed")
+	ErrBlockedAddress = errors.New("urlguard: address is not publicly routable")
+)
+
+// blockedPrefixes are the ranges that are not reachable on the public
+// internet: private, loopback, link-local, shared, documentation, multicast
+// and reserved networks.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+var (
+	nat64Prefix     = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFourPrefix = netip.MustParsePrefix("2002::/16")
+)
+
+// Blocked reports whether ip belongs to a range the bot must not connect to.
+// NAT64 and 6to4 addresses are judged by the IPv4 address they embed.
+func Blocked(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	if embedded, ok := embeddedIPv4(ip); ok {
+		return Blocked(embedded)
+	}
+	return false
+}
+
+// embeddedIPv4 returns the IPv4 address carried by a NAT64 or 6to4 address.
+func embeddedIPv4(ip netip.Addr) (netip.Addr, bool) {
+	b := ip.As16()
+	switch {
+	case nat64Prefix.Contains(ip):
+		return netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]}), true
+	case sixToFourPrefix.Contains(ip):
+		return netip.AddrFrom4([4]byte{b[2], b[3], b[4], b[5]}), true
+	}
+	return netip.Addr{}, false
+}
+
+// Resolver looks up the addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+type Options struct {
+	// AllowDomains, when not empty, is the only set of domains links may
+	// point to. Subdomains of a listed domain are included.
+	AllowDomains []string
+	// DenyDomains are refused even if AllowDomains lists them.
+	DenyDomains []string
+	// AllowPrivate turns off the address checks, e.g. to test against a
+	// local server.
+	AllowPrivate bool
+	Resolver     Resolver
+}
+
+type Guard struct {
+	opts Options
+	// blocked is Blocked outside of tests.
+	blocked func(netip.Addr) bool
+}
+
+func New(opts Options) *Guard {
+	if opts.Resolver == nil {
+		opts.Resolver = net.DefaultResolver
+	}
+	normalize := func(domains []string) []string {
+		var out []string
+		for _, domain := range domains {
+			if domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), "."); domain != "" {
+				out = append(out, domain)
+			}
+		}
+		return out
+	}
+	opts.AllowDomains = normalize(opts.AllowDomains)
+	opts.DenyDomains = normalize(opts.DenyDomains)
+	return &Guard{opts: opts, blocked: Blocked}
+}
+
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize parses raw and checks everything that can be checked without
+// the network. Links without a scheme are taken as https. The result has a
+// lowercase scheme and host, no default port and no fragment.
+func (g *Guard) Normalize(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.ContainsAny(raw, " \t\r\n") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidURL, raw)
+	}
+	u, err := url.Parse(raw)
+	if err == nil && u.Scheme == "" && !strings.HasPrefix(raw, "/") {
+		u, err = url.Parse("https://" + raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: %q", ErrScheme, u.Scheme)
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("%w: credentials in URL", ErrInvalidURL)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return nil, fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+	u.Fragment, u.RawFragment = "", ""
+
+	if err := g.checkDomain(host); err != nil {
+		return nil, err
+	}
+	if err := g.checkHost(host); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// checkDomain applies the domain lists. They only concern the link a user
+// sends, not the CDN and API hosts a download connects to afterwards.
+func (g *Guard) checkDomain(host string) error {
+	if matchesDomain(host, g.opts.DenyDomains) {
+		return fmt.Errorf("%w: %s is denied", ErrDomainDenied, host)
+	}
+	if len(g.opts.AllowDomains) > 0 && !matchesDomain(host, g.opts.AllowDomains) {
+		return fmt.Errorf("%w: %s is not on the allow list", ErrDomainDenied, host)
+	}
+	return nil
+}
+
+// checkHost rejects blocked IP literals and localhost. host must be lowercase
+// and without a port.
+func (g *Guard) checkHost(host string) error {
+	if ip, err := netip.ParseAddr(host); err == nil && !g.opts.AllowPrivate && g.blocked(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		if !g.opts.AllowPrivate {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+		}
+	}
+	return nil
+}
+
+// CheckRedirect checks a URL the bot is redirected to. Redirects commonly
+// lead to CDN hosts, so only the scheme and address checks apply.
+func (g *Guard) CheckRedirect(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: %q", ErrScheme, u.Scheme)
+	}
+	return g.checkHost(strings.TrimSuffix(strings.ToLower(u.Hostname()), "."))
+}
+
+// Check normalizes raw and resolves its host. It fails if any address the
+// host resolves to is blocked, since a client may pick any of them.
+func (g *Guard) Check(ctx context.Context, raw string) (*url.URL, error) {
+	u, err := g.Normalize(raw)
+	if err != nil || g.opts.AllowPrivate {
+		return u, err
+	}
+	host := u.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		return u, nil
+	}
+	addrs, err := g.opts.Resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot resolve %s: %v", ErrInvalidURL, host, err)
+	}
+	for _, addr := range addrs {
+		if g.blocked(addr) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrBlockedAddress, host, addr)
+		}
+	}
+	return u, nil
+}
+
+// Control is a net.Dialer hook that refuses connections to blocked
+// addresses. It sees the address after DNS resolution, so it also covers
+// redirects and hosts whose records change between Check and the request.
+func (g *Guard) Control(network, address string, _ syscall.RawConn) error {
+	if g.opts.AllowPrivate {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	if g.blocked(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// DialContext connects to address after checking its host like checkHost
+// and resolving it with the guard's resolver. Every resolved address must be
+// allowed, and the connection itself still passes through Control.
+func (g *Guard) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if err := g.checkHost(host); err != nil {
+		return nil, err
+	}
+	var addrs []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{ip}
+	} else if addrs, err = g.opts.Resolver.LookupNetIP(ctx, "ip", host); err != nil {
+		return nil, fmt.Errorf("%w: cannot resolve %s: %v", ErrInvalidURL, host, err)
+	}
+	if !g.opts.AllowPrivate {
+		for _, addr := range addrs {
+			if g.blocked(addr) {
+				return nil, fmt.Errorf("%w: %s resolves to %s", ErrBlockedAddress, host, addr)
+			}
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: g.Control}
+	lastErr := fmt.Errorf("%w: %s has no addresses", ErrInvalidURL, host)
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// Transport returns an HTTP transport whose connections pass through
+// DialContext. It does not use a proxy, because the proxy address would be
+// checked instead of the target.
+func (g *Guard) Transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = g.DialContext
+	return transport
+}